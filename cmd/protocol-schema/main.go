@@ -0,0 +1,34 @@
+package main
+
+import (
+	"chatstreamapp/internal/protocol"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Writes the JSON Schema of the WebSocket protocol, see go generate in
+// internal/protocol
+func main() {
+	out := flag.String("o", "", "output file (default stdout)")
+	flag.Parse()
+
+	data, err := json.MarshalIndent(protocol.Schema(), "", "  ")
+	if err != nil {
+		log.Fatalf("encode schema: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *out == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(*out), 0o755); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,247 @@
+package announce
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/store"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Shortest interval a repeating announcement may use
+const MinInterval = time.Minute
+
+// Sender delivers announcements
+type Sender interface {
+	// Broadcast sends a message to a room
+	Broadcast(message *models.Message) error
+
+	// Announce sends a message to every connected client
+	Announce(message *models.Message) error
+}
+
+// Announcement is a message from the operators sent at a set time and
+// optionally repeated
+type Announcement struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+
+	// The room it goes to; empty sends it to everyone
+	Room string `json:"room,omitempty"`
+
+	// When it is next sent
+	At time.Time `json:"at"`
+
+	// How often it repeats; 0 sends it once
+	Every config.Duration `json:"every,omitempty"`
+
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Scheduler sends announcements when they are due. Changes are saved to a
+// file when one is set, so schedules survive restarts.
+type Scheduler struct {
+	mu   sync.Mutex
+	path string
+	list []*Announcement
+
+	// Signalled when the schedule changes so Run recomputes its timer
+	wake chan struct{}
+}
+
+// Schedule is the server's announcement scheduler
+var Schedule = &Scheduler{wake: make(chan struct{}, 1)}
+
+// Load reads the announcements saved at path, which later changes are saved
+// to. A missing file is an empty schedule.
+func (s *Scheduler) Load(path string) error {
+	var list []*Announcement
+	if err := store.LoadJSON(path, "announcements", &list); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	s.list = list
+	s.notify()
+	return nil
+}
+
+// Add schedules an announcement, filling in its ID and creation time.
+// Without a time, a repeating announcement is first sent one interval from
+// now.
+func (s *Scheduler) Add(a Announcement) (*Announcement, error) {
+	if a.Content == "" {
+		return nil, invalid("content is required")
+	}
+	every := a.Every.Duration()
+	if every != 0 && every < MinInterval {
+		return nil, invalid("every must be at least %s", MinInterval)
+	}
+	now := time.Now()
+	if a.At.IsZero() {
+		if every == 0 {
+			return nil, invalid("at or every is required")
+		}
+		a.At = now.Add(every)
+	}
+	if every == 0 && !a.At.After(now) {
+		return nil, invalid("at must be in the future")
+	}
+
+	a.ID = uuid.New().String()
+	a.CreatedAt = now
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.list = append(s.list, &a)
+	s.notify()
+	copied := a
+	return &copied, s.save()
+}
+
+// Remove cancels an announcement, reporting false if there was none
+func (s *Scheduler) Remove(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, a := range s.list {
+		if a.ID == id {
+			s.list = append(s.list[:i], s.list[i+1:]...)
+			s.notify()
+			return true, s.save()
+		}
+	}
+	return false, nil
+}
+
+// List returns the scheduled announcements, soonest first
+func (s *Scheduler) List() []Announcement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Announcement, len(s.list))
+	for i, a := range s.list {
+		list[i] = *a
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].At.Before(list[j].At) })
+	return list
+}
+
+// Run sends announcements as they fall due until stop is closed. Repeating
+// announcements that were missed, e.g. while the server was down, are sent
+// once and then resume their interval.
+func (s *Scheduler) Run(sender Sender, stop <-chan struct{}) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+
+		for _, a := range s.due(time.Now()) {
+			message := models.NewAnnouncement(a.Content, a.Room)
+			var err error
+			if a.Room != "" {
+				err = sender.Broadcast(message)
+			} else {
+				err = sender.Announce(message)
+			}
+			if err != nil {
+				logger.Warning("failed to send scheduled announcement", "announcement_id", a.ID, logger.RoomID, a.Room, "error", err)
+				continue
+			}
+			logger.Info("scheduled announcement sent", "announcement_id", a.ID, logger.RoomID, a.Room)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next, ok := s.next(); ok {
+			timer.Reset(time.Until(next))
+		}
+	}
+}
+
+// due removes the announcements due at now from the schedule, moving
+// repeating ones to their next time, and returns them
+func (s *Scheduler) due(now time.Time) []Announcement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []Announcement
+	kept := s.list[:0]
+	for _, a := range s.list {
+		if a.At.After(now) {
+			kept = append(kept, a)
+			continue
+		}
+		due = append(due, *a)
+		if every := a.Every.Duration(); every > 0 {
+			for !a.At.After(now) {
+				a.At = a.At.Add(every)
+			}
+			kept = append(kept, a)
+		}
+	}
+	s.list = kept
+
+	if len(due) > 0 {
+		if err := s.save(); err != nil {
+			logger.Error("failed to save announcements", "error", err)
+		}
+	}
+	return due
+}
+
+// next returns when the soonest announcement is due
+func (s *Scheduler) next() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, a := range s.list {
+		if next.IsZero() || a.At.Before(next) {
+			next = a.At
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// notify wakes Run without blocking
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// save writes the schedule to the file, replacing it atomically
+func (s *Scheduler) save() error {
+	if s.path == "" {
+		return nil
+	}
+	list := s.list
+	if list == nil {
+		list = []*Announcement{}
+	}
+	return store.SaveJSON(s.path, "announcements", list)
+}
+
+func invalid(format string, args ...any) error {
+	return &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,203 @@
+package announce
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/models"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSender passes on what it is asked to send. Room messages arrive on
+// rooms and server-wide ones on everyone.
+type fakeSender struct {
+	rooms    chan *models.Message
+	everyone chan *models.Message
+}
+
+func newFakeSender() *fakeSender {
+	return &fakeSender{
+		rooms:    make(chan *models.Message, 10),
+		everyone: make(chan *models.Message, 10),
+	}
+}
+
+func (s *fakeSender) Broadcast(message *models.Message) error {
+	s.rooms <- message
+	return nil
+}
+
+func (s *fakeSender) Announce(message *models.Message) error {
+	s.everyone <- message
+	return nil
+}
+
+func newScheduler() *Scheduler {
+	return &Scheduler{wake: make(chan struct{}, 1)}
+}
+
+func TestAdd(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		a       Announcement
+		wantErr bool
+		// How far from now the first send should be, when valid
+		wantIn time.Duration
+	}{
+		{"once", Announcement{Content: "maintenance at noon", At: now.Add(time.Hour)}, false, time.Hour},
+		{"repeating from a time", Announcement{Content: "tip", At: now.Add(time.Minute), Every: config.Duration(time.Hour)}, false, time.Minute},
+		// Without a time the first send is one interval away
+		{"repeating from now", Announcement{Content: "tip", Every: config.Duration(time.Hour)}, false, time.Hour},
+		{"missing content", Announcement{At: now.Add(time.Hour)}, true, 0},
+		{"no time or interval", Announcement{Content: "when?"}, true, 0},
+		{"once in the past", Announcement{Content: "late", At: now.Add(-time.Minute)}, true, 0},
+		{"interval too short", Announcement{Content: "spam", Every: config.Duration(time.Second)}, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScheduler()
+			a, err := s.Add(tt.a)
+			if tt.wantErr {
+				var coded *models.CodedError
+				if !errors.As(err, &coded) || coded.Code != models.ErrorCodeInvalidRequest {
+					t.Fatalf("error = %v, want invalid_request", err)
+				}
+				if len(s.List()) != 0 {
+					t.Error("invalid announcement was scheduled")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.ID == "" || a.CreatedAt.IsZero() {
+				t.Errorf("ID %q and CreatedAt %v not filled in", a.ID, a.CreatedAt)
+			}
+			if in := a.At.Sub(now); in < tt.wantIn || in > tt.wantIn+time.Second {
+				t.Errorf("first send in %s, want %s", in, tt.wantIn)
+			}
+			if list := s.List(); len(list) != 1 || list[0].ID != a.ID {
+				t.Errorf("List() = %+v, want the added announcement", list)
+			}
+		})
+	}
+}
+
+func TestDue(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := newScheduler()
+	s.list = []*Announcement{
+		{ID: "once", At: start.Add(time.Minute)},
+		{ID: "hourly", At: start.Add(30 * time.Minute), Every: config.Duration(time.Hour)},
+		{ID: "later", At: start.Add(24 * time.Hour)},
+	}
+
+	steps := []struct {
+		at   time.Duration
+		due  []string
+		next time.Duration
+	}{
+		{0, nil, time.Minute},
+		// One-shot announcements are sent once and dropped
+		{time.Minute, []string{"once"}, 30 * time.Minute},
+		{10 * time.Minute, nil, 30 * time.Minute},
+		// Repeating ones move to their next time
+		{30 * time.Minute, []string{"hourly"}, 90 * time.Minute},
+		// Missed repeats are sent once, then resume their interval
+		{5*time.Hour + 45*time.Minute, []string{"hourly"}, 6*time.Hour + 30*time.Minute},
+		{24 * time.Hour, []string{"hourly", "later"}, 24*time.Hour + 30*time.Minute},
+	}
+	for _, step := range steps {
+		var got []string
+		for _, a := range s.due(start.Add(step.at)) {
+			got = append(got, a.ID)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(step.due, ",") {
+			t.Errorf("due at +%s = %v, want %v", step.at, got, step.due)
+		}
+		next, ok := s.next()
+		if !ok || !next.Equal(start.Add(step.next)) {
+			t.Errorf("next after +%s = +%s, want +%s", step.at, next.Sub(start), step.next)
+		}
+	}
+	if list := s.List(); len(list) != 1 || list[0].ID != "hourly" {
+		t.Errorf("List() = %+v, want only the repeating announcement left", list)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s := newScheduler()
+	past := time.Now().Add(-time.Second)
+	s.list = []*Announcement{
+		{ID: "room", Content: "welcome to dev", Room: "dev", At: past},
+		{ID: "everyone", Content: "restart tonight", At: past},
+	}
+	sender := newFakeSender()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.Run(sender, stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	expect := func(ch chan *models.Message, content, room string) {
+		t.Helper()
+		select {
+		case message := <-ch:
+			if message.Type != models.MessageTypeAnnouncement || message.Content != content || message.Room != room {
+				t.Errorf("sent %+v, want a %s announcement %q to room %q", message, models.MessageTypeAnnouncement, content, room)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%q wasn't sent", content)
+		}
+	}
+	expect(sender.rooms, "welcome to dev", "dev")
+	expect(sender.everyone, "restart tonight", "")
+
+	// Adding wakes Run for the new schedule
+	if _, err := s.Add(Announcement{Content: "soon", At: time.Now().Add(50 * time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+	expect(sender.everyone, "soon", "")
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "announcements.json")
+
+	s := newScheduler()
+	if err := s.Load(path); err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	kept, err := s.Add(Announcement{Content: "tip", Every: config.Duration(time.Hour), CreatedBy: "ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := s.Add(Announcement{Content: "once", At: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.Remove(removed.ID); !ok || err != nil {
+		t.Fatalf("Remove() = %v, %v", ok, err)
+	}
+	if ok, _ := s.Remove(removed.ID); ok {
+		t.Error("removed the same announcement twice")
+	}
+
+	restarted := newScheduler()
+	if err := restarted.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	list := restarted.List()
+	if len(list) != 1 || list[0].ID != kept.ID || list[0].CreatedBy != "ops" || !list[0].At.Equal(kept.At) {
+		t.Errorf("after restart List() = %+v, want %+v", list, kept)
+	}
+}
@@ -0,0 +1,44 @@
+package announce
+
+import (
+	"chatstreamapp/internal/config"
+	"strings"
+	"text/template"
+)
+
+// WelcomeData is what welcome templates can refer to
+type WelcomeData struct {
+	Username string
+
+	// The room being joined; empty for the welcome on connecting
+	Room   string
+	RoomID string
+}
+
+// Welcome renders the message sent to a new connection, returning "" when
+// none is configured
+func Welcome(username string) (string, error) {
+	return render(config.Get().Announcements.Welcome, WelcomeData{Username: username})
+}
+
+// RoomWelcome renders the message sent to a user joining a room, returning
+// "" when none is configured for it
+func RoomWelcome(username, roomID, roomName string) (string, error) {
+	tmpl := config.Get().Announcements.RoomWelcomeFor(roomID)
+	return render(tmpl, WelcomeData{Username: username, Room: roomName, RoomID: roomID})
+}
+
+func render(text string, data WelcomeData) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	tmpl, err := template.New("welcome").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,79 @@
+package announce
+
+import (
+	"chatstreamapp/internal/config"
+	"testing"
+)
+
+func TestWelcome(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{"none configured", "", "", false},
+		{"plain", "Welcome to the chat!", "Welcome to the chat!", false},
+		{"username", "Hi {{.Username}}, be nice.", "Hi alice, be nice.", false},
+		// Text templates don't escape; clients render content as text
+		{"no escaping", "Hi {{.Username}} <3", "Hi alice <3", false},
+		{"unknown field", "Hi {{.Nickname}}", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Announcements.Welcome = tt.template
+			config.Set(cfg)
+			t.Cleanup(func() { config.Set(config.Default()) })
+
+			got, err := Welcome("alice")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Welcome() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoomWelcome(t *testing.T) {
+	cfg := config.Default()
+	cfg.Announcements.RoomWelcome = map[string]string{
+		"dev": "{{.Username}} joined {{.Room}} ({{.RoomID}}). Builds are in #ci.",
+		"*":   "Welcome to {{.Room}}, {{.Username}}",
+		"ci":  "",
+	}
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	tests := []struct {
+		roomID, roomName string
+		want             string
+	}{
+		{"dev", "Development", "alice joined Development (dev). Builds are in #ci."},
+		// Rooms without their own template use "*"
+		{"random", "Random", "Welcome to Random, alice"},
+		// An empty template turns the welcome off for that room
+		{"ci", "CI", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.roomID, func(t *testing.T) {
+			got, err := RoomWelcome("alice", tt.roomID, tt.roomName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("RoomWelcome() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Without "*" other rooms get none
+	cfg = config.Default()
+	cfg.Announcements.RoomWelcome = map[string]string{"dev": "hi"}
+	config.Set(cfg)
+	if got, err := RoomWelcome("alice", "random", "Random"); got != "" || err != nil {
+		t.Errorf("RoomWelcome() = %q, %v, want none", got, err)
+	}
+}
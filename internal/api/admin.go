@@ -0,0 +1,600 @@
+package api
+
+import (
+	"chatstreamapp/internal/announce"
+	"chatstreamapp/internal/audit"
+	"chatstreamapp/internal/bot"
+	"chatstreamapp/internal/command"
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/hub"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/webhook"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reloader re-reads the configuration at runtime
+type Reloader interface {
+	Reload() ([]string, error)
+}
+
+// AdminHub is the hub as the admin API sees it
+type AdminHub interface {
+	Hub
+	Snapshot() hub.Snapshot
+	CloseConnection(connectionID string) error
+	DeleteRoom(roomID string) error
+	PurgeMessages(roomID, userID string) (int, error)
+	Announce(message *models.Message) error
+}
+
+// SetupAdminRoutes configures the API for operators with the admin role
+func SetupAdminRoutes(router *gin.Engine, reloader Reloader, chatHub AdminHub) {
+	admin := router.Group("/api/admin", requireAdmin())
+	{
+		admin.POST("/reload", reloadConfig(reloader))
+
+		admin.GET("/connections", listConnections(chatHub))
+		admin.DELETE("/connections/:id", closeConnection(chatHub))
+
+		admin.GET("/rooms", listRooms(chatHub))
+		admin.DELETE("/rooms/:id", deleteRoom(chatHub))
+		admin.DELETE("/rooms/:id/messages", purgeMessages(chatHub))
+
+		admin.POST("/announcements", createAnnouncement(chatHub))
+		admin.GET("/announcements", listAnnouncements)
+		admin.DELETE("/announcements/:id", cancelAnnouncement)
+
+		admin.GET("/webhooks", listWebhooks)
+		admin.POST("/webhooks", createWebhook)
+		admin.DELETE("/webhooks/:id", deleteWebhook)
+		admin.GET("/webhooks/:id/deliveries", listWebhookDeliveries)
+		admin.GET("/webhooks/dead-letters", listDeadLetters)
+		admin.POST("/webhooks/dead-letters/:id/retry", retryDeadLetter)
+		admin.GET("/webhooks/incoming", listIncomingWebhooks)
+		admin.POST("/webhooks/incoming", createIncomingWebhook(chatHub))
+		admin.DELETE("/webhooks/incoming/:id", deleteIncomingWebhook)
+
+		admin.GET("/bots", listBots)
+		admin.POST("/bots", createBot)
+		admin.DELETE("/bots/:id", deleteBot(chatHub))
+		admin.GET("/commands", listCommands)
+
+		admin.GET("/audit", listAudit)
+	}
+}
+
+// reloadConfig re-reads the config file and reports what changed
+func reloadConfig(reloader Reloader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := logger.FromContext(c.Request.Context())
+		changes, err := reloader.Reload()
+		if err != nil {
+			log.Error("config reload failed", "operator", c.GetString("operator"), "error", err)
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		log.Info("config reloaded", "operator", c.GetString("operator"), "changes", len(changes))
+		audit.Record(audit.Entry{
+			Actor:   c.GetString("operator"),
+			Action:  "config.reload",
+			Details: map[string]string{"changes": strconv.Itoa(len(changes))},
+		})
+		if changes == nil {
+			changes = []string{}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"changes":          changes,
+			"restart_required": config.RestartRequired(changes),
+		})
+	}
+}
+
+// listConnections returns every registered connection, including those
+// waiting to resume
+func listConnections(chatHub AdminHub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"connections": chatHub.Snapshot().Connections,
+		})
+	}
+}
+
+// closeConnection force-disconnects one connection. The client may
+// reconnect; ban the user to keep them out.
+func closeConnection(chatHub AdminHub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if err := chatHub.CloseConnection(id); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		audit.Record(audit.Entry{
+			Actor:  c.GetString("operator"),
+			Action: "connection.close",
+			Target: id,
+		})
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// listRooms returns every room with its member and message counts
+func listRooms(chatHub AdminHub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"rooms": chatHub.Snapshot().Rooms,
+		})
+	}
+}
+
+// deleteRoom removes a room and its history
+func deleteRoom(chatHub AdminHub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if err := chatHub.DeleteRoom(id); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		audit.Record(audit.Entry{
+			Actor:  c.GetString("operator"),
+			Action: "room.delete",
+			Target: id,
+			Room:   id,
+		})
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// purgeMessages removes a room's history, or only one user's messages with
+// ?user_id=
+func purgeMessages(chatHub AdminHub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		userID := c.Query("user_id")
+		purged, err := chatHub.PurgeMessages(id, userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		audit.Record(audit.Entry{
+			Actor:   c.GetString("operator"),
+			Action:  "room.purge",
+			Target:  id,
+			UserID:  userID,
+			Room:    id,
+			Details: map[string]string{"purged": strconv.Itoa(purged)},
+		})
+		c.JSON(http.StatusOK, gin.H{
+			"purged": purged,
+		})
+	}
+}
+
+// createAnnouncement sends an announcement to every connected client, or to
+// one room when it is given. With a time or a repeat interval it is
+// scheduled instead.
+func createAnnouncement(chatHub AdminHub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Content string          `json:"content" binding:"required"`
+			Room    string          `json:"room"`
+			At      time.Time       `json:"at"`
+			Every   config.Duration `json:"every"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+		operator := c.GetString("operator")
+
+		if !req.At.IsZero() || req.Every != 0 {
+			scheduled, err := announce.Schedule.Add(announce.Announcement{
+				Content:   req.Content,
+				Room:      req.Room,
+				At:        req.At,
+				Every:     req.Every,
+				CreatedBy: operator,
+			})
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+
+			details := map[string]string{"at": scheduled.At.Format(time.RFC3339)}
+			if scheduled.Every != 0 {
+				details["every"] = scheduled.Every.String()
+			}
+			audit.Record(audit.Entry{
+				Actor:   operator,
+				Action:  "announcement.schedule",
+				Target:  scheduled.ID,
+				Room:    req.Room,
+				Details: details,
+			})
+			c.JSON(http.StatusCreated, gin.H{
+				"announcement": scheduled,
+			})
+			return
+		}
+
+		message := models.NewAnnouncement(req.Content, req.Room)
+		var err error
+		if req.Room != "" {
+			err = chatHub.Broadcast(message)
+		} else {
+			err = chatHub.Announce(message)
+		}
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		audit.Record(audit.Entry{
+			Actor:  operator,
+			Action: "server.announce",
+			Target: message.ID,
+			Room:   req.Room,
+		})
+		c.JSON(http.StatusOK, gin.H{
+			"id": message.ID,
+		})
+	}
+}
+
+// listAnnouncements returns the scheduled announcements, soonest first
+func listAnnouncements(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"announcements": announce.Schedule.List(),
+	})
+}
+
+// cancelAnnouncement removes a scheduled announcement
+func cancelAnnouncement(c *gin.Context) {
+	id := c.Param("id")
+	removed, err := announce.Schedule.Remove(id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Announcement not found",
+		})
+		return
+	}
+
+	audit.Record(audit.Entry{
+		Actor:  c.GetString("operator"),
+		Action: "announcement.cancel",
+		Target: id,
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// listWebhooks returns the registered webhooks without their secrets
+func listWebhooks(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": webhook.Hooks.List(),
+	})
+}
+
+// createWebhook registers an endpoint for room events. The response is the
+// only place its signing secret is shown.
+func createWebhook(c *gin.Context) {
+	var req struct {
+		URL    string   `json:"url" binding:"required"`
+		Secret string   `json:"secret"`
+		Rooms  []string `json:"rooms"`
+		Events []string `json:"events"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+		})
+		return
+	}
+
+	operator := c.GetString("operator")
+	hook, err := webhook.Hooks.Add(webhook.Hook{
+		URL:       req.URL,
+		Secret:    req.Secret,
+		Rooms:     req.Rooms,
+		Events:    req.Events,
+		CreatedBy: operator,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	audit.Record(audit.Entry{
+		Actor:   operator,
+		Action:  "webhook.create",
+		Target:  hook.ID,
+		Details: map[string]string{"url": hook.URL},
+	})
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": hook,
+	})
+}
+
+// deleteWebhook unregisters a webhook
+func deleteWebhook(c *gin.Context) {
+	id := c.Param("id")
+	removed, err := webhook.Hooks.Remove(id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Webhook not found",
+		})
+		return
+	}
+
+	audit.Record(audit.Entry{
+		Actor:  c.GetString("operator"),
+		Action: "webhook.delete",
+		Target: id,
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// listWebhookDeliveries returns a webhook's recent delivery attempts,
+// newest first
+func listWebhookDeliveries(c *gin.Context) {
+	deliveries, ok := webhook.Hooks.Deliveries(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Webhook not found",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+	})
+}
+
+// listDeadLetters returns the deliveries that ran out of attempts, newest
+// first
+func listDeadLetters(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"dead_letters": webhook.Hooks.DeadLetters(),
+	})
+}
+
+// retryDeadLetter queues a dead letter for delivery again
+func retryDeadLetter(c *gin.Context) {
+	id := c.Param("id")
+	if !webhook.Hooks.Retry(id) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Dead letter not found",
+		})
+		return
+	}
+
+	audit.Record(audit.Entry{
+		Actor:  c.GetString("operator"),
+		Action: "webhook.retry",
+		Target: id,
+	})
+	c.Status(http.StatusAccepted)
+}
+
+// listIncomingWebhooks returns the incoming webhooks without their tokens
+func listIncomingWebhooks(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": webhook.Inbound.List(),
+	})
+}
+
+// createIncomingWebhook creates a URL that posts into a room. The response is
+// the only place the URL's token is shown.
+func createIncomingWebhook(chatHub AdminHub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Room string `json:"room" binding:"required"`
+			Name string `json:"name" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "room and name are required",
+			})
+			return
+		}
+		if _, exists := chatHub.GetRooms()[req.Room]; !exists {
+			respondError(c, models.ErrRoomNotFound)
+			return
+		}
+
+		operator := c.GetString("operator")
+		in, err := webhook.Inbound.Add(webhook.Incoming{
+			Room:      req.Room,
+			Name:      req.Name,
+			CreatedBy: operator,
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		audit.Record(audit.Entry{
+			Actor:   operator,
+			Action:  "webhook.incoming.create",
+			Target:  in.ID,
+			Room:    in.Room,
+			Details: map[string]string{"name": in.Name},
+		})
+		c.JSON(http.StatusCreated, gin.H{
+			"webhook": in,
+			"url":     "/api/hooks/" + in.ID + "/" + in.Token,
+		})
+	}
+}
+
+// deleteIncomingWebhook removes an incoming webhook, invalidating its URL
+func deleteIncomingWebhook(c *gin.Context) {
+	id := c.Param("id")
+	removed, err := webhook.Inbound.Remove(id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Webhook not found",
+		})
+		return
+	}
+
+	audit.Record(audit.Entry{
+		Actor:  c.GetString("operator"),
+		Action: "webhook.incoming.delete",
+		Target: id,
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// listBots returns the bot accounts without their tokens
+func listBots(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"bots": bot.Accounts.List(),
+	})
+}
+
+// createBot creates a bot account. The response is the only place its token
+// is shown.
+func createBot(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "name is required",
+		})
+		return
+	}
+
+	operator := c.GetString("operator")
+	account, err := bot.Accounts.Add(bot.Account{
+		Name:      req.Name,
+		CreatedBy: operator,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	audit.Record(audit.Entry{
+		Actor:   operator,
+		Action:  "bot.create",
+		Target:  account.ID,
+		UserID:  account.UserID(),
+		Details: map[string]string{"name": account.Name},
+	})
+	c.JSON(http.StatusCreated, gin.H{
+		"bot":     account,
+		"user_id": account.UserID(),
+	})
+}
+
+// deleteBot removes a bot account, disconnecting the bot and dropping the
+// commands it registered
+func deleteBot(chatHub AdminHub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		removed, err := bot.Accounts.Remove(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if !removed {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Bot not found",
+			})
+			return
+		}
+
+		userID := bot.Account{ID: id}.UserID()
+		command.Commands.DropBot(userID)
+		if err := chatHub.Disconnect(userID); err != nil && !errors.Is(err, models.ErrUserNotFound) {
+			respondError(c, err)
+			return
+		}
+
+		audit.Record(audit.Entry{
+			Actor:  c.GetString("operator"),
+			Action: "bot.delete",
+			Target: id,
+			UserID: userID,
+		})
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// listCommands returns every registered slash command, built-in and bot
+func listCommands(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"commands": command.Commands.All(),
+	})
+}
+
+// listAudit returns audit log entries, oldest first. Entries can be
+// filtered by actor, user_id, room, action prefix and since (RFC 3339), and
+// limit bounds how many of the newest are returned.
+func listAudit(c *gin.Context) {
+	query := audit.Query{
+		Actor:  c.Query("actor"),
+		UserID: c.Query("user_id"),
+		Room:   c.Query("room"),
+		Action: c.Query("action"),
+		Limit:  100,
+	}
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "since must be an RFC 3339 time",
+			})
+			return
+		}
+		query.Since = t
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "limit must be between 1 and 1000",
+			})
+			return
+		}
+		query.Limit = n
+	}
+
+	entries, err := audit.Default.Entries(query)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to read audit log", "error", err)
+		respondError(c, err)
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+	})
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"chatstreamapp/internal/audit"
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/hub"
+	"chatstreamapp/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeAdminHub records the rooms the admin API deletes and purges. Methods a
+// test doesn't expect to be called panic through the nil embedded AdminHub.
+type fakeAdminHub struct {
+	AdminHub
+	deleted []string
+	purged  []string
+}
+
+func (h *fakeAdminHub) Snapshot() hub.Snapshot { return hub.Snapshot{} }
+
+func (h *fakeAdminHub) DeleteRoom(roomID string) error {
+	if roomID == "missing" {
+		return models.ErrRoomNotFound
+	}
+	h.deleted = append(h.deleted, roomID)
+	return nil
+}
+
+func (h *fakeAdminHub) PurgeMessages(roomID, userID string) (int, error) {
+	h.purged = append(h.purged, roomID+"/"+userID)
+	return 3, nil
+}
+
+// fakeReloader reports a fixed set of changes
+type fakeReloader struct {
+	changes []string
+}
+
+func (r fakeReloader) Reload() ([]string, error) { return r.changes, nil }
+
+// adminRouter serves the admin and moderation APIs with the given operators
+// configured, recording audit entries in a fresh log
+func adminRouter(t *testing.T, operators []config.Operator) (*gin.Engine, *fakeAdminHub) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Default()
+	cfg.Admin.Operators = operators
+	config.Set(cfg)
+	previous := audit.Default
+	audit.Default = &audit.Log{}
+	t.Cleanup(func() {
+		config.Set(config.Default())
+		audit.Default = previous
+	})
+
+	chatHub := &fakeAdminHub{}
+	router := gin.New()
+	SetupAdminRoutes(router, fakeReloader{changes: []string{"hub.max_room_history: 100 -> 50"}}, chatHub)
+	SetupModerationRoutes(router, chatHub)
+	return router, chatHub
+}
+
+func serve(router *gin.Engine, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequireOperator(t *testing.T) {
+	operators := []config.Operator{
+		{Name: "ops", Token: "admin-token"},
+		{Name: "mod", Token: "mod-token", Role: config.RoleModerator},
+	}
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+		error  string
+	}{
+		{"no token", "/api/admin/rooms", "", http.StatusUnauthorized, "Missing bearer token"},
+		{"wrong token", "/api/admin/rooms", "admin-token-2", http.StatusUnauthorized, "Invalid token"},
+		{"admin", "/api/admin/rooms", "admin-token", http.StatusOK, ""},
+		{"moderator on admin route", "/api/admin/rooms", "mod-token", http.StatusForbidden, "Operator role not allowed"},
+		{"moderator on moderation route", "/api/admin/moderation/sanctions", "mod-token", http.StatusOK, ""},
+		{"admin on moderation route", "/api/admin/moderation/sanctions", "admin-token", http.StatusOK, ""},
+		{"audit log needs an operator", "/api/admin/audit", "", http.StatusUnauthorized, "Missing bearer token"},
+	}
+	router, _ := adminRouter(t, operators)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.path, tt.token)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.error != "" && !strings.Contains(w.Body.String(), tt.error) {
+				t.Errorf("body = %s, want error %q", w.Body, tt.error)
+			}
+		})
+	}
+
+	// Without operators the whole API is off, whatever the token
+	router, _ = adminRouter(t, nil)
+	for _, path := range []string{"/api/admin/rooms", "/api/admin/moderation/sanctions"} {
+		w := serve(router, http.MethodGet, path, "admin-token")
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "Admin API is disabled") {
+			t.Errorf("%s without operators: %d %s, want 403 Admin API is disabled", path, w.Code, w.Body)
+		}
+	}
+}
+
+func TestAdminAudit(t *testing.T) {
+	router, chatHub := adminRouter(t, []config.Operator{{Name: "ops", Token: "admin-token"}})
+
+	for _, req := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodPost, "/api/admin/reload", http.StatusOK},
+		{http.MethodDelete, "/api/admin/rooms/dev", http.StatusNoContent},
+		{http.MethodDelete, "/api/admin/rooms/missing", http.StatusNotFound},
+		{http.MethodDelete, "/api/admin/rooms/general/messages?user_id=mallory", http.StatusOK},
+	} {
+		if w := serve(router, req.method, req.path, "admin-token"); w.Code != req.status {
+			t.Fatalf("%s %s = %d, want %d: %s", req.method, req.path, w.Code, req.status, w.Body)
+		}
+	}
+	if !reflect.DeepEqual(chatHub.deleted, []string{"dev"}) || !reflect.DeepEqual(chatHub.purged, []string{"general/mallory"}) {
+		t.Fatalf("deleted %v and purged %v", chatHub.deleted, chatHub.purged)
+	}
+
+	// Failed actions aren't audited
+	want := []audit.Entry{
+		{Actor: "ops", Action: "config.reload", Details: map[string]string{"changes": "1"}},
+		{Actor: "ops", Action: "room.delete", Target: "dev", Room: "dev"},
+		{Actor: "ops", Action: "room.purge", Target: "general", UserID: "mallory", Room: "general", Details: map[string]string{"purged": "3"}},
+	}
+	tests := []struct {
+		query string
+		want  []audit.Entry
+	}{
+		{"", want},
+		{"?action=room.", want[1:]},
+		{"?room=general", want[2:]},
+		{"?user_id=mallory", want[2:]},
+		{"?actor=someone-else", []audit.Entry{}},
+		{"?limit=1", want[2:]},
+	}
+	for _, tt := range tests {
+		w := serve(router, http.MethodGet, "/api/admin/audit"+tt.query, "admin-token")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET audit%s = %d: %s", tt.query, w.Code, w.Body)
+		}
+		var body struct {
+			Entries []audit.Entry `json:"entries"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		for i := range body.Entries {
+			if body.Entries[i].Time.IsZero() {
+				t.Errorf("audit%s: entry %d has no time", tt.query, i)
+			}
+			body.Entries[i].Time = tt.want[i].Time
+		}
+		if !reflect.DeepEqual(body.Entries, tt.want) {
+			t.Errorf("audit%s = %+v, want %+v", tt.query, body.Entries, tt.want)
+		}
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=1001", "?since=yesterday"} {
+		if w := serve(router, http.MethodGet, "/api/admin/audit"+query, "admin-token"); w.Code != http.StatusBadRequest {
+			t.Errorf("GET audit%s = %d, want 400", query, w.Code)
+		}
+	}
+}
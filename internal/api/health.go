@@ -0,0 +1,106 @@
+package api
+
+import (
+	"chatstreamapp/internal/health"
+	"chatstreamapp/internal/hub"
+	"context"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// A hub that can't answer within this long is considered dead
+	livenessTimeout = 5 * time.Second
+
+	// A hub that can't answer within this long shouldn't receive traffic
+	readinessTimeout = time.Second
+)
+
+// Monitor exposes the hub state needed by the probes and diagnostics
+type Monitor interface {
+	Ping(ctx context.Context) error
+	Snapshot() hub.Snapshot
+}
+
+// SetupHealthRoutes configures the orchestrator probes and the
+// admin-only diagnostics endpoints
+func SetupHealthRoutes(router *gin.Engine, monitor Monitor, checker *health.Checker) {
+	checker.AddCheck("hub", func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+		defer cancel()
+		return monitor.Ping(ctx)
+	})
+
+	router.GET("/healthz", healthz(monitor))
+	router.GET("/readyz", readyz(checker))
+
+	debug := router.Group("/debug", requireAdmin())
+	{
+		debug.GET("/hub", dumpHub(monitor))
+		debug.GET("/pprof/*name", profile)
+		debug.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	}
+}
+
+// healthz reports whether the process is alive, which requires the hub
+// event loop to still be processing events
+func healthz(monitor Monitor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), livenessTimeout)
+		defer cancel()
+
+		if err := monitor.Ping(ctx); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status": "hub not responding",
+				"error":  err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "ok",
+		})
+	}
+}
+
+// readyz reports whether the server should receive traffic
+func readyz(checker *health.Checker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		results, ready := checker.Run(c.Request.Context())
+
+		status := http.StatusOK
+		if !ready {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{
+			"ready":  ready,
+			"checks": results,
+		})
+	}
+}
+
+// dumpHub returns rooms, counts and send-queue depths
+func dumpHub(monitor Monitor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, monitor.Snapshot())
+	}
+}
+
+// profile serves the pprof index and named profiles
+func profile(c *gin.Context) {
+	switch c.Param("name") {
+	case "/cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "/profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "/symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "/trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Index(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/health"
+	"chatstreamapp/internal/hub"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// downMonitor is a hub whose event loop doesn't answer. Diagnostics aren't
+// expected and panic through the nil embedded Monitor.
+type downMonitor struct {
+	Monitor
+}
+
+func (downMonitor) Ping(context.Context) error { return errors.New("hub stopped") }
+
+// healthRouter serves the probes and diagnostics for a monitor
+func healthRouter(t *testing.T, monitor Monitor, operators []config.Operator) (*gin.Engine, *health.Checker) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Default()
+	cfg.Admin.Operators = operators
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	checker := health.NewChecker()
+	router := gin.New()
+	SetupHealthRoutes(router, monitor, checker)
+	return router, checker
+}
+
+func TestProbes(t *testing.T) {
+	running := hub.NewHub()
+	go running.Run()
+
+	tests := []struct {
+		name     string
+		monitor  Monitor
+		draining bool
+		healthz  int
+		readyz   int
+		failing  string
+	}{
+		{"hub running", running, false, http.StatusOK, http.StatusOK, ""},
+		{"hub down", downMonitor{}, false, http.StatusServiceUnavailable, http.StatusServiceUnavailable, "hub"},
+		// Draining stops traffic but the process is still alive
+		{"draining", running, true, http.StatusOK, http.StatusServiceUnavailable, "draining"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, checker := healthRouter(t, tt.monitor, nil)
+			if tt.draining {
+				checker.SetDraining()
+			}
+
+			if w := serve(router, http.MethodGet, "/healthz", ""); w.Code != tt.healthz {
+				t.Errorf("/healthz = %d, want %d: %s", w.Code, tt.healthz, w.Body)
+			}
+
+			w := serve(router, http.MethodGet, "/readyz", "")
+			if w.Code != tt.readyz {
+				t.Fatalf("/readyz = %d, want %d: %s", w.Code, tt.readyz, w.Body)
+			}
+			var body struct {
+				Ready  bool            `json:"ready"`
+				Checks []health.Result `json:"checks"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Ready != (tt.failing == "") {
+				t.Errorf("ready = %v with failing check %q", body.Ready, tt.failing)
+			}
+			for _, check := range body.Checks {
+				if check.OK != (check.Name != tt.failing) {
+					t.Errorf("check %+v, want only %q failing", check, tt.failing)
+				}
+			}
+		})
+	}
+}
+
+func TestDiagnosticsRequireAdmin(t *testing.T) {
+	operators := []config.Operator{
+		{Name: "ops", Token: "admin-token"},
+		{Name: "mod", Token: "mod-token", Role: config.RoleModerator},
+	}
+	running := hub.NewHub()
+	go running.Run()
+	// The loop creates the general room before answering its first ping
+	if err := running.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		operators []config.Operator
+		token     string
+		status    int
+		error     string
+	}{
+		{"no token", operators, "", http.StatusUnauthorized, "Missing bearer token"},
+		{"wrong token", operators, "guess", http.StatusUnauthorized, "Invalid token"},
+		{"moderator", operators, "mod-token", http.StatusForbidden, "Operator role not allowed"},
+		{"no operators configured", nil, "admin-token", http.StatusForbidden, "Admin API is disabled"},
+		{"admin", operators, "admin-token", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := healthRouter(t, running, tt.operators)
+
+			for _, path := range []string{"/debug/hub", "/debug/pprof/", "/debug/pprof/cmdline"} {
+				w := serve(router, http.MethodGet, path, tt.token)
+				if w.Code != tt.status {
+					t.Fatalf("%s = %d, want %d: %s", path, w.Code, tt.status, w.Body)
+				}
+				if tt.error != "" && !strings.Contains(w.Body.String(), tt.error) {
+					t.Errorf("%s body = %s, want error %q", path, w.Body, tt.error)
+				}
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			w := serve(router, http.MethodGet, "/debug/hub", tt.token)
+			var snapshot hub.Snapshot
+			if err := json.Unmarshal(w.Body.Bytes(), &snapshot); err != nil {
+				t.Fatal(err)
+			}
+			if len(snapshot.Rooms) == 0 || snapshot.Rooms[0].ID != "general" {
+				t.Errorf("snapshot rooms = %+v, want the general room", snapshot.Rooms)
+			}
+		})
+	}
+}
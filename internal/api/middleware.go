@@ -0,0 +1,235 @@
+package api
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/metrics"
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/ratelimit"
+	"chatstreamapp/internal/tracing"
+	"crypto/subtle"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the correlation ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID assigns each request a correlation ID, reusing the caller's
+// X-Request-ID when present, and stores a logger carrying it in the request
+// context for handlers and WebSocket connections
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.New().String()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Set(logger.RequestID, id)
+
+		log := logger.With(logger.RequestID, id)
+		c.Request = c.Request.WithContext(logger.NewContext(c.Request.Context(), log))
+		c.Next()
+	}
+}
+
+// Tracing starts a server span for each request, continuing the caller's
+// trace when a traceparent header is present
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := tracing.ContextWithRemoteParent(c.Request.Context(), c.GetHeader("traceparent"))
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx, span := tracing.Start(ctx, c.Request.Method+" "+route,
+			tracing.WithKind(tracing.SpanKindServer),
+			tracing.WithAttributes(
+				tracing.Attr("http.request.method", c.Request.Method),
+				tracing.Attr("http.route", route),
+				tracing.Attr(logger.RequestID, c.GetString(logger.RequestID)),
+			))
+		defer span.End()
+
+		if span != nil {
+			log := logger.FromContext(ctx).With("trace_id", span.SpanContext().TraceID().String())
+			ctx = logger.NewContext(ctx, log)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		span.SetAttributes(tracing.Attr("http.response.status_code", c.Writer.Status()))
+		if c.Writer.Status() >= 500 {
+			span.SetStatus(tracing.StatusError, http.StatusText(c.Writer.Status()))
+		}
+	}
+}
+
+// RequestLogger writes one structured event per completed request
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// The route, rather than the path, keeps secrets such as session
+		// and webhook tokens out of the logs
+		path := c.FullPath()
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		log := logger.FromContext(c.Request.Context())
+		args := []any{
+			"method", c.Request.Method,
+			"path", path,
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		}
+		switch {
+		case c.Writer.Status() >= 500:
+			log.Error("http request", args...)
+		case c.Writer.Status() >= 400:
+			log.Warning("http request", args...)
+		default:
+			log.Debug("http request", args...)
+		}
+	}
+}
+
+// CORS rejects requests from browser origins that aren't allowed and adds
+// cross-origin headers for those that are. Refusing outright, rather than
+// only withholding the headers, stops cross-site requests from having side
+// effects the browser would merely hide the response of.
+func CORS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.Get().CORS
+		origin := c.GetHeader("Origin")
+		if !cfg.AllowsOrigin(origin, c.Request.Host) {
+			logger.FromContext(c.Request.Context()).Warning("cross-origin request rejected", "origin", origin)
+			metrics.OriginRejections.WithLabelValues("http").Inc()
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Origin not allowed",
+			})
+			return
+		}
+
+		if origin != "" {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Vary", "Origin")
+			if cfg.AllowCredentials {
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, "+RequestIDHeader)
+
+		if c.Request.Method == "OPTIONS" {
+			c.Header("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Duration().Seconds())))
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Metrics records REST handler latency by route
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// RateLimit rejects requests over the limit for op with 429, keyed by client
+// IP. Handlers for requests made on behalf of a user may also call
+// ratelimit.Allow with the user ID.
+func RateLimit(op ratelimit.Op) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, retryAfter := ratelimit.Allow(op, "ip:"+c.ClientIP())
+		if ok {
+			c.Next()
+			return
+		}
+		abortRateLimited(c, retryAfter)
+	}
+}
+
+// abortRateLimited rejects a request with 429, telling the client when to
+// try again
+func abortRateLimited(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":          "Rate limit exceeded",
+		"code":           models.ErrorCodeRateLimited,
+		"retry_after_ms": retryAfter.Milliseconds(),
+	})
+}
+
+// requireAdmin rejects requests without the token of an operator with the
+// admin role
+func requireAdmin() gin.HandlerFunc {
+	return requireOperator(config.Operator.IsAdmin)
+}
+
+// requireModerator rejects requests without a valid operator token. Every
+// operator role may moderate.
+func requireModerator() gin.HandlerFunc {
+	return requireOperator(func(config.Operator) bool { return true })
+}
+
+// requireOperator rejects requests without a valid operator token, or whose
+// operator's role isn't allowed
+func requireOperator(allowed func(config.Operator) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		operators := config.Get().Admin.Operators
+		if len(operators) == 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Admin API is disabled",
+			})
+			return
+		}
+
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Missing bearer token",
+			})
+			return
+		}
+
+		for _, op := range operators {
+			if subtle.ConstantTimeCompare([]byte(op.Token), []byte(token)) == 1 {
+				if !allowed(op) {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+						"error": "Operator role not allowed",
+					})
+					return
+				}
+				c.Set("operator", op.Name)
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid token",
+		})
+	}
+}
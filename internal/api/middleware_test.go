@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bytes"
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/tracing"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Default()
+	cfg.CORS.AllowedOrigins = []string{"https://chat.example.com", "https://*.example.org"}
+	cfg.CORS.AllowCredentials = true
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	tests := []struct {
+		name   string
+		method string
+		origin string
+		status int
+		allow  string
+	}{
+		{"allowed", http.MethodGet, "https://chat.example.com", http.StatusOK, "https://chat.example.com"},
+		{"allowed subdomain", http.MethodGet, "https://app.example.org", http.StatusOK, "https://app.example.org"},
+		{"preflight", http.MethodOptions, "https://chat.example.com", http.StatusNoContent, "https://chat.example.com"},
+		{"no origin", http.MethodGet, "", http.StatusOK, ""},
+		{"disallowed", http.MethodGet, "https://evil.test", http.StatusForbidden, ""},
+		{"disallowed preflight", http.MethodOptions, "https://evil.test", http.StatusForbidden, ""},
+		{"suffix spoof", http.MethodGet, "https://evilexample.org", http.StatusForbidden, ""},
+		{"null", http.MethodGet, "null", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			router := gin.New()
+			router.Use(CORS())
+			router.Handle(tt.method, "/api/rooms", func(c *gin.Context) {
+				called = true
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, "http://api.example.com/api/rooms", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allow {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allow)
+			}
+			if tt.status == http.StatusForbidden {
+				if called {
+					t.Error("handler ran for a disallowed origin")
+				}
+				for name := range w.Header() {
+					if strings.HasPrefix(name, "Access-Control-Allow-") {
+						t.Errorf("disallowed origin got %s", name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRequestCorrelation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var out bytes.Buffer
+	if err := logger.SetOutput(&out, "json"); err != nil {
+		t.Fatal(err)
+	}
+	logger.SetLevel("debug")
+	tracer := tracing.New(tracetest.NewInMemoryExporter(), 1)
+	tracing.SetTracer(tracer)
+	t.Cleanup(func() {
+		logger.SetOutput(os.Stdout, "logfmt")
+		logger.SetLevel("info")
+		tracing.SetTracer(nil)
+		tracer.Shutdown(context.Background())
+	})
+
+	router := gin.New()
+	router.Use(RequestID(), Tracing(), RequestLogger())
+	router.GET("/api/rooms", func(c *gin.Context) {
+		logger.FromContext(c.Request.Context()).Info("handled")
+		c.Status(http.StatusOK)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := []struct {
+		name        string
+		requestID   string
+		traceParent string
+		keepsID     bool
+	}{
+		{"caller's ids", "req-42", "00-" + traceID + "-00f067aa0ba902b7-01", true},
+		{"generated ids", "", "", false},
+		{"oversized request id", strings.Repeat("x", 129), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/api/rooms", nil)
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			if tt.traceParent != "" {
+				req.Header.Set("traceparent", tt.traceParent)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			requestID := w.Header().Get(RequestIDHeader)
+			if requestID == "" || tt.keepsID != (requestID == tt.requestID) {
+				t.Errorf("%s = %q for a request sent with %q", RequestIDHeader, requestID, tt.requestID)
+			}
+
+			// Both the handler's event and the access log carry the ids
+			var traceIDs []string
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				var event map[string]any
+				if err := json.Unmarshal([]byte(line), &event); err != nil {
+					t.Fatalf("event %q: %v", line, err)
+				}
+				if event[logger.RequestID] != requestID {
+					t.Errorf("%q event has request_id %v, want %q", event["msg"], event[logger.RequestID], requestID)
+				}
+				id, _ := event["trace_id"].(string)
+				if len(id) != 32 {
+					t.Errorf("%q event has trace_id %v", event["msg"], event["trace_id"])
+				}
+				traceIDs = append(traceIDs, id)
+			}
+			if len(traceIDs) != 2 {
+				t.Fatalf("got %d events, want the handler's and the access log", len(traceIDs))
+			}
+			if tt.traceParent != "" && traceIDs[0] != traceID {
+				t.Errorf("trace_id = %s, want the caller's %s", traceIDs[0], traceID)
+			}
+		})
+	}
+}
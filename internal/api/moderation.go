@@ -0,0 +1,146 @@
+package api
+
+import (
+	"chatstreamapp/internal/audit"
+	"chatstreamapp/internal/client"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/moderation"
+	"chatstreamapp/internal/protocol"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupModerationRoutes configures the operator API for reviewing held
+// messages and muting, kicking and banning users
+func SetupModerationRoutes(router *gin.Engine, hub Hub) {
+	review := router.Group("/api/admin/moderation", requireModerator())
+	{
+		review.GET("/held", listHeld)
+		review.POST("/held/:id/approve", approveHeld(hub))
+		review.POST("/held/:id/discard", discardHeld)
+
+		review.GET("/sanctions", listSanctions)
+		for _, op := range []string{protocol.OpMute, protocol.OpUnmute, protocol.OpKick, protocol.OpBan, protocol.OpUnban} {
+			review.POST("/"+op, moderate(hub, op))
+		}
+	}
+}
+
+// listSanctions returns the mutes and bans in force
+func listSanctions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"sanctions": moderation.Sanctions.List(),
+	})
+}
+
+// moderate runs a moderator operation on behalf of the operator. The body is
+// the same as the operation's WebSocket payload.
+func moderate(hub Hub, op string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req protocol.Moderate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		operator := c.GetString("operator")
+		if err := client.Moderate(hub, operator, operator, op, &req); err != nil {
+			respondError(c, err)
+			return
+		}
+		logger.FromContext(c.Request.Context()).Info("moderator action", "operator", operator, "op", op, "target_id", req.UserID, logger.RoomID, req.Room)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// listHeld returns the messages waiting for review, oldest first
+func listHeld(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"held": moderation.Review.List(),
+	})
+}
+
+// approveHeld delivers a held message as if it had just been sent
+func approveHeld(hub Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		held, ok := takeHeld(c)
+		if !ok {
+			return
+		}
+		message := held.Message
+		operator := c.GetString("operator")
+
+		audit.Record(audit.Entry{
+			Actor:  operator,
+			Action: "message.approve",
+			Target: message.ID,
+			UserID: message.SenderID,
+			Room:   message.Room,
+			Reason: held.Reason,
+		})
+
+		var err error
+		if message.Room != "" {
+			err = hub.Broadcast(message)
+		} else {
+			err = hub.SendToUser(message.Recipient, message)
+			if sender, ok := hub.GetUsers()[message.SenderID]; ok && err == nil {
+				sender.SendMessage(message)
+			}
+		}
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Warning("approved message could not be delivered",
+				"operator", operator, "message_id", message.ID, "error", err)
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Message delivered",
+			"id":      message.ID,
+		})
+	}
+}
+
+// discardHeld drops a held message without delivering it
+func discardHeld(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	// The body is optional
+	_ = c.ShouldBindJSON(&req)
+
+	held, ok := takeHeld(c)
+	if !ok {
+		return
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = held.Reason
+	}
+	audit.Record(audit.Entry{
+		Actor:  c.GetString("operator"),
+		Action: "message.discard",
+		Target: held.Message.ID,
+		UserID: held.Message.SenderID,
+		Room:   held.Message.Room,
+		Reason: reason,
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// takeHeld removes the held message named in the path from the review
+// queue, responding 404 if it isn't there
+func takeHeld(c *gin.Context) (*moderation.HeldMessage, bool) {
+	held, ok := moderation.Review.Take(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Held message not found",
+		})
+	}
+	return held, ok
+}
@@ -1,8 +1,23 @@
 package api
 
 import (
+	"chatstreamapp/internal/bot"
 	"chatstreamapp/internal/client"
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/markdown"
+	"chatstreamapp/internal/metrics"
+	"chatstreamapp/internal/moderation"
+	"chatstreamapp/internal/privacy"
+	"chatstreamapp/internal/protocol"
+	"chatstreamapp/internal/ratelimit"
+	"chatstreamapp/internal/tracing"
 	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/webhook"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -12,19 +27,29 @@ import (
 
 // Hub interface for API handlers
 type Hub interface {
-	Register(client *client.Client)
-	Unregister(client *client.Client)
-	Broadcast(message *models.Message)
-	SendToUser(userID string, message *models.Message)
-	JoinRoom(client *client.Client, roomID string)
-	LeaveRoom(client *client.Client, roomID string)
+	Register(conn client.Connection)
+	Unregister(conn client.Connection)
+	Detach(conn client.Connection)
+	Resume(token, userID string, lastSeq uint64) client.Connection
+	Broadcast(message *models.Message) error
+	SendToUser(userID string, message *models.Message) error
+	SendEphemeral(userID, connectionID string, message *models.Message) error
+	JoinRoom(conn client.Connection, roomID string) error
+	LeaveRoom(conn client.Connection, roomID string) error
+	Kick(userID, roomID string) error
+	Disconnect(userID string) error
+	SetTopic(roomID, topic string) error
+	IsMember(roomID, userID string) (bool, error)
 	GetRooms() map[string]*models.Room
-	GetUsers() map[string]*client.Client
-	CreateRoom(name string) *models.Room
+	GetUsers() map[string]client.Connection
+	CreateRoom(name, topic, visibility string) *models.Room
 }
 
 // SetupRoutes configures all API routes
 func SetupRoutes(router *gin.Engine, hub Hub) {
+	// Prometheus scrape endpoint
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
 	api := router.Group("/api")
 	{
 		// WebSocket endpoint
@@ -34,14 +59,20 @@ func SetupRoutes(router *gin.Engine, hub Hub) {
 
 		// REST endpoints
 		api.GET("/rooms", getRooms(hub))
-		api.POST("/rooms", createRoom(hub))
+		api.POST("/rooms", RateLimit(ratelimit.OpRoomCreation), createRoom(hub))
 		api.GET("/rooms/:id/messages", getRoomMessages(hub))
 		api.GET("/users", getUsers(hub))
-		api.POST("/messages", sendMessage(hub))
+		api.POST("/messages", RateLimit(ratelimit.OpMessages), sendMessage(hub))
+		api.POST("/hooks/:id/:token", postIncomingWebhook(hub))
+
+		// JSON Schema of the WebSocket protocol
+		api.GET("/protocol/schema", func(c *gin.Context) {
+			c.JSON(http.StatusOK, protocol.Schema())
+		})
 	}
 }
 
-// getRooms returns all available rooms
+// getRooms returns all public rooms
 func getRooms(hub Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		rooms := hub.GetRooms()
@@ -49,9 +80,14 @@ func getRooms(hub Hub) gin.HandlerFunc {
 		// Convert to response format
 		response := make([]gin.H, 0, len(rooms))
 		for _, room := range rooms {
+			if room.Visibility == models.RoomPrivate {
+				continue
+			}
 			response = append(response, gin.H{
 				"id":         room.ID,
 				"name":       room.Name,
+				"topic":      room.Topic,
+				"visibility": room.Visibility,
 				"user_count": len(room.Users),
 				"created_at": room.CreatedAt,
 			})
@@ -67,7 +103,9 @@ func getRooms(hub Hub) gin.HandlerFunc {
 func createRoom(hub Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
-			Name string `json:"name" binding:"required"`
+			Name       string `json:"name" binding:"required"`
+			Topic      string `json:"topic"`
+			Visibility string `json:"visibility"`
 		}
 		
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -76,13 +114,21 @@ func createRoom(hub Hub) gin.HandlerFunc {
 			})
 			return
 		}
+		if req.Visibility != "" && !models.ValidVisibility(req.Visibility) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Visibility must be public or private",
+			})
+			return
+		}
 		
-		room := hub.CreateRoom(req.Name)
+		room := hub.CreateRoom(req.Name, req.Topic, req.Visibility)
 		
 		c.JSON(http.StatusCreated, gin.H{
 			"room": gin.H{
 				"id":         room.ID,
 				"name":       room.Name,
+				"topic":      room.Topic,
+				"visibility": room.Visibility,
 				"user_count": 0,
 				"created_at": room.CreatedAt,
 			},
@@ -110,7 +156,7 @@ func getRoomMessages(hub Hub) gin.HandlerFunc {
 	}
 }
 
-// getUsers returns all connected users
+// getUsers returns the connected users, except those who chose to be hidden
 func getUsers(hub Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		users := hub.GetUsers()
@@ -119,6 +165,9 @@ func getUsers(hub Hub) gin.HandlerFunc {
 		response := make([]gin.H, 0, len(users))
 		for _, client := range users {
 			user := client.GetUser()
+			if privacy.Users.Hidden(user.ID) {
+				continue
+			}
 			response = append(response, gin.H{
 				"id":       user.ID,
 				"username": user.Username,
@@ -132,6 +181,44 @@ func getUsers(hub Hub) gin.HandlerFunc {
 	}
 }
 
+// respondError writes a hub error as a JSON response with its error code
+func respondError(c *gin.Context, err error) {
+	var coded *models.CodedError
+	if !errors.As(err, &coded) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Internal error",
+			"code":  models.ErrorCodeInternal,
+		})
+		return
+	}
+
+	c.JSON(errorStatus(coded.Code), gin.H{
+		"error": coded.Message,
+		"code":  coded.Code,
+	})
+}
+
+// errorStatus maps an error code to its HTTP status
+func errorStatus(code string) int {
+	switch code {
+	case models.ErrorCodeRoomNotFound, models.ErrorCodeUserNotFound, models.ErrorCodeConnectionNotFound:
+		return http.StatusNotFound
+	case models.ErrorCodeNotMember, models.ErrorCodeUnauthorized, models.ErrorCodeBanned, models.ErrorCodeMuted, models.ErrorCodeDMNotAllowed:
+		return http.StatusForbidden
+	case models.ErrorCodePayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case models.ErrorCodeRateLimited:
+		return http.StatusTooManyRequests
+	case models.ErrorCodeMessageHeld:
+		return http.StatusAccepted
+	case models.ErrorCodeMessageRejected:
+		return http.StatusUnprocessableEntity
+	case models.ErrorCodeInternal:
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
 // sendMessage sends a message via REST API (alternative to WebSocket)
 func sendMessage(hub Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -142,6 +229,7 @@ func sendMessage(hub Hub) gin.HandlerFunc {
 			SenderID  string `json:"sender_id" binding:"required"`
 			Room      string `json:"room,omitempty"`
 			Recipient string `json:"recipient,omitempty"`
+			Format    string `json:"format,omitempty"`
 		}
 		
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -150,6 +238,31 @@ func sendMessage(hub Hub) gin.HandlerFunc {
 			})
 			return
 		}
+
+		// Only chat messages can be sent; every other type comes from the
+		// server itself
+		if t := models.MessageType(req.Type); t != models.MessageTypeText && t != models.MessageTypePrivate {
+			respondError(c, &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: "type must be text or private"})
+			return
+		}
+
+		// Bots and integrations post with their own credentials
+		if bot.Reserved(req.SenderID) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "This sender_id is reserved for bots and integrations",
+				"code":  models.ErrorCodeUnauthorized,
+			})
+			return
+		}
+
+		// Also limited per user like messages sent over WebSocket, so one
+		// sender can't go faster by spreading requests over several IPs.
+		// The per-IP limit on the route bounds how many sender IDs one
+		// client can try.
+		if ok, retryAfter := ratelimit.Allow(ratelimit.OpMessages, req.SenderID); !ok {
+			abortRateLimited(c, retryAfter)
+			return
+		}
 		
 		message := &models.Message{
 			ID:        uuid.New().String(),
@@ -159,22 +272,41 @@ func sendMessage(hub Hub) gin.HandlerFunc {
 			SenderID:  req.SenderID,
 			Room:      req.Room,
 			Recipient: req.Recipient,
+			Format:    req.Format,
 			Timestamp: time.Now(),
 		}
+		message.TraceParent = tracing.SpanFromContext(c.Request.Context()).TraceParent()
 		
-		if req.Room != "" {
-			// Group message
-			hub.Broadcast(message)
-		} else if req.Recipient != "" {
-			// Private message
-			message.Type = models.MessageTypePrivate
-			hub.SendToUser(req.Recipient, message)
-		} else {
+		if req.Room == "" && req.Recipient == "" {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "Either room or recipient must be specified",
 			})
 			return
 		}
+		if req.Room == "" {
+			message.Type = models.MessageTypePrivate
+		}
+		if err := markdown.Validate(req.Format, req.Content); err != nil {
+			respondError(c, err)
+			return
+		}
+		if err := moderation.Apply(message); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		var err error
+		if req.Room != "" {
+			// Group message
+			err = hub.Broadcast(message)
+		} else {
+			// Private message
+			err = hub.SendToUser(req.Recipient, message)
+		}
+		if err != nil {
+			respondError(c, err)
+			return
+		}
 		
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Message sent successfully",
@@ -182,3 +314,64 @@ func sendMessage(hub Hub) gin.HandlerFunc {
 		})
 	}
 }
+
+// postIncomingWebhook posts a message into an incoming webhook's room,
+// sent by the webhook's bot identity rather than a user
+func postIncomingWebhook(hub Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		in, ok := webhook.Inbound.Authenticate(c.Param("id"), c.Param("token"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Webhook not found",
+			})
+			return
+		}
+		if ok, retryAfter := ratelimit.Allow(ratelimit.OpIncomingWebhooks, in.ID); !ok {
+			abortRateLimited(c, retryAfter)
+			return
+		}
+
+		limit := config.Get().Webhooks.MaxIncomingBytes
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Failed to read request body",
+			})
+			return
+		}
+		if int64(len(data)) > limit {
+			respondError(c, &models.CodedError{
+				Code:    models.ErrorCodePayloadTooLarge,
+				Message: fmt.Sprintf("Body exceeds %d bytes", limit),
+			})
+			return
+		}
+		var post webhook.Post
+		if err := json.Unmarshal(data, &post); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+
+		message, err := in.Message(post)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		message.TraceParent = tracing.SpanFromContext(c.Request.Context()).TraceParent()
+		if err := moderation.Apply(message); err != nil {
+			respondError(c, err)
+			return
+		}
+		if err := hub.Broadcast(message); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		logger.FromContext(c.Request.Context()).Info("incoming webhook posted", "webhook_id", in.ID, logger.RoomID, in.Room)
+		c.JSON(http.StatusOK, gin.H{
+			"id": message.ID,
+		})
+	}
+}
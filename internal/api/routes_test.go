@@ -0,0 +1,114 @@
+package api
+
+import (
+	"chatstreamapp/internal/client"
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeHub records the messages handlers send. Methods a test doesn't expect
+// to be called panic through the nil embedded Hub.
+type fakeHub struct {
+	Hub
+	sent  []*models.Message
+	conns []client.Connection
+}
+
+func (h *fakeHub) Broadcast(message *models.Message) error {
+	h.sent = append(h.sent, message)
+	return nil
+}
+
+func (h *fakeHub) SendToUser(userID string, message *models.Message) error {
+	h.sent = append(h.sent, message)
+	return nil
+}
+
+func TestSendMessageRejectsImpersonation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"text", `{"type":"text","content":"hi","sender":"alice","sender_id":"alice","room":"general"}`, http.StatusOK},
+		{"private", `{"type":"private","content":"hi","sender":"alice","sender_id":"alice","recipient":"bob"}`, http.StatusOK},
+		{"announcement", `{"type":"announcement","content":"hi","sender":"alice","sender_id":"alice","room":"general"}`, http.StatusBadRequest},
+		{"command", `{"type":"command","content":"hi","sender":"alice","sender_id":"alice","room":"general"}`, http.StatusBadRequest},
+		{"system", `{"type":"system","content":"hi","sender":"System","sender_id":"alice","room":"general"}`, http.StatusBadRequest},
+		{"bot sender", `{"type":"text","content":"hi","sender":"helper","sender_id":"bot:1234","room":"general"}`, http.StatusForbidden},
+		{"webhook sender", `{"type":"text","content":"hi","sender":"ci","sender_id":"webhook:1234","room":"general"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := &fakeHub{}
+			router := gin.New()
+			router.POST("/api/messages", sendMessage(hub))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/messages", strings.NewReader(tt.body))
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if sent := len(hub.sent) > 0; sent != (tt.status == http.StatusOK) {
+				t.Fatalf("message sent = %v, want %v", sent, tt.status == http.StatusOK)
+			}
+		})
+	}
+}
+
+func (h *fakeHub) Register(conn client.Connection) {
+	h.conns = append(h.conns, conn)
+}
+
+func (h *fakeHub) Unregister(conn client.Connection) {}
+
+func TestSendMessageRateLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Default()
+	cfg.RateLimit.Messages = config.RateLimit{Rate: 0.001, Burst: 2}
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	router := gin.New()
+	router.POST("/api/messages", RateLimit(ratelimit.OpMessages), sendMessage(&fakeHub{}))
+
+	tests := []struct {
+		name     string
+		ip       string
+		senderID string
+		status   int
+	}{
+		{"first sender", "198.51.100.1", "ratelimit-alice", http.StatusOK},
+		{"same sender, new IP", "198.51.100.2", "ratelimit-alice", http.StatusOK},
+		{"sender bucket empty", "198.51.100.3", "ratelimit-alice", http.StatusTooManyRequests},
+		// One IP rotating sender IDs still runs out
+		{"rotated sender", "198.51.100.1", "ratelimit-bob", http.StatusOK},
+		{"IP bucket empty", "198.51.100.1", "ratelimit-carol", http.StatusTooManyRequests},
+		{"another rotated sender", "198.51.100.1", "ratelimit-dave", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		body := `{"type":"text","content":"hi","sender":"user","sender_id":"` + tt.senderID + `","room":"general"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/messages", strings.NewReader(body))
+		req.RemoteAddr = tt.ip + ":1234"
+		router.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+		}
+		if tt.status == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: missing Retry-After", tt.name)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package api
+
+import (
+	"chatstreamapp/internal/bot"
+	"chatstreamapp/internal/client"
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/moderation"
+	"chatstreamapp/internal/protocol"
+	"chatstreamapp/internal/ratelimit"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How often idle sessions are looked for
+const sessionSweepInterval = 5 * time.Second
+
+// The fallback transports speak the v1 JSON envelope
+var envelopes, _ = protocol.ForSubprotocol(protocol.V1)
+
+// session is a client connected over SSE or long polling instead of a
+// WebSocket. Events queue in Send until a stream or poll drains them;
+// requests arrive as HTTP POSTs.
+type session struct {
+	*client.Base
+
+	// Secret the client names the session with in URLs. Base.ID appears in
+	// logs and diagnostics, so it can't double as one.
+	secret string
+
+	mu        sync.Mutex
+	transport string    // "sse" or "poll", whichever attached last
+	attached  bool      // a stream or poll is reading Send
+	lastSeen  time.Time // when the last stream or poll ended
+
+	// Closed when the session ends
+	done chan struct{}
+}
+
+// Transport implements client.Connection
+func (s *session) Transport() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transport
+}
+
+// attach claims Send for one reader, reporting false if another stream or
+// poll already holds it
+func (s *session) attach(transport string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.attached {
+		return false
+	}
+	s.attached = true
+	s.transport = transport
+	return true
+}
+
+func (s *session) detach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attached = false
+	s.lastSeen = time.Now()
+}
+
+// idle reports whether nothing has read from the session for longer than timeout
+func (s *session) idle(timeout time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.attached && time.Since(s.lastSeen) > timeout
+}
+
+// Sessions tracks the clients connected through the SSE and long-polling
+// transports. Each session is registered with the hub like a WebSocket
+// client, so it gets the same rooms, history and private messages.
+type Sessions struct {
+	hub Hub
+
+	mu       sync.Mutex
+	bySecret map[string]*session
+
+	// Closed on shutdown to end open streams and polls
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+// NewSessions creates an empty session registry
+func NewSessions(hub Hub) *Sessions {
+	return &Sessions{
+		hub:      hub,
+		bySecret: make(map[string]*session),
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Run disconnects sessions that nothing has read from within the session
+// timeout. It returns after Close.
+func (s *Sessions) Run() {
+	ticker := time.NewTicker(sessionSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			timeout := config.Get().Fallback.SessionTimeout.Duration()
+			s.mu.Lock()
+			var expired []*session
+			for _, sess := range s.bySecret {
+				if sess.idle(timeout) {
+					expired = append(expired, sess)
+				}
+			}
+			s.mu.Unlock()
+
+			for _, sess := range expired {
+				sess.Logger().Info("session expired")
+				s.remove(sess)
+			}
+		case <-s.shutdown:
+			return
+		}
+	}
+}
+
+// Close ends open streams and polls so the server can shut down
+func (s *Sessions) Close() {
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+}
+
+// SetupSessionRoutes configures the SSE and long-polling transports
+func SetupSessionRoutes(router *gin.Engine, sessions *Sessions) {
+	group := router.Group("/api/sessions")
+	{
+		group.POST("", sessions.create)
+		group.DELETE("/:id", sessions.delete)
+		group.GET("/:id/events", sessions.stream)
+		group.GET("/:id/poll", sessions.poll)
+		group.POST("/:id/frames", sessions.frame)
+	}
+}
+
+// create registers a new session with the hub
+func (s *Sessions) create(c *gin.Context) {
+	var req struct {
+		UserID   string `json:"user_id" binding:"required"`
+		Username string `json:"username" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "user_id and username are required",
+		})
+		return
+	}
+
+	// Bots connect over WebSocket with their token
+	if bot.Reserved(req.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "This user_id is reserved for bots and integrations",
+			"code":  models.ErrorCodeUnauthorized,
+		})
+		return
+	}
+
+	if ban := moderation.Sanctions.Find(moderation.Ban, req.UserID, ""); ban != nil {
+		respondError(c, ban.Err())
+		return
+	}
+
+	user := &models.User{
+		ID:       req.UserID,
+		Username: req.Username,
+	}
+	base := client.NewBase(user, logger.FromContext(c.Request.Context()))
+	sess := &session{
+		Base:      base,
+		secret:    client.NewToken(),
+		transport: "http",
+		lastSeen:  time.Now(),
+		done:      make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.bySecret[sess.secret] = sess
+	s.mu.Unlock()
+
+	sess.Logger().Info("session created", "username", user.Username, "remote_addr", c.Request.RemoteAddr)
+	s.hub.Register(sess)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"session_id": sess.secret,
+	})
+}
+
+// delete disconnects a session
+func (s *Sessions) delete(c *gin.Context) {
+	sess, ok := s.lookup(c)
+	if !ok {
+		return
+	}
+	sess.Logger().Info("session closed by client")
+	s.remove(sess)
+	c.Status(http.StatusNoContent)
+}
+
+// stream sends events as Server-Sent Events, one v1 envelope per event,
+// until the client goes away
+func (s *Sessions) stream(c *gin.Context) {
+	sess, ok := s.attach(c, "sse")
+	if !ok {
+		return
+	}
+	defer sess.detach()
+
+	// EventSource sends the ID of the last event it got when it reconnects
+	if !s.rewind(sess, c.GetHeader("Last-Event-ID")) {
+		c.JSON(http.StatusGone, gin.H{
+			"error": "Events after Last-Event-ID are no longer buffered",
+		})
+		return
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// Stop nginx from buffering the stream
+	header.Set("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(http.StatusOK)
+	c.Writer.Flush()
+
+	keepalive := config.Get().Fallback.KeepAlive.Duration()
+	ticker := time.NewTicker(keepalive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message, ok := <-sess.Send:
+			if !ok {
+				// Too slow to keep up
+				s.remove(sess)
+				return
+			}
+			data, err := envelopes.Encode(message)
+			if err != nil {
+				sess.Logger().Error("failed to encode event", "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(c.Writer, "id: %d\ndata: %s\n\n", message.Seq, data); err != nil {
+				// Queue the event again for the next stream or poll
+				s.rewind(sess, strconv.FormatUint(message.Seq-1, 10))
+				return
+			}
+			c.Writer.Flush()
+
+		case <-ticker.C:
+			if period := config.Get().Fallback.KeepAlive.Duration(); period != keepalive {
+				keepalive = period
+				ticker.Reset(keepalive)
+			}
+			if _, err := io.WriteString(c.Writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-c.Request.Context().Done():
+			return
+		case <-sess.done:
+			return
+		case <-s.shutdown:
+			return
+		}
+	}
+}
+
+// poll waits for events and returns everything queued as one batch frame.
+// The batch is empty when the poll timeout passes first.
+func (s *Sessions) poll(c *gin.Context) {
+	sess, ok := s.attach(c, "poll")
+	if !ok {
+		return
+	}
+	defer sess.detach()
+
+	// Everything after last_seq is sent again, so a client whose last poll
+	// failed gets what it missed
+	if !s.rewind(sess, c.Query("last_seq")) {
+		c.JSON(http.StatusGone, gin.H{
+			"error": "Events after last_seq are no longer buffered",
+		})
+		return
+	}
+
+	timer := time.NewTimer(config.Get().Fallback.PollTimeout.Duration())
+	defer timer.Stop()
+
+	var messages []*models.Message
+	select {
+	case message, ok := <-sess.Send:
+		if !ok {
+			s.remove(sess)
+			c.JSON(http.StatusGone, gin.H{
+				"error": "Session closed",
+			})
+			return
+		}
+		messages = append(messages, message)
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+		return
+	case <-sess.done:
+	case <-s.shutdown:
+	}
+
+	// Take whatever else is already queued
+drain:
+	for {
+		select {
+		case message, ok := <-sess.Send:
+			if !ok {
+				// Deliver what was read; the next poll reports the closed session
+				break drain
+			}
+			messages = append(messages, message)
+		default:
+			break drain
+		}
+	}
+
+	data, err := envelopes.(protocol.BatchEncoder).EncodeBatch(messages)
+	if err == nil && c.Request.Context().Err() != nil {
+		err = c.Request.Context().Err()
+	}
+	if err == nil {
+		c.Header("Content-Type", "application/json")
+		c.Status(http.StatusOK)
+		_, err = c.Writer.Write(data)
+	}
+	if err != nil && len(messages) > 0 {
+		// Queue the events again for the next poll
+		s.rewind(sess, strconv.FormatUint(messages[0].Seq-1, 10))
+	}
+	if err != nil && !c.Writer.Written() {
+		respondError(c, err)
+	}
+}
+
+// rewind queues again every event after lastSeq, the sequence number of the
+// last event the client got. It does nothing when lastSeq is empty and
+// reports false when those events are no longer buffered. The session must
+// be attached, so nothing else reads its queue.
+func (s *Sessions) rewind(sess *session, lastSeq string) bool {
+	if lastSeq == "" {
+		return true
+	}
+	seq, err := strconv.ParseUint(lastSeq, 10, 64)
+	if err != nil || !sess.Rewind(seq) {
+		sess.Logger().Info("session events lost", "last_seq", lastSeq)
+		return false
+	}
+	return true
+}
+
+// frame handles one request envelope and replies with its ack or error frame
+func (s *Sessions) frame(c *gin.Context) {
+	sess, ok := s.lookup(c)
+	if !ok {
+		return
+	}
+
+	limit := config.Get().WebSocket.MaxMessageSize
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Failed to read request body",
+		})
+		return
+	}
+	if int64(len(data)) > limit {
+		s.reply(c, sess, "", &models.CodedError{
+			Code:    models.ErrorCodePayloadTooLarge,
+			Message: fmt.Sprintf("Message exceeds %d bytes", limit),
+		})
+		return
+	}
+
+	req, err := envelopes.Decode(data)
+	if err != nil {
+		var requestID string
+		if req != nil {
+			requestID = req.RequestID
+		}
+		s.reply(c, sess, requestID, err)
+		return
+	}
+
+	id, err := client.Handle(s.hub, sess, req)
+	if err != nil {
+		s.reply(c, sess, req.RequestID, err)
+		return
+	}
+	data, _ = envelopes.Encode(models.NewAck(req.RequestID, id))
+	c.Data(http.StatusOK, "application/json", data)
+}
+
+// reply writes the error frame of a failed request with a matching status
+func (s *Sessions) reply(c *gin.Context, sess *session, requestID string, err error) {
+	message := client.ErrorReply(sess, requestID, err)
+
+	var coded *models.CodedError
+	if errors.As(err, &coded) && coded.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(coded.RetryAfter.Seconds()))))
+	}
+	data, _ := envelopes.Encode(message)
+	c.Data(errorStatus(message.Error.Code), "application/json", data)
+}
+
+// lookup finds the session named in the path, responding 404 if it is gone
+func (s *Sessions) lookup(c *gin.Context) (*session, bool) {
+	s.mu.Lock()
+	sess, ok := s.bySecret[c.Param("id")]
+	s.mu.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Session not found",
+		})
+	}
+	return sess, ok
+}
+
+// attach finds the session and claims it for a stream or poll
+func (s *Sessions) attach(c *gin.Context, transport string) (*session, bool) {
+	sess, ok := s.lookup(c)
+	if !ok {
+		return nil, false
+	}
+	if !sess.attach(transport) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Session already has an open stream or poll",
+		})
+		return nil, false
+	}
+	return sess, true
+}
+
+// remove unregisters a session from the hub. It is safe to call more than once.
+func (s *Sessions) remove(sess *session) {
+	s.mu.Lock()
+	_, ok := s.bySecret[sess.secret]
+	delete(s.bySecret, sess.secret)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	close(sess.done)
+	s.hub.Unregister(sess)
+	ratelimit.Default.Forget(ratelimit.OpFrames, sess.ID)
+}
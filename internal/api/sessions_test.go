@@ -0,0 +1,136 @@
+package api
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestSession creates a session through the API, returning the routes,
+// the session's secret and its connection
+func newTestSession(t *testing.T) (http.Handler, string, *session) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Default()
+	cfg.Fallback.PollTimeout = config.Duration(10 * time.Millisecond)
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	hub := &fakeHub{}
+	router := gin.New()
+	SetupSessionRoutes(router, NewSessions(hub))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/sessions", strings.NewReader(`{"user_id":"alice","username":"alice"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create session: status %d: %s", w.Code, w.Body)
+	}
+	var created struct {
+		SessionID string `json:"session_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	return router, created.SessionID, hub.conns[0].(*session)
+}
+
+// poll long-polls the session and returns the sequence numbers it got
+func poll(t *testing.T, router http.Handler, path string) []uint64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d: %s", path, w.Code, w.Body)
+	}
+	var batch struct {
+		Payload []struct {
+			Seq uint64 `json:"seq"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &batch); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	var seqs []uint64
+	for _, env := range batch.Payload {
+		seqs = append(seqs, env.Seq)
+	}
+	return seqs
+}
+
+func queue(sess *session, contents ...string) {
+	for _, content := range contents {
+		sess.SendMessage(&models.Message{Type: models.MessageTypeText, Content: content, Room: "general"})
+	}
+}
+
+func TestSessionSecretIsNotConnectionID(t *testing.T) {
+	router, secret, sess := newTestSession(t)
+
+	if secret == "" || secret == sess.ID {
+		t.Fatalf("session_id %q must be a secret distinct from the connection ID %q", secret, sess.ID)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/sessions/"+sess.ID+"/poll", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("poll by connection ID: status %d, want 404", w.Code)
+	}
+}
+
+func TestPollReplaysAfterLastSeq(t *testing.T) {
+	router, secret, sess := newTestSession(t)
+	path := "/api/sessions/" + secret + "/poll"
+
+	queue(sess, "one", "two")
+	if got := poll(t, router, path); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("first poll got seqs %v, want [1 2]", got)
+	}
+
+	// The client never saw the response, so it asks again from the start
+	if got := poll(t, router, path+"?last_seq=0"); len(got) != 2 {
+		t.Fatalf("poll with last_seq=0 got seqs %v, want [1 2]", got)
+	}
+	if got := poll(t, router, path+"?last_seq=2"); len(got) != 0 {
+		t.Fatalf("poll with last_seq=2 got seqs %v, want none", got)
+	}
+}
+
+// failingWriter is a response whose body can't be written, like a client
+// that went away
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestPollRequeuesOnFailedWrite(t *testing.T) {
+	router, secret, sess := newTestSession(t)
+	path := "/api/sessions/" + secret + "/poll"
+
+	queue(sess, "one", "two")
+	router.ServeHTTP(failingWriter{httptest.NewRecorder()}, httptest.NewRequest(http.MethodGet, path, nil))
+
+	if got := poll(t, router, path); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("poll after a failed write got seqs %v, want [1 2]", got)
+	}
+}
+
+func TestStreamRequeuesOnFailedWrite(t *testing.T) {
+	router, secret, sess := newTestSession(t)
+
+	queue(sess, "one")
+	router.ServeHTTP(failingWriter{httptest.NewRecorder()}, httptest.NewRequest(http.MethodGet, "/api/sessions/"+secret+"/events", nil))
+
+	if got := poll(t, router, "/api/sessions/"+secret+"/poll"); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("poll after a failed stream write got seqs %v, want [1]", got)
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"chatstreamapp/internal/client"
+	"chatstreamapp/internal/hub"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/tracing"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// traceConn is a hub connection whose messages stay in its queue
+type traceConn struct {
+	*client.Base
+}
+
+func (traceConn) Transport() string { return "test" }
+
+// exportedSpan is the part of an exported span the test checks
+type exportedSpan struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+}
+
+func TestTraceRESTMessageToRecipients(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := tracing.New(exporter, 1)
+	tracing.SetTracer(tracer)
+	t.Cleanup(func() {
+		tracing.SetTracer(nil)
+		tracer.Shutdown(context.Background())
+	})
+
+	h := hub.NewHub()
+	go h.Run()
+	var conns []traceConn
+	for _, id := range []string{"alice", "bob"} {
+		conn := traceConn{client.NewBase(&models.User{ID: id, Username: id}, logger.With())}
+		h.Register(conn)
+		if err := h.JoinRoom(conn, "general"); err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+
+	router := gin.New()
+	router.Use(Tracing())
+	router.POST("/api/messages", sendMessage(h))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const callerSpan = "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodPost, "/api/messages",
+		strings.NewReader(`{"type":"text","content":"traced","sender":"alice","sender_id":"alice","room":"general"}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-"+callerSpan+"-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	// Broadcast returns once the hub has routed the message, so every span
+	// has ended by now
+	if err := tracer.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	spans := map[string][]exportedSpan{}
+	for _, stub := range exporter.GetSpans() {
+		span := exportedSpan{
+			TraceID:      stub.SpanContext.TraceID().String(),
+			SpanID:       stub.SpanContext.SpanID().String(),
+			ParentSpanID: stub.Parent.SpanID().String(),
+			Name:         stub.Name,
+		}
+		if span.TraceID != traceID {
+			t.Errorf("span %s in trace %s, want %s", span.Name, span.TraceID, traceID)
+		}
+		spans[span.Name] = append(spans[span.Name], span)
+	}
+
+	server := only(t, spans, "POST /api/messages")
+	if server.ParentSpanID != callerSpan {
+		t.Errorf("REST span parent = %s, want the caller's %s", server.ParentSpanID, callerSpan)
+	}
+	dispatch := only(t, spans, "hub.broadcast")
+	if dispatch.ParentSpanID != server.SpanID {
+		t.Errorf("hub.broadcast parent = %s, want the REST span %s", dispatch.ParentSpanID, server.SpanID)
+	}
+	deliveries := map[string]bool{}
+	for _, span := range spans["hub.deliver"] {
+		if span.ParentSpanID != dispatch.SpanID {
+			t.Errorf("hub.deliver parent = %s, want hub.broadcast %s", span.ParentSpanID, dispatch.SpanID)
+		}
+		deliveries["00-"+traceID+"-"+span.SpanID+"-01"] = true
+	}
+	if len(deliveries) != len(conns) {
+		t.Fatalf("got %d hub.deliver spans, want one per recipient (%d)", len(deliveries), len(conns))
+	}
+
+	// Each recipient's copy carries its own delivery span
+	for _, conn := range conns {
+		message := received(t, conn, "traced")
+		if !deliveries[message.TraceParent] {
+			t.Errorf("%s got traceparent %q, want one of its hub.deliver spans", conn.User.ID, message.TraceParent)
+		}
+		delete(deliveries, message.TraceParent)
+	}
+}
+
+// only returns the one exported span with a name
+func only(t *testing.T, spans map[string][]exportedSpan, name string) exportedSpan {
+	t.Helper()
+	if len(spans[name]) != 1 {
+		t.Fatalf("got %d %s spans, want 1", len(spans[name]), name)
+	}
+	return spans[name][0]
+}
+
+// received finds the queued message with the given content
+func received(t *testing.T, conn traceConn, content string) *models.Message {
+	t.Helper()
+	for len(conn.Send) > 0 {
+		if message := <-conn.Send; message.Content == content {
+			return message
+		}
+	}
+	t.Fatalf("%s didn't receive %q", conn.User.ID, content)
+	return nil
+}
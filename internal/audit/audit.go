@@ -0,0 +1,204 @@
+package audit
+
+import (
+	"chatstreamapp/internal/logger"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry records one action taken by an operator, a moderator or a filter
+type Entry struct {
+	Time time.Time `json:"time"`
+
+	// Who acted: an operator name, a moderator's user ID, or
+	// "filter:<name>" for automatic moderation
+	Actor string `json:"actor"`
+
+	// What was done, e.g. "message.reject" or "room.delete"
+	Action string `json:"action"`
+
+	// ID of the message, connection or room acted on, if any
+	Target string `json:"target,omitempty"`
+
+	// The user the action affects, and the room it happened in
+	UserID string `json:"user_id,omitempty"`
+	Room   string `json:"room,omitempty"`
+
+	Reason  string            `json:"reason,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Log is an append-only record of admin and moderation actions. Each entry
+// is written to the structured log and, when a file is open, appended to it
+// as a JSON line. The most recent entries are also kept in memory.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+
+	// The last keepRecent entries, oldest first
+	recent []Entry
+}
+
+// How many entries are kept in memory for reading back without a file
+const keepRecent = 1000
+
+// Default is the audit log used by Record
+var Default = &Log{}
+
+// Open appends entries to the file at path, creating it if needed. Entries
+// only go to the structured log until it is called.
+func (l *Log) Open(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.path = path
+	l.file = file
+	return nil
+}
+
+// Close closes the audit file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.path = ""
+	l.file = nil
+	return err
+}
+
+// Record appends an entry, stamping it with the current time if it has none
+func (l *Log) Record(entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	logger.Info("audit",
+		"actor", entry.Actor,
+		"action", entry.Action,
+		"target", entry.Target,
+		logger.UserID, entry.UserID,
+		logger.RoomID, entry.Room,
+		"reason", entry.Reason)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recent = append(l.recent, entry)
+	if len(l.recent) > keepRecent {
+		l.recent = l.recent[len(l.recent)-keepRecent:]
+	}
+	if l.file == nil {
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		logger.Error("failed to encode audit entry", "error", err)
+		return
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		logger.Error("failed to write audit entry", "error", err)
+	}
+}
+
+// Query selects audit entries. Empty fields match everything.
+type Query struct {
+	Actor  string
+	UserID string
+	Room   string
+
+	// Matches actions starting with it, so "user." selects every
+	// moderator action
+	Action string
+
+	// Only entries at or after this time
+	Since time.Time
+
+	// Most entries returned; the newest are kept
+	Limit int
+}
+
+// matches reports whether an entry is selected by the query
+func (q Query) matches(entry Entry) bool {
+	return (q.Actor == "" || entry.Actor == q.Actor) &&
+		(q.UserID == "" || entry.UserID == q.UserID) &&
+		(q.Room == "" || entry.Room == q.Room) &&
+		strings.HasPrefix(entry.Action, q.Action) &&
+		!entry.Time.Before(q.Since)
+}
+
+// Entries returns the entries matching q, oldest first. They are read back
+// from the file when one is open, so they include earlier runs; otherwise
+// only the last entries kept in memory are searched. The file is read
+// without holding the lock, so a long read doesn't hold up Record.
+func (l *Log) Entries(q Query) ([]Entry, error) {
+	var entries []Entry
+	keep := func(entry Entry) {
+		if !q.matches(entry) {
+			return
+		}
+		entries = append(entries, entry)
+		if q.Limit > 0 && len(entries) > q.Limit {
+			entries = entries[1:]
+		}
+	}
+
+	l.mu.Lock()
+	if l.file == nil {
+		defer l.mu.Unlock()
+		for _, entry := range l.recent {
+			keep(entry)
+		}
+		return entries, nil
+	}
+	// Entries are written whole under the lock, so the current size ends
+	// on a line boundary; anything appended later is left for next time
+	path := l.path
+	info, err := l.file.Stat()
+	l.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(io.LimitReader(file, info.Size()))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A line cut short by a crash shouldn't hide the rest
+			continue
+		}
+		keep(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// Record appends an entry to the default audit log
+func Record(entry Entry) {
+	Default.Record(entry)
+}
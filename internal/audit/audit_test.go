@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// actions returns the action of each entry
+func actions(entries []Entry) []string {
+	list := make([]string, len(entries))
+	for i, entry := range entries {
+		list[i] = entry.Action
+	}
+	return list
+}
+
+// record fills l with a fixed set of entries an hour apart
+func record(l *Log, start time.Time) {
+	for i, entry := range []Entry{
+		{Actor: "filter:spam", Action: "message.reject", UserID: "mallory", Room: "general"},
+		{Actor: "alice", Action: "user.mute", UserID: "mallory", Room: "general"},
+		{Actor: "ops", Action: "room.delete", Room: "dev"},
+		{Actor: "alice", Action: "user.ban", UserID: "eve"},
+	} {
+		entry.Time = start.Add(time.Duration(i) * time.Hour)
+		l.Record(entry)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"everything", Query{}, []string{"message.reject", "user.mute", "room.delete", "user.ban"}},
+		{"actor", Query{Actor: "alice"}, []string{"user.mute", "user.ban"}},
+		{"user", Query{UserID: "mallory"}, []string{"message.reject", "user.mute"}},
+		{"room", Query{Room: "dev"}, []string{"room.delete"}},
+		{"action prefix", Query{Action: "user."}, []string{"user.mute", "user.ban"}},
+		{"since", Query{Since: start.Add(2 * time.Hour)}, []string{"room.delete", "user.ban"}},
+		{"limit keeps the newest", Query{Limit: 2}, []string{"room.delete", "user.ban"}},
+		{"combined", Query{Actor: "alice", UserID: "mallory"}, []string{"user.mute"}},
+		{"no match", Query{Actor: "bob"}, []string{}},
+	}
+
+	memory := &Log{}
+	record(memory, start)
+
+	file := &Log{}
+	if err := file.Open(filepath.Join(t.TempDir(), "audit.log")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	record(file, start)
+
+	for _, l := range []struct {
+		name string
+		log  *Log
+	}{{"memory", memory}, {"file", file}} {
+		for _, tt := range tests {
+			t.Run(l.name+"/"+tt.name, func(t *testing.T) {
+				entries, err := l.log.Entries(tt.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := actions(entries); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Entries(%+v) = %v, want %v", tt.query, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestEntriesFromEarlierRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	first := &Log{}
+	if err := first.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	first.Record(Entry{Actor: "ops", Action: "room.delete"})
+	first.Close()
+
+	// A line cut short by a crash is skipped
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"actor":"ops","act` + "\n")
+	file.Close()
+
+	second := &Log{}
+	if err := second.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.Record(Entry{Actor: "ops", Action: "connection.close"})
+
+	entries, err := second.Entries(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := actions(entries), []string{"room.delete", "connection.close"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() = %v, want %v", got, want)
+	}
+	if entries[1].Time.IsZero() {
+		t.Error("Record() didn't stamp the entry")
+	}
+}
+
+func TestRecentLimit(t *testing.T) {
+	l := &Log{}
+	for range keepRecent + 10 {
+		l.Record(Entry{Actor: "filter:spam", Action: "message.reject"})
+	}
+	entries, _ := l.Entries(Query{})
+	if len(entries) != keepRecent {
+		t.Errorf("kept %d entries in memory, want %d", len(entries), keepRecent)
+	}
+}
+
+func TestEntriesWhileRecording(t *testing.T) {
+	l := &Log{}
+	if err := l.Open(filepath.Join(t.TempDir(), "audit.log")); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Reads see whole entries only; run with -race
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 200 {
+			l.Record(Entry{Actor: "alice", Action: "user.mute"})
+		}
+	}()
+	for range 20 {
+		entries, err := l.Entries(Query{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if entry.Action != "user.mute" {
+				t.Fatalf("read a partial entry: %+v", entry)
+			}
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/store"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Longest name a bot may have
+const MaxNameLength = 80
+
+// Account is a bot. Bots connect over the WebSocket protocol like people do,
+// but authenticate with a token instead of naming themselves.
+type Account struct {
+	ID string `json:"id"`
+
+	// Username the bot is shown as
+	Name string `json:"name"`
+
+	// Secret the bot connects with. Only shown when the bot is created.
+	Token string `json:"token,omitempty"`
+
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Redacted returns the bot without its token
+func (a Account) Redacted() Account {
+	a.Token = ""
+	return a
+}
+
+// UserID is the ID the bot connects as
+func (a Account) UserID() string {
+	return "bot:" + a.ID
+}
+
+// User returns the bot as a connected user
+func (a Account) User() *models.User {
+	return &models.User{ID: a.UserID(), Username: a.Name, Bot: true}
+}
+
+// Reserved reports whether a user ID belongs to a bot or an incoming
+// webhook, which people can't connect as
+func Reserved(userID string) bool {
+	return strings.HasPrefix(userID, "bot:") || strings.HasPrefix(userID, "webhook:")
+}
+
+// Store holds the bot accounts. Changes are saved to a file when one is set,
+// so they survive restarts.
+type Store struct {
+	mu       sync.Mutex
+	path     string
+	accounts []*Account
+}
+
+// Accounts is the server's bot account store
+var Accounts = &Store{}
+
+// Load reads the bots saved at path, which later changes are saved to. A
+// missing file is an empty store.
+func (s *Store) Load(path string) error {
+	var accounts []*Account
+	if err := store.LoadJSON(path, "bots", &accounts); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	s.accounts = accounts
+	return nil
+}
+
+// Add creates a bot, filling in its ID, token and creation time
+func (s *Store) Add(a Account) (*Account, error) {
+	a.Name = strings.TrimSpace(a.Name)
+	if a.Name == "" {
+		return nil, invalid("name is required")
+	}
+	if utf8.RuneCountInString(a.Name) > MaxNameLength {
+		return nil, invalid("name must be at most %d characters", MaxNameLength)
+	}
+	a.ID = uuid.New().String()
+	a.Token = newToken()
+	a.CreatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts = append(s.accounts, &a)
+	copied := a
+	return &copied, s.save()
+}
+
+// Remove deletes a bot, reporting false if there was none
+func (s *Store) Remove(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, a := range s.accounts {
+		if a.ID == id {
+			s.accounts = append(s.accounts[:i], s.accounts[i+1:]...)
+			return true, s.save()
+		}
+	}
+	return false, nil
+}
+
+// List returns the bots, oldest first, without their tokens
+func (s *Store) List() []Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Account, len(s.accounts))
+	for i, a := range s.accounts {
+		list[i] = a.Redacted()
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Authenticate returns the bot a token belongs to
+func (s *Store) Authenticate(token string) (Account, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.accounts {
+		if subtle.ConstantTimeCompare([]byte(a.Token), []byte(token)) == 1 {
+			return *a, true
+		}
+	}
+	return Account{}, false
+}
+
+// save writes the bots to the file, replacing it atomically
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	accounts := s.accounts
+	if accounts == nil {
+		accounts = []*Account{}
+	}
+	return store.SaveJSON(s.path, "bots", accounts)
+}
+
+// newToken returns a random bot token
+func newToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func invalid(format string, args ...any) error {
+	return &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: fmt.Sprintf(format, args...)}
+}
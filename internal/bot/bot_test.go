@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"chatstreamapp/internal/models"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bots.json")
+	s := &Store{}
+	if err := s.Load(path); err != nil {
+		t.Fatalf("Load() of a missing file = %v", err)
+	}
+
+	for _, name := range []string{"", "   ", strings.Repeat("b", MaxNameLength+1)} {
+		var coded *models.CodedError
+		if _, err := s.Add(Account{Name: name}); !errors.As(err, &coded) || coded.Code != models.ErrorCodeInvalidRequest {
+			t.Errorf("Add(%.10q) = %v, want invalid_request", name, err)
+		}
+	}
+
+	deploy, err := s.Add(Account{Name: " deploybot ", CreatedBy: "admin"})
+	if err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+	if deploy.Name != "deploybot" || deploy.ID == "" || deploy.Token == "" {
+		t.Errorf("Add() = %+v, want a trimmed name, an ID and a token", deploy)
+	}
+	if _, err := s.Add(Account{Name: "pager"}); err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+
+	if _, ok := s.Authenticate(""); ok {
+		t.Error("Authenticate() accepted an empty token")
+	}
+	if _, ok := s.Authenticate(deploy.Token + "x"); ok {
+		t.Error("Authenticate() accepted a wrong token")
+	}
+
+	// Bots and their tokens survive a restart; listings hide the tokens
+	reloaded := &Store{}
+	if err := reloaded.Load(path); err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	account, ok := reloaded.Authenticate(deploy.Token)
+	if !ok || account.ID != deploy.ID {
+		t.Fatalf("Authenticate() after reload = %+v, %v", account, ok)
+	}
+	if user := account.User(); user.ID != "bot:"+deploy.ID || !user.Bot || !Reserved(user.ID) {
+		t.Errorf("User() = %+v, want a reserved bot user", user)
+	}
+	list := reloaded.List()
+	if len(list) != 2 {
+		t.Fatalf("List() = %+v, want 2 bots", list)
+	}
+	for _, a := range list {
+		if a.Token != "" {
+			t.Errorf("List() shows %s's token", a.Name)
+		}
+	}
+
+	if removed, err := reloaded.Remove(deploy.ID); !removed || err != nil {
+		t.Fatalf("Remove() = %v, %v", removed, err)
+	}
+	if removed, _ := reloaded.Remove(deploy.ID); removed {
+		t.Error("Remove() deleted a bot twice")
+	}
+	if _, ok := reloaded.Authenticate(deploy.Token); ok {
+		t.Error("Authenticate() accepted a removed bot's token")
+	}
+}
+
+func TestReserved(t *testing.T) {
+	tests := []struct {
+		userID string
+		want   bool
+	}{
+		{"bot:1234", true},
+		{"webhook:ci", true},
+		{"alice", false},
+		{"robot:1", false},
+	}
+	for _, tt := range tests {
+		if got := Reserved(tt.userID); got != tt.want {
+			t.Errorf("Reserved(%q) = %v, want %v", tt.userID, got, tt.want)
+		}
+	}
+}
@@ -1,199 +1,481 @@
 package client
 
 import (
+	"chatstreamapp/internal/bot"
+	"chatstreamapp/internal/config"
 	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/metrics"
+	"chatstreamapp/internal/tracing"
 	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/moderation"
+	"chatstreamapp/internal/protocol"
+	"chatstreamapp/internal/ratelimit"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-const (
-	// Time allowed to write a message to the peer.
-	writeWait = 10 * time.Second
-
-	// Time allowed to read the next pong message from the peer.
-	pongWait = 60 * time.Second
-
-	// Send pings to peer with this period. Must be less than pongWait.
-	pingPeriod = (pongWait * 9) / 10
-
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
-)
+// Frames larger than this close the connection. Frames between the configured
+// max_message_size and this limit are discarded with a payload_too_large error.
+const maxFrameSize = 1 << 20
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow connections from any origin in development
+	Subprotocols:    subprotocols(),
+	CheckOrigin:     checkOrigin,
+}
+
+// checkOrigin applies the CORS origin allowlist to WebSocket upgrades.
+// Browsers don't enforce CORS on WebSockets, so without this any site could
+// open a connection with the user's cookies.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if config.Get().CORS.AllowsOrigin(origin, r.Host) {
 		return true
-	},
+	}
+	logger.FromContext(r.Context()).Warning("websocket origin rejected", "origin", origin)
+	metrics.OriginRejections.WithLabelValues("websocket").Inc()
+	return false
 }
 
 // Hub interface for client to communicate with hub
 type Hub interface {
-	Register(client *Client)
-	Unregister(client *Client)
-	Broadcast(message *models.Message)
-	SendToUser(userID string, message *models.Message)
-	JoinRoom(client *Client, roomID string)
-	LeaveRoom(client *Client, roomID string)
+	Register(conn Connection)
+	Unregister(conn Connection)
+	Detach(conn Connection)
+	Resume(token, userID string, lastSeq uint64) Connection
+	Broadcast(message *models.Message) error
+	SendToUser(userID string, message *models.Message) error
+	SendEphemeral(userID, connectionID string, message *models.Message) error
+	JoinRoom(conn Connection, roomID string) error
+	LeaveRoom(conn Connection, roomID string) error
+	Kick(userID, roomID string) error
+	Disconnect(userID string) error
+	SetTopic(roomID, topic string) error
+	IsMember(roomID, userID string) (bool, error)
 	GetRooms() map[string]*models.Room
-	GetUsers() map[string]*Client
+	GetUsers() map[string]Connection
 }
 
 // Client represents a WebSocket client
 type Client struct {
-	Hub      Hub
-	Conn     *websocket.Conn
-	Send     chan *models.Message
-	User     *models.User
-	RoomID   string
-}
+	*Base
 
-// GetUser returns the user associated with this client
-func (c *Client) GetUser() *models.User {
-	return c.User
-}
+	Hub  Hub
+	Conn *websocket.Conn
+
+	// Wire format negotiated at upgrade
+	codec Codec
 
-// GetRoomID returns the current room ID
-func (c *Client) GetRoomID() string {
-	return c.RoomID
+	// Set when the wire format can coalesce messages into one frame
+	batcher protocol.BatchEncoder
+
+	// Bytes written to the socket, nil if the connection wasn't counted
+	wire *countingConn
 }
 
-// SetRoomID sets the current room ID
-func (c *Client) SetRoomID(roomID string) {
-	c.RoomID = roomID
+// Transport implements Connection
+func (c *Client) Transport() string {
+	return "websocket"
 }
 
-// NewClient creates a new client
-func NewClient(hub Hub, conn *websocket.Conn, user *models.User) *Client {
-	return &Client{
+// NewClient creates a new client speaking the given wire format. log
+// supplies request-scoped fields such as the request ID; the connection and
+// user fields are added here.
+func NewClient(hub Hub, conn *websocket.Conn, user *models.User, codec Codec, log *logger.Logger) *Client {
+	base := NewBase(user, log)
+	base.log = base.log.With("protocol", codec.Subprotocol())
+	c := &Client{
+		Base: base,
 		Hub:  hub,
-		Conn: conn,
-		Send: make(chan *models.Message, 256),
-		User: user,
 	}
+	c.attach(conn, codec)
+	return c
+}
+
+// attach puts the client on a new socket, either at creation or when the
+// client resumes. The previous socket's pumps must have exited.
+func (c *Client) attach(conn *websocket.Conn, codec Codec) {
+	c.Conn = conn
+	c.codec = codec
+	c.batcher = batchEncoder(codec)
+	c.wire, _ = conn.NetConn().(*countingConn)
+}
+
+// resumable reports whether the client's wire format can carry the session
+// token and sequence numbers needed to resume
+func resumable(codec Codec) bool {
+	return codec.Subprotocol() != protocol.V0
+}
+
+// start runs the pumps for the current socket
+func (c *Client) start() {
+	stop := make(chan struct{})
+	writeDone := make(chan struct{})
+	go c.writePump(stop, writeDone)
+	go c.readPump(stop, writeDone)
 }
 
 // ServeWS handles websocket requests from the peer
 func ServeWS(hub Hub, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	log := logger.FromContext(r.Context())
+
+	_, span := tracing.Start(r.Context(), "websocket.upgrade")
+	defer span.End()
+
+	// Compression is negotiated per connection, so toggling it only
+	// affects new ones
+	u := upgrader
+	u.EnableCompression = config.Get().WebSocket.Compression.Enabled
+
+	// Get user info from query parameters, or from the bot token for bots.
+	// Moderators name themselves with their token.
+	user := &models.User{
+		ID:       r.URL.Query().Get("user_id"),
+		Username: r.URL.Query().Get("username"),
+	}
+	if token := botToken(r); token != "" {
+		account, ok := bot.Accounts.Authenticate(token)
+		if !ok {
+			log.Info("websocket rejected: invalid bot token")
+			reject(w, http.StatusUnauthorized, models.ErrorCodeUnauthorized, "Invalid bot token")
+			return
+		}
+		user = account.User()
+	} else if token := r.URL.Query().Get("moderator_token"); token != "" {
+		userID, ok := config.Get().Moderation.AuthenticateModerator(token)
+		if !ok {
+			log.Info("websocket rejected: invalid moderator token")
+			reject(w, http.StatusUnauthorized, models.ErrorCodeUnauthorized, "Invalid moderator token")
+			return
+		}
+		user.ID = userID
+		user.Moderator = true
+	} else if bot.Reserved(user.ID) {
+		log.Info("websocket rejected: reserved user_id", logger.UserID, user.ID)
+		reject(w, http.StatusForbidden, models.ErrorCodeUnauthorized, "This user_id is reserved for bots and integrations")
+		return
+	}
+
+	// Banned users are turned away before the upgrade
+	if ban := moderation.Sanctions.Find(moderation.Ban, user.ID, ""); ban != nil {
+		log.Info("websocket rejected: user is banned", logger.UserID, ban.UserID)
+		reject(w, http.StatusForbidden, models.ErrorCodeBanned, ban.Err().Error())
+		return
+	}
+
+	conn, err := u.Upgrade(countingWriter{w}, r, nil)
 	if err != nil {
-		logger.Errorf("WebSocket upgrade error: %v", err)
+		log.Warning("websocket upgrade failed", "error", err)
+		metrics.UpgradeFailures.Inc()
+		span.RecordError(err)
 		return
 	}
 
-	// Get user info from query parameters
-	userID := r.URL.Query().Get("user_id")
-	username := r.URL.Query().Get("username")
-	
-	if userID == "" || username == "" {
+	if user.ID == "" || user.Username == "" {
+		log.Warning("websocket rejected: missing user_id or username")
 		conn.Close()
 		return
 	}
 
-	user := &models.User{
-		ID:       userID,
-		Username: username,
+	// The upgrader only accepts subprotocols it lists, so this can't fail
+	codec, err := codecFor(conn.Subprotocol())
+	if err != nil {
+		log.Error("websocket rejected", "error", err)
+		conn.Close()
+		return
+	}
+
+	// A client reconnecting with its resume token gets its old connection
+	// back, still in its room, with the events it missed queued
+	if token := r.URL.Query().Get("resume_token"); token != "" && resumable(codec) {
+		lastSeq, _ := strconv.ParseUint(r.URL.Query().Get("last_seq"), 10, 64)
+		if client, ok := hub.Resume(token, user.ID, lastSeq).(*Client); ok {
+			client.attach(conn, codec)
+			client.log.Info("websocket resumed", "remote_addr", r.RemoteAddr, "last_seq", lastSeq)
+			span.SetAttributes(tracing.Attr(logger.ConnectionID, client.ID), tracing.Attr(logger.UserID, user.ID))
+			client.writeSession(true)
+			client.start()
+			return
+		}
 	}
 
-	client := NewClient(hub, conn, user)
+	client := NewClient(hub, conn, user, codec, log)
+	client.log.Info("websocket connected", "username", user.Username, "bot", user.Bot, "remote_addr", r.RemoteAddr)
+	span.SetAttributes(tracing.Attr(logger.ConnectionID, client.ID), tracing.Attr(logger.UserID, user.ID))
+	if resumable(codec) {
+		client.writeSession(false)
+	}
 	hub.Register(client)
+	client.start()
+}
+
+// botToken returns the token a bot connects with, from the Authorization
+// header or, for clients that can't set headers, the bot_token parameter
+func botToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return r.URL.Query().Get("bot_token")
+}
+
+// reject answers a WebSocket handshake with a JSON error instead of
+// upgrading
+func reject(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+		"code":  code,
+	})
+}
 
-	// Start goroutines for handling client
-	go client.writePump()
-	go client.readPump()
+// writeSession sends the session frame. It goes straight to the socket, ahead
+// of any replayed events, and isn't part of the sequenced event stream. A
+// failed write surfaces in the pumps.
+func (c *Client) writeSession(resumed bool) {
+	data, err := c.codec.Encode(models.NewSession(c.ResumeToken(), resumed))
+	if err != nil {
+		c.log.Error("failed to encode session frame", "error", err)
+		return
+	}
+	c.Conn.SetWriteDeadline(time.Now().Add(config.Get().WebSocket.WriteWait.Duration()))
+	c.writeFrame(data)
 }
 
-// readPump pumps messages from the websocket connection to the hub
-func (c *Client) readPump() {
+// readPump pumps messages from the websocket connection to the hub. When the
+// connection drops unexpectedly the client is detached rather than
+// unregistered, so it can resume.
+func (c *Client) readPump(stop chan<- struct{}, writeDone <-chan struct{}) {
+	var readErr error
 	defer func() {
-		c.Hub.Unregister(c)
 		c.Conn.Close()
+		close(stop)
+		// The hub may hand this client to a resumed socket as soon as it is
+		// detached, so the write pump has to be gone first
+		<-writeDone
+		ratelimit.Default.Forget(ratelimit.OpFrames, c.ID)
+
+		closedByPeer := websocket.IsCloseError(readErr, websocket.CloseNormalClosure, websocket.CloseGoingAway)
+		if closedByPeer || c.Closed() || !resumable(c.codec) {
+			c.Hub.Unregister(c)
+			return
+		}
+		c.Hub.Detach(c)
 	}()
 
-	c.Conn.SetReadLimit(maxMessageSize)
-	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	// Timeouts and limits are re-read from the active config so reloads
+	// take effect on open connections
+	ws := config.Get().WebSocket
+	c.Conn.SetReadLimit(max(ws.MaxMessageSize, maxFrameSize))
+	c.Conn.SetReadDeadline(time.Now().Add(ws.PongWait.Duration()))
 	c.Conn.SetPongHandler(func(string) error {
-		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.Conn.SetReadDeadline(time.Now().Add(config.Get().WebSocket.PongWait.Duration()))
 		return nil
 	})
 
 	for {
-		var message models.Message
-		err := c.Conn.ReadJSON(&message)
+		data, err := c.readFrame()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				logger.Errorf("WebSocket error: %v", err)
+				c.log.Warning("websocket read failed", "error", err)
 			}
+			readErr = err
 			break
 		}
+		if data == nil {
+			continue
+		}
 
-		// Set sender information
-		message.Sender = c.User.Username
-		message.SenderID = c.User.ID
-		message.Timestamp = time.Now()
-
-		// Handle different message types
-		switch message.Type {
-		case models.MessageTypeText:
-			if message.Room != "" {
-				// Group message
-				c.Hub.Broadcast(&message)
-			} else if message.Recipient != "" {
-				// Private message
-				message.Type = models.MessageTypePrivate
-				c.Hub.SendToUser(message.Recipient, &message)
-				// Also send back to sender for confirmation
-				c.Send <- &message
+		req, err := c.codec.Decode(data)
+		if err != nil {
+			var requestID string
+			if req != nil {
+				requestID = req.RequestID
 			}
-		case "join_room":
-			c.Hub.JoinRoom(c, message.Content)
-		case "leave_room":
-			c.Hub.LeaveRoom(c, message.Content)
+			c.sendError(requestID, err)
+			continue
+		}
+
+		id, err := Handle(c.Hub, c, req)
+		if err != nil {
+			c.sendError(req.RequestID, err)
+			continue
+		}
+		if req.RequestID != "" {
+			c.SendMessage(models.NewAck(req.RequestID, id))
 		}
 	}
 }
 
-// writePump pumps messages from the hub to the websocket connection
-func (c *Client) writePump() {
+// readFrame returns the next data frame. Frames over the configured size
+// limit are discarded and reported, in which case both results are nil.
+func (c *Client) readFrame() ([]byte, error) {
+	c.Conn.SetReadLimit(max(config.Get().WebSocket.MaxMessageSize, maxFrameSize))
+
+	_, r, err := c.Conn.NextReader()
+	if err != nil {
+		return nil, err
+	}
+
+	limit := config.Get().WebSocket.MaxMessageSize
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return nil, err
+		}
+		c.sendError("", &models.CodedError{
+			Code:    models.ErrorCodePayloadTooLarge,
+			Message: fmt.Sprintf("Message exceeds %d bytes", limit),
+		})
+		return nil, nil
+	}
+	return data, nil
+}
+
+// sendError reports a failed request to the client
+func (c *Client) sendError(requestID string, err error) {
+	c.SendMessage(ErrorReply(c, requestID, err))
+}
+
+// writePump pumps messages from the hub to the websocket connection until
+// the queue closes, a write fails or readPump stops it
+func (c *Client) writePump(stop <-chan struct{}, done chan<- struct{}) {
+	pingPeriod := config.Get().WebSocket.PingPeriod()
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
+		close(done)
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
+			var batch []*models.Message
+			if ok {
+				batch, ok = c.collect(message)
 			}
 
-			if err := c.Conn.WriteJSON(message); err != nil {
-				logger.Errorf("WebSocket write error: %v", err)
+			c.Conn.SetWriteDeadline(time.Now().Add(config.Get().WebSocket.WriteWait.Duration()))
+			if len(batch) > 0 {
+				if err := c.write(batch); err != nil {
+					c.log.Warning("websocket write failed", "error", err)
+					return
+				}
+			}
+			if !ok {
+				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
 		case <-ticker.C:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			ws := config.Get().WebSocket
+			if period := ws.PingPeriod(); period != pingPeriod {
+				pingPeriod = period
+				ticker.Reset(pingPeriod)
+			}
+			c.Conn.SetWriteDeadline(time.Now().Add(ws.WriteWait.Duration()))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+
+		case <-stop:
+			return
+		}
+	}
+}
+
+// collect gathers the messages queued within the batch window after first.
+// ok is false when the send queue was closed meanwhile.
+func (c *Client) collect(first *models.Message) (batch []*models.Message, ok bool) {
+	batch = []*models.Message{first}
+
+	cfg := config.Get().WebSocket.Batch
+	if c.batcher == nil || cfg.Window <= 0 {
+		return batch, true
+	}
+
+	timer := time.NewTimer(cfg.Window.Duration())
+	defer timer.Stop()
+
+	for len(batch) < cfg.MaxMessages {
+		select {
+		case message, ok := <-c.Send:
+			if !ok {
+				return batch, false
+			}
+			batch = append(batch, message)
+		case <-timer.C:
+			return batch, true
 		}
 	}
+	return batch, true
 }
 
-// SendMessage sends a message to the client
-func (c *Client) SendMessage(message *models.Message) {
-	select {
-	case c.Send <- message:
-	default:
-		close(c.Send)
+// write sends messages in one frame, tracing those that belong to a trace
+func (c *Client) write(messages []*models.Message) (err error) {
+	for _, message := range messages {
+		if message.TraceParent == "" {
+			continue
+		}
+		ctx := tracing.ContextWithRemoteParent(context.Background(), message.TraceParent)
+		_, span := tracing.Start(ctx, "websocket.write",
+			tracing.WithKind(tracing.SpanKindProducer),
+			tracing.WithAttributes(
+				tracing.Attr(logger.ConnectionID, c.ID),
+				tracing.Attr("batch.size", len(messages)),
+			))
+		defer func() {
+			span.RecordError(err)
+			span.End()
+		}()
+	}
+
+	var data []byte
+	if len(messages) == 1 {
+		data, err = c.codec.Encode(messages[0])
+	} else {
+		data, err = c.batcher.EncodeBatch(messages)
+		metrics.BatchSize.Observe(float64(len(messages)))
+	}
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(data)
+}
+
+// writeFrame sends one data frame, compressing it when it is large enough
+func (c *Client) writeFrame(data []byte) error {
+	cfg := config.Get().WebSocket.Compression
+	compress := len(data) >= cfg.Threshold
+	// Both are no-ops unless the client negotiated permessage-deflate
+	c.Conn.EnableWriteCompression(compress)
+	c.Conn.SetCompressionLevel(cfg.Level)
+
+	if c.wire == nil {
+		return c.Conn.WriteMessage(c.codec.FrameType(), data)
+	}
+
+	before := c.wire.written.Load()
+	err := c.Conn.WriteMessage(c.codec.FrameType(), data)
+	written := c.wire.written.Load() - before
+
+	metrics.PayloadBytes.Add(float64(len(data)))
+	metrics.WireBytes.Add(float64(written))
+	if compress && written < int64(len(data)) {
+		metrics.CompressionSavedBytes.Add(float64(int64(len(data)) - written))
 	}
+	return err
 }
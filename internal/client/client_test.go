@@ -0,0 +1,75 @@
+package client
+
+import (
+	"chatstreamapp/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	cfg := config.Default()
+	cfg.CORS.AllowedOrigins = []string{"https://chat.example.com", "https://*.example.org"}
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"no origin", "", true},
+		{"same origin", "http://" + host, true},
+		{"allowed", "https://chat.example.com", true},
+		{"allowed subdomain", "https://app.example.org", true},
+		{"disallowed", "https://evil.test", false},
+		{"bare apex of wildcard", "https://example.org", false},
+		{"suffix spoof", "https://evilexample.org", false},
+		{"scheme mismatch", "http://chat.example.com", false},
+		{"null", "null", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, server.URL, nil)
+			req.Header = header
+			if got := checkOrigin(req); got != tt.want {
+				t.Errorf("checkOrigin = %v, want %v", got, tt.want)
+			}
+
+			conn, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+			if tt.want {
+				if err != nil {
+					t.Fatalf("upgrade refused: %v", err)
+				}
+				conn.Close()
+				return
+			}
+			if err == nil {
+				conn.Close()
+				t.Fatal("upgrade succeeded for a disallowed origin")
+			}
+			if resp == nil || resp.StatusCode != http.StatusForbidden {
+				t.Errorf("response = %v, want 403", resp)
+			}
+		})
+	}
+}
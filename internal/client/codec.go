@@ -0,0 +1,87 @@
+package client
+
+import (
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/protocol"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// Codec reads and writes frames in one protocol version and encoding. Each
+// connection picks one through subprotocol negotiation; the hub only ever
+// sees decoded requests and models.Message.
+type Codec interface {
+	protocol.Adapter
+
+	// FrameType is websocket.TextMessage or websocket.BinaryMessage
+	FrameType() int
+}
+
+// Binary encodings of the v1 envelope
+const (
+	SubprotocolMsgpack = protocol.V1 + "+msgpack"
+	SubprotocolProto   = protocol.V1 + "+proto"
+)
+
+// Supported codecs in order of server preference
+var codecs = []Codec{
+	protoCodec{},
+	msgpackCodec{},
+	textCodec{mustAdapter(protocol.V1)},
+	textCodec{mustAdapter(protocol.V0)},
+}
+
+// subprotocols lists the names offered to the upgrader
+func subprotocols() []string {
+	names := make([]string, len(codecs))
+	for i, c := range codecs {
+		names[i] = c.Subprotocol()
+	}
+	return names
+}
+
+// codecFor returns the codec of a negotiated subprotocol. Without one the
+// connection speaks the legacy format.
+func codecFor(subprotocol string) (Codec, error) {
+	if subprotocol == "" {
+		subprotocol = protocol.V0
+	}
+	for _, c := range codecs {
+		if c.Subprotocol() == subprotocol {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported subprotocol %q", subprotocol)
+}
+
+// batchEncoder returns the codec's batch encoder, or nil when its format
+// has no batch frame
+func batchEncoder(c Codec) protocol.BatchEncoder {
+	if t, ok := c.(textCodec); ok {
+		b, _ := t.Adapter.(protocol.BatchEncoder)
+		return b
+	}
+	b, _ := c.(protocol.BatchEncoder)
+	return b
+}
+
+// textCodec sends the JSON formats as text frames
+type textCodec struct {
+	protocol.Adapter
+}
+
+func (textCodec) FrameType() int { return websocket.TextMessage }
+
+func mustAdapter(name string) protocol.Adapter {
+	adapter, err := protocol.ForSubprotocol(name)
+	if err != nil {
+		panic(err)
+	}
+	return adapter
+}
+
+// malformed is returned when a binary frame can't be parsed
+func malformed(err error) error {
+	return &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: fmt.Sprintf("Malformed frame: %v", err)}
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/protocol"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// msgpackCodec encodes the v1 envelope as MessagePack, using the same field
+// names as the JSON encoding. Timestamps use the MessagePack timestamp type.
+type msgpackCodec struct{}
+
+// msgpackEnvelope keeps the payload raw until the op is known
+type msgpackEnvelope struct {
+	Op        string    `codec:"op"`
+	RequestID string    `codec:"request_id,omitempty"`
+	Seq       uint64    `codec:"seq,omitempty"`
+	Payload   codec.Raw `codec:"payload,omitempty"`
+}
+
+var (
+	msgpackHandle = &codec.MsgpackHandle{
+		WriteExt: true,
+		BasicHandle: codec.BasicHandle{
+			EncodeOptions: codec.EncodeOptions{Raw: true},
+			DecodeOptions: codec.DecodeOptions{RawToString: true},
+		},
+	}
+
+	// Payloads are decoded strictly, like the JSON encoding
+	msgpackStrictHandle = &codec.MsgpackHandle{
+		WriteExt: true,
+		BasicHandle: codec.BasicHandle{
+			DecodeOptions: codec.DecodeOptions{RawToString: true, ErrorIfNoField: true},
+		},
+	}
+)
+
+func (msgpackCodec) Subprotocol() string { return SubprotocolMsgpack }
+
+func (msgpackCodec) FrameType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) Decode(data []byte) (*protocol.Request, error) {
+	var env msgpackEnvelope
+	if err := codec.NewDecoderBytes(data, msgpackHandle).Decode(&env); err != nil {
+		return nil, malformed(err)
+	}
+
+	return protocol.NewRequest(env.Op, env.RequestID, func(payload any) error {
+		if len(env.Payload) == 0 {
+			return nil
+		}
+		return codec.NewDecoderBytes(env.Payload, msgpackStrictHandle).Decode(payload)
+	})
+}
+
+func (msgpackCodec) Encode(message *models.Message) ([]byte, error) {
+	env, err := msgpackEnvelopeOf(message)
+	if err != nil {
+		return nil, err
+	}
+	return msgpackEncode(env)
+}
+
+func (msgpackCodec) EncodeBatch(messages []*models.Message) ([]byte, error) {
+	envs := make([]msgpackEnvelope, len(messages))
+	for i, message := range messages {
+		env, err := msgpackEnvelopeOf(message)
+		if err != nil {
+			return nil, err
+		}
+		envs[i] = env
+	}
+
+	raw, err := msgpackEncode(envs)
+	if err != nil {
+		return nil, err
+	}
+	return msgpackEncode(msgpackEnvelope{Op: protocol.EventBatch, Payload: raw})
+}
+
+func msgpackEnvelopeOf(message *models.Message) (msgpackEnvelope, error) {
+	op, payload := protocol.Event(message)
+	raw, err := msgpackEncode(payload)
+	if err != nil {
+		return msgpackEnvelope{}, err
+	}
+	return msgpackEnvelope{Op: op, RequestID: message.RequestID, Seq: message.Seq, Payload: raw}, nil
+}
+
+func msgpackEncode(v any) ([]byte, error) {
+	var data []byte
+	err := codec.NewEncoderBytes(&data, msgpackHandle).Encode(v)
+	return data, err
+}
@@ -0,0 +1,360 @@
+package client
+
+import (
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/protocol"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoCodec encodes the v1 envelope as Protocol Buffers, following
+// docs/protocol/chat.v1.proto. Payload fields are numbered by the proto
+// struct tags, so adding a tagged field is all it takes to carry it.
+type protoCodec struct{}
+
+// Field numbers of the Envelope message
+const (
+	protoEnvelopeOp        protowire.Number = 1
+	protoEnvelopeRequestID protowire.Number = 2
+	protoEnvelopePayload   protowire.Number = 3
+	protoEnvelopeSeq       protowire.Number = 4
+)
+
+func (protoCodec) Subprotocol() string { return SubprotocolProto }
+
+func (protoCodec) FrameType() int { return websocket.BinaryMessage }
+
+func (protoCodec) Decode(data []byte) (*protocol.Request, error) {
+	var op, requestID string
+	var payload []byte
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, malformed(protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		} else {
+			var v []byte
+			v, n = protowire.ConsumeBytes(data)
+			switch num {
+			case protoEnvelopeOp:
+				op = string(v)
+			case protoEnvelopeRequestID:
+				requestID = string(v)
+			case protoEnvelopePayload:
+				payload = v
+			}
+		}
+		if n < 0 {
+			return nil, malformed(protowire.ParseError(n))
+		}
+		data = data[n:]
+	}
+
+	return protocol.NewRequest(op, requestID, func(v any) error {
+		return unmarshalProto(payload, reflect.ValueOf(v).Elem())
+	})
+}
+
+func (protoCodec) Encode(message *models.Message) ([]byte, error) {
+	op, payload := protocol.Event(message)
+	return appendProtoEnvelope(nil, op, message.RequestID, message.Seq, marshalProto(nil, reflect.ValueOf(payload).Elem())), nil
+}
+
+// EncodeBatch sends a Batch message, whose field 1 repeats the envelopes
+func (c protoCodec) EncodeBatch(messages []*models.Message) ([]byte, error) {
+	var batch []byte
+	for _, message := range messages {
+		env, _ := c.Encode(message)
+		batch = protowire.AppendTag(batch, 1, protowire.BytesType)
+		batch = protowire.AppendBytes(batch, env)
+	}
+	return appendProtoEnvelope(nil, protocol.EventBatch, "", 0, batch), nil
+}
+
+func appendProtoEnvelope(b []byte, op, requestID string, seq uint64, payload []byte) []byte {
+	b = protowire.AppendTag(b, protoEnvelopeOp, protowire.BytesType)
+	b = protowire.AppendString(b, op)
+	if requestID != "" {
+		b = protowire.AppendTag(b, protoEnvelopeRequestID, protowire.BytesType)
+		b = protowire.AppendString(b, requestID)
+	}
+	if seq != 0 {
+		b = protowire.AppendTag(b, protoEnvelopeSeq, protowire.VarintType)
+		b = protowire.AppendVarint(b, seq)
+	}
+	b = protowire.AppendTag(b, protoEnvelopePayload, protowire.BytesType)
+	return protowire.AppendBytes(b, payload)
+}
+
+// protoField maps a protobuf field number to a struct field
+type protoField struct {
+	num   protowire.Number
+	index int
+}
+
+var protoFieldCache sync.Map // reflect.Type -> []protoField
+
+func protoFields(t reflect.Type) []protoField {
+	if fields, ok := protoFieldCache.Load(t); ok {
+		return fields.([]protoField)
+	}
+
+	var fields []protoField
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("proto")
+		if tag == "" {
+			continue
+		}
+		num, err := strconv.Atoi(tag)
+		if err != nil || !protowire.Number(num).IsValid() {
+			panic(fmt.Sprintf("client: invalid proto tag %q on %s.%s", tag, t.Name(), t.Field(i).Name))
+		}
+		fields = append(fields, protoField{num: protowire.Number(num), index: i})
+	}
+	protoFieldCache.Store(t, fields)
+	return fields
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// marshalProto appends the tagged fields of a struct. Zero values are
+// omitted, as in proto3.
+func marshalProto(b []byte, v reflect.Value) []byte {
+	for _, f := range protoFields(v.Type()) {
+		field := v.Field(f.index)
+		if field.IsZero() {
+			continue
+		}
+		if field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8 {
+			for i := 0; i < field.Len(); i++ {
+				b = appendProtoValue(b, f.num, field.Index(i))
+			}
+			continue
+		}
+		b = appendProtoValue(b, f.num, field)
+	}
+	return b
+}
+
+func appendProtoValue(b []byte, num protowire.Number, v reflect.Value) []byte {
+	if v.Type() == timeType {
+		// google.protobuf.Timestamp
+		t := v.Interface().(time.Time)
+		var ts []byte
+		ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(t.Unix()))
+		ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(t.Nanosecond()))
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, ts)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendString(b, v.String())
+	case reflect.Slice: // []byte
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, v.Bytes())
+	case reflect.Bool:
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v.Bool()))
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, v.Uint())
+	case reflect.Float64:
+		b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(v.Float()))
+	case reflect.Pointer:
+		return appendProtoValue(b, num, v.Elem())
+	case reflect.Struct:
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, marshalProto(nil, v))
+	case reflect.Map:
+		// map<K, V> is a repeated entry message with key 1 and value 2
+		iter := v.MapRange()
+		for iter.Next() {
+			entry := appendProtoValue(nil, 1, iter.Key())
+			entry = appendProtoValue(entry, 2, iter.Value())
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendBytes(b, entry)
+		}
+		return b
+	}
+	panic(fmt.Sprintf("client: unsupported proto field type %s", v.Type()))
+}
+
+var errProtoWireType = errors.New("unexpected wire type")
+
+// unmarshalProto fills the tagged fields of a struct. Unknown fields are
+// skipped so older servers accept frames from newer clients.
+func unmarshalProto(b []byte, v reflect.Value) error {
+	fields := protoFields(v.Type())
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		field, ok := protoFieldByNum(v, fields, num)
+		if !ok {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		} else if field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8 {
+			elem := reflect.New(field.Type().Elem()).Elem()
+			var err error
+			if n, err = consumeProtoValue(b, typ, elem); err != nil {
+				return fmt.Errorf("field %d: %w", num, err)
+			}
+			field.Set(reflect.Append(field, elem))
+		} else {
+			var err error
+			if n, err = consumeProtoValue(b, typ, field); err != nil {
+				return fmt.Errorf("field %d: %w", num, err)
+			}
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func protoFieldByNum(v reflect.Value, fields []protoField, num protowire.Number) (reflect.Value, bool) {
+	for _, f := range fields {
+		if f.num == num {
+			return v.Field(f.index), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// consumeProtoValue decodes one value into v and returns its length
+func consumeProtoValue(b []byte, typ protowire.Type, v reflect.Value) (int, error) {
+	want := protowire.BytesType
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		want = protowire.VarintType
+	case reflect.Float64:
+		want = protowire.Fixed64Type
+	}
+	if typ != want {
+		return 0, errProtoWireType
+	}
+
+	switch want {
+	case protowire.VarintType:
+		x, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return n, nil
+		}
+		switch v.Kind() {
+		case reflect.Bool:
+			v.SetBool(protowire.DecodeBool(x))
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			v.SetInt(int64(x))
+		default:
+			v.SetUint(x)
+		}
+		return n, nil
+	case protowire.Fixed64Type:
+		x, n := protowire.ConsumeFixed64(b)
+		if n >= 0 {
+			v.SetFloat(math.Float64frombits(x))
+		}
+		return n, nil
+	}
+
+	data, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return n, nil
+	}
+
+	if v.Type() == timeType {
+		var ts struct {
+			Seconds int64 `proto:"1"`
+			Nanos   int64 `proto:"2"`
+		}
+		if err := unmarshalProto(data, reflect.ValueOf(&ts).Elem()); err != nil {
+			return 0, err
+		}
+		v.Set(reflect.ValueOf(time.Unix(ts.Seconds, ts.Nanos).UTC()))
+		return n, nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(data))
+	case reflect.Slice:
+		v.SetBytes(append([]byte(nil), data...))
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if err := unmarshalProto(data, v.Elem()); err != nil {
+			return 0, err
+		}
+	case reflect.Struct:
+		if err := unmarshalProto(data, v); err != nil {
+			return 0, err
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.New(v.Type().Key()).Elem()
+		value := reflect.New(v.Type().Elem()).Elem()
+		if err := unmarshalMapEntry(data, key, value); err != nil {
+			return 0, err
+		}
+		v.SetMapIndex(key, value)
+	default:
+		return 0, fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return n, nil
+}
+
+// unmarshalMapEntry decodes a map entry message into key and value
+func unmarshalMapEntry(b []byte, key, value reflect.Value) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var err error
+		switch num {
+		case 1:
+			n, err = consumeProtoValue(b, typ, key)
+		case 2:
+			n, err = consumeProtoValue(b, typ, value)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package client
+
+import (
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/protocol"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// benchCodecs are the v1 encodings compared by the benchmarks
+var benchCodecs = []Codec{
+	textCodec{mustAdapter(protocol.V1)},
+	msgpackCodec{},
+	protoCodec{},
+}
+
+// benchMessage returns a markdown room message of typical size
+func benchMessage(seq uint64) *models.Message {
+	return &models.Message{
+		ID:        "6f1c2b9e-8d3a-4e57-9b0c-2a4f6d8e1b3c",
+		Type:      models.MessageTypeText,
+		Content:   "@bob the deploy is done, see [the notes](https://example.com/notes) and run `make check`",
+		Sender:    "alice",
+		SenderID:  "3d9a7c1e-5b2f-4a68-8e0d-1c7b9f3a5e24",
+		Room:      "general",
+		RequestID: "42",
+		Timestamp: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Mentions:  []string{"8b4e2d6f-1a3c-4f59-a7e0-9d2c5b8f1e36"},
+		Format:    "markdown",
+		HTML:      `<p>@bob the deploy is done, see <a href="https://example.com/notes" rel="nofollow noopener">the notes</a> and run <code>make check</code></p>`,
+		Entities: []models.Entity{
+			{Type: "mention", Text: "bob", UserID: "8b4e2d6f-1a3c-4f59-a7e0-9d2c5b8f1e36"},
+			{Type: "link", Text: "the notes", URL: "https://example.com/notes"},
+			{Type: "code", Text: "make check"},
+		},
+		Seq: seq,
+	}
+}
+
+// benchBatch returns the messages of a typical resume replay
+func benchBatch() []*models.Message {
+	messages := make([]*models.Message, 20)
+	for i := range messages {
+		messages[i] = benchMessage(uint64(i + 1))
+	}
+	return messages
+}
+
+var benchRequest = &protocol.SendMessage{
+	Room:    "general",
+	Content: "@bob the deploy is done, see [the notes](https://example.com/notes) and run `make check`",
+	Format:  "markdown",
+}
+
+// encodeRequest builds a client frame in the codec's encoding
+func encodeRequest(c Codec, op, requestID string, payload any) ([]byte, error) {
+	switch c.(type) {
+	case msgpackCodec:
+		raw, err := msgpackEncode(payload)
+		if err != nil {
+			return nil, err
+		}
+		return msgpackEncode(msgpackEnvelope{Op: op, RequestID: requestID, Payload: raw})
+	case protoCodec:
+		raw := marshalProto(nil, reflect.ValueOf(payload).Elem())
+		return appendProtoEnvelope(nil, op, requestID, 0, raw), nil
+	case textCodec:
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(protocol.Envelope{Op: op, RequestID: requestID, Payload: raw})
+	}
+	return nil, fmt.Errorf("no request encoding for %s", c.Subprotocol())
+}
+
+func TestCodecDecodeSendMessage(t *testing.T) {
+	for _, c := range benchCodecs {
+		t.Run(c.Subprotocol(), func(t *testing.T) {
+			data, err := encodeRequest(c, protocol.OpSendMessage, "42", benchRequest)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := c.Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.Op != protocol.OpSendMessage || req.RequestID != "42" {
+				t.Errorf("op %q request_id %q, want %q and %q", req.Op, req.RequestID, protocol.OpSendMessage, "42")
+			}
+			if !reflect.DeepEqual(req.Payload, benchRequest) {
+				t.Errorf("payload %+v, want %+v", req.Payload, benchRequest)
+			}
+		})
+	}
+}
+
+func TestCodecEncodeBatch(t *testing.T) {
+	for _, c := range benchCodecs {
+		t.Run(c.Subprotocol(), func(t *testing.T) {
+			encoder := batchEncoder(c)
+			if encoder == nil {
+				t.Fatal("no batch encoder")
+			}
+			if _, err := encoder.EncodeBatch(benchBatch()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestNegotiateCodec(t *testing.T) {
+	negotiated := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		negotiated <- conn.Subprotocol()
+		conn.Close()
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	tests := []struct {
+		name      string
+		offered   []string
+		want      string
+		frameType int
+	}{
+		// Clients that don't ask for a subprotocol keep the legacy format
+		{"none", nil, protocol.V0, websocket.TextMessage},
+		{"v0", []string{protocol.V0}, protocol.V0, websocket.TextMessage},
+		{"v1", []string{protocol.V1}, protocol.V1, websocket.TextMessage},
+		{"msgpack", []string{SubprotocolMsgpack}, SubprotocolMsgpack, websocket.BinaryMessage},
+		{"proto", []string{SubprotocolProto}, SubprotocolProto, websocket.BinaryMessage},
+		// The server's preferred codec wins over the client's order
+		{"server preference", []string{protocol.V1, SubprotocolMsgpack, SubprotocolProto}, SubprotocolProto, websocket.BinaryMessage},
+		{"unknown skipped", []string{"chat.v9", SubprotocolMsgpack}, SubprotocolMsgpack, websocket.BinaryMessage},
+		// The upgrade still succeeds without a subprotocol, so the
+		// connection falls back to v0
+		{"only unknown", []string{"chat.v9"}, protocol.V0, websocket.TextMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer := websocket.Dialer{Subprotocols: tt.offered}
+			conn, _, err := dialer.Dial(wsURL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Close()
+
+			codec, err := codecFor(<-negotiated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if codec.Subprotocol() != tt.want || codec.FrameType() != tt.frameType {
+				t.Errorf("codec %s with frame type %d, want %s with %d",
+					codec.Subprotocol(), codec.FrameType(), tt.want, tt.frameType)
+			}
+		})
+	}
+}
+
+func TestCodecForUnknownSubprotocol(t *testing.T) {
+	if codec, err := codecFor("chat.v9"); err == nil {
+		t.Errorf("codecFor(chat.v9) = %s, want an error", codec.Subprotocol())
+	}
+}
+
+func BenchmarkCodecEncode(b *testing.B) {
+	message := benchMessage(1)
+	for _, c := range benchCodecs {
+		b.Run(c.Subprotocol(), func(b *testing.B) {
+			var size int
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := c.Encode(message)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "bytes/frame")
+		})
+	}
+}
+
+func BenchmarkCodecEncodeBatch(b *testing.B) {
+	messages := benchBatch()
+	for _, c := range benchCodecs {
+		b.Run(c.Subprotocol(), func(b *testing.B) {
+			encoder := batchEncoder(c)
+			var size int
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := encoder.EncodeBatch(messages)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "bytes/frame")
+		})
+	}
+}
+
+func BenchmarkCodecDecode(b *testing.B) {
+	for _, c := range benchCodecs {
+		b.Run(c.Subprotocol(), func(b *testing.B) {
+			data, err := encodeRequest(c, protocol.OpSendMessage, "42", benchRequest)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Decode(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes/frame")
+		})
+	}
+}
@@ -0,0 +1,427 @@
+package client
+
+import (
+	"chatstreamapp/internal/command"
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/markdown"
+	"chatstreamapp/internal/metrics"
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/moderation"
+	"chatstreamapp/internal/privacy"
+	"chatstreamapp/internal/protocol"
+	"chatstreamapp/internal/ratelimit"
+	"chatstreamapp/internal/tracing"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Connection is a connected client as the hub sees it, whatever transport
+// carries its frames
+type Connection interface {
+	ConnectionID() string
+	GetUser() *models.User
+	GetRoomID() string
+	SetRoomID(roomID string)
+
+	// SendMessage queues a message without blocking
+	SendMessage(message *models.Message)
+
+	// QueueDepth returns the number of queued messages and the queue capacity
+	QueueDepth() (depth, capacity int)
+
+	// Transport names how the client is connected, e.g. "websocket" or "sse"
+	Transport() string
+
+	// ResumeToken returns the secret a reconnecting client presents to
+	// resume this connection
+	ResumeToken() string
+
+	// Rewind requeues every event after lastSeq for a resumed connection,
+	// reporting false when they are no longer buffered
+	Rewind(lastSeq uint64) bool
+
+	// Close disconnects the client once what is already queued is sent
+	Close()
+
+	Logger() *logger.Logger
+}
+
+// Base holds the transport-independent state of a connection: its identity,
+// room and outbound queue. Transports embed it and drain Send.
+type Base struct {
+	ID     string
+	Send   chan *models.Message
+	User   *models.User
+	RoomID string
+
+	// Secret for resuming the connection; unlike ID it never appears in
+	// logs or diagnostics
+	token string
+
+	// Logger carrying the connection, user and request fields
+	log *logger.Logger
+
+	// Guards the queue, which both the hub and the connection write to
+	mu     sync.Mutex
+	closed bool
+
+	// Sequence number of the last queued event
+	seq uint64
+
+	// The last cap(Send) queued events, replayed on resume
+	recent []*models.Message
+}
+
+// NewBase creates the shared state of a new connection. log supplies
+// request-scoped fields such as the request ID; the connection and user
+// fields are added here.
+func NewBase(user *models.User, log *logger.Logger) *Base {
+	id := uuid.New().String()
+	return &Base{
+		ID:    id,
+		Send:  make(chan *models.Message, config.Get().WebSocket.SendBufferSize),
+		User:  user,
+		token: NewToken(),
+		log:   log.With(logger.ConnectionID, id, logger.UserID, user.ID),
+	}
+}
+
+// NewToken returns a random secret, such as a resume token
+func NewToken() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ResumeToken returns the secret for resuming this connection
+func (b *Base) ResumeToken() string {
+	return b.token
+}
+
+// ConnectionID returns the unique ID of this connection
+func (b *Base) ConnectionID() string {
+	return b.ID
+}
+
+// Logger returns the structured logger for this connection
+func (b *Base) Logger() *logger.Logger {
+	return b.log
+}
+
+// GetUser returns the user associated with this client
+func (b *Base) GetUser() *models.User {
+	return b.User
+}
+
+// GetRoomID returns the current room ID
+func (b *Base) GetRoomID() string {
+	return b.RoomID
+}
+
+// SetRoomID sets the current room ID
+func (b *Base) SetRoomID(roomID string) {
+	b.RoomID = roomID
+}
+
+// QueueDepth returns the number of queued messages and the queue capacity
+func (b *Base) QueueDepth() (depth, capacity int) {
+	return len(b.Send), cap(b.Send)
+}
+
+// SendMessage queues a copy of message numbered with the connection's next
+// sequence number. When the queue is full the client is too slow to keep
+// up: Send is closed so the transport disconnects it, and later messages are
+// dropped.
+func (b *Base) SendMessage(message *models.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		metrics.MessagesDropped.WithLabelValues("connection_closed").Inc()
+		return
+	}
+
+	copied := *message
+	copied.Seq = b.seq + 1
+
+	select {
+	case b.Send <- &copied:
+		metrics.SendQueueDepth.Observe(float64(len(b.Send)))
+		b.seq = copied.Seq
+		b.recent = append(b.recent, &copied)
+		if len(b.recent) > cap(b.Send) {
+			b.recent = b.recent[1:]
+		}
+	default:
+		b.log.Warning("send queue full, closing connection", "queue_size", cap(b.Send))
+		metrics.MessagesDropped.WithLabelValues("queue_full").Inc()
+		metrics.SlowConsumerDisconnects.Inc()
+		b.closed = true
+		close(b.Send)
+	}
+}
+
+// Close closes the queue so the transport disconnects the client after
+// sending what is already queued. Later messages are dropped.
+func (b *Base) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		close(b.Send)
+	}
+}
+
+// Closed reports whether the queue was closed, because it overflowed or
+// the client was disconnected
+func (b *Base) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// Rewind replaces the queue with every event after lastSeq, in order, so a
+// resumed connection picks up exactly where its client stopped reading. It
+// must only be called while nothing drains Send. It reports false when the
+// queue was closed or lastSeq is older than the events still buffered.
+func (b *Base) Rewind(lastSeq uint64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || lastSeq > b.seq {
+		return false
+	}
+	if len(b.recent) > 0 && lastSeq+1 < b.recent[0].Seq {
+		return false
+	}
+
+	// Everything still queued is in recent as well
+	for len(b.Send) > 0 {
+		<-b.Send
+	}
+	// recent is no longer than the queue, so this never blocks
+	for _, message := range b.recent {
+		if message.Seq > lastSeq {
+			b.Send <- message
+		}
+	}
+	return true
+}
+
+// Handle runs one client request on behalf of conn, within the frame rate
+// limit and its own trace. It returns the ID of the message the request
+// created, if any. Every transport funnels its requests through here so they
+// share the same semantics.
+func Handle(hub Hub, conn Connection, req *protocol.Request) (id string, err error) {
+	user := conn.GetUser()
+	_, span := tracing.Start(context.Background(), conn.Transport()+".frame",
+		tracing.WithKind(tracing.SpanKindConsumer),
+		tracing.WithAttributes(
+			tracing.Attr(logger.ConnectionID, conn.ConnectionID()),
+			tracing.Attr(logger.UserID, user.ID),
+			tracing.Attr("op", req.Op),
+		))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	if err := allow(conn, ratelimit.OpFrames, conn.ConnectionID()); err != nil {
+		return "", err
+	}
+
+	switch p := req.Payload.(type) {
+	case *protocol.SendMessage:
+		if err := allow(conn, ratelimit.OpMessages, user.ID); err != nil {
+			return "", err
+		}
+		if err := markdown.Validate(p.Format, p.Content); err != nil {
+			return "", err
+		}
+		message := newMessage(user, models.MessageTypeText, p.Content)
+		message.Format = p.Format
+		message.TraceParent = span.TraceParent()
+		if p.Room != "" {
+			// Group message
+			if p.Room != conn.GetRoomID() {
+				return "", models.ErrNotMember
+			}
+			// Slash commands are run rather than sent
+			if inv, ok := command.Parse(p.Content); ok {
+				inv.Room = p.Room
+				inv.User = user
+				inv.ConnectionID = conn.ConnectionID()
+				conn.Logger().Debug("command run", "command", inv.Name, logger.RoomID, p.Room)
+				return "", command.Commands.Run(hub, inv)
+			}
+			message.Room = p.Room
+			if err := moderation.Apply(message); err != nil {
+				return "", err
+			}
+			return message.ID, hub.Broadcast(message)
+		} else if p.Recipient != "" {
+			// Private message
+			message.Type = models.MessageTypePrivate
+			message.Recipient = p.Recipient
+			if err := moderation.Apply(message); err != nil {
+				return "", err
+			}
+			if err := hub.SendToUser(p.Recipient, message); err != nil {
+				return "", err
+			}
+			// Also send back to sender for confirmation
+			conn.SendMessage(message)
+			return message.ID, nil
+		}
+		return "", &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: "Either room or recipient must be specified"}
+	case *protocol.Typing:
+		if err := allow(conn, ratelimit.OpTyping, user.ID); err != nil {
+			return "", err
+		}
+		// Typing indicators only go to the sender's current room
+		if p.Room == "" || p.Room != conn.GetRoomID() {
+			return "", models.ErrNotMember
+		}
+		if err := moderation.Sanctions.Check(user.ID, p.Room); err != nil {
+			return "", err
+		}
+		message := newMessage(user, models.MessageTypeTyping, "")
+		message.Room = p.Room
+		message.TraceParent = span.TraceParent()
+		return "", hub.Broadcast(message)
+	case *protocol.JoinRoom:
+		if err := allow(conn, ratelimit.OpJoins, user.ID); err != nil {
+			return "", err
+		}
+		if p.Room == "" {
+			return "", &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: "Room is required"}
+		}
+		return "", hub.JoinRoom(conn, p.Room)
+	case *protocol.LeaveRoom:
+		return "", hub.LeaveRoom(conn, p.Room)
+	case *protocol.Moderate:
+		if !moderation.IsModerator(user) {
+			return "", &models.CodedError{Code: models.ErrorCodeUnauthorized, Message: "Only moderators can " + req.Op}
+		}
+		conn.Logger().Info("moderator action", "op", req.Op, "target_id", p.UserID, logger.RoomID, p.Room)
+		return "", Moderate(hub, user.ID, user.Username, req.Op, p)
+	case *protocol.Block:
+		if p.UserID == "" || p.UserID == user.ID {
+			return "", &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: "user_id must name another user"}
+		}
+		if req.Op == protocol.OpBlock {
+			conn.Logger().Info("user blocked", "target_id", p.UserID)
+			return "", privacy.Users.Block(user.ID, p.UserID)
+		}
+		unblocked, err := privacy.Users.Unblock(user.ID, p.UserID)
+		if err != nil {
+			return "", err
+		}
+		if !unblocked {
+			return "", &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: fmt.Sprintf("%s is not blocked", p.UserID)}
+		}
+		conn.Logger().Info("user unblocked", "target_id", p.UserID)
+		return "", nil
+	case *protocol.SetPrivacy:
+		if p.DirectMessages != "" && !slices.Contains(config.DirectMessagePolicies, p.DirectMessages) {
+			return "", &models.CodedError{
+				Code:    models.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("direct_messages must be one of %s", strings.Join(config.DirectMessagePolicies, ", ")),
+			}
+		}
+		conn.Logger().Info("privacy settings changed", "direct_messages", p.DirectMessages, "hidden", p.Hidden)
+		return "", privacy.Users.SetPrivacy(user.ID, p.DirectMessages, p.Hidden)
+	case *protocol.RegisterCommand:
+		if !user.Bot {
+			return "", &models.CodedError{Code: models.ErrorCodeUnauthorized, Message: "Only bots can " + req.Op}
+		}
+		if err := command.Commands.Register(command.Command{
+			Name:        p.Name,
+			Usage:       p.Usage,
+			Description: p.Description,
+			Permission:  p.Permission,
+			Bot:         user.ID,
+		}); err != nil {
+			return "", err
+		}
+		conn.Logger().Info("command registered", "command", p.Name)
+		return "", nil
+	case *protocol.UnregisterCommand:
+		if !user.Bot {
+			return "", &models.CodedError{Code: models.ErrorCodeUnauthorized, Message: "Only bots can " + req.Op}
+		}
+		if !command.Commands.Unregister(user.ID, p.Name) {
+			return "", &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: fmt.Sprintf("/%s is not registered by you", p.Name)}
+		}
+		conn.Logger().Info("command unregistered", "command", p.Name)
+		return "", nil
+	case *protocol.CommandResponse:
+		if !user.Bot {
+			return "", &models.CodedError{Code: models.ErrorCodeUnauthorized, Message: "Only bots can " + req.Op}
+		}
+		if err := allow(conn, ratelimit.OpMessages, user.ID); err != nil {
+			return "", err
+		}
+		return "", command.Commands.Respond(hub, user, p.InvocationID, &command.Reply{Text: p.Text, Visibility: p.Visibility})
+	}
+	return "", &models.CodedError{
+		Code:    models.ErrorCodeUnknownType,
+		Message: fmt.Sprintf("Unknown operation %q", req.Op),
+	}
+}
+
+// newMessage creates a message sent by user
+func newMessage(user *models.User, msgType models.MessageType, content string) *models.Message {
+	return &models.Message{
+		ID:        uuid.New().String(),
+		Type:      msgType,
+		Content:   content,
+		Sender:    user.Username,
+		SenderID:  user.ID,
+		Timestamp: time.Now(),
+		Bot:       user.Bot,
+	}
+}
+
+// allow applies a rate limit, returning a rate_limited error when it was exceeded
+func allow(conn Connection, op ratelimit.Op, key string) error {
+	ok, retryAfter := ratelimit.Allow(op, key)
+	if ok {
+		return nil
+	}
+
+	conn.Logger().Debug("rate limited", "op", string(op), "retry_after_ms", retryAfter.Milliseconds())
+	return &models.CodedError{
+		Code:       models.ErrorCodeRateLimited,
+		Message:    fmt.Sprintf("Too many %s, slow down", op),
+		RetryAfter: retryAfter,
+	}
+}
+
+// ErrorReply builds the error frame reporting a failed request. Errors
+// without a code are logged and reported as internal errors.
+func ErrorReply(conn Connection, requestID string, err error) *models.Message {
+	var coded *models.CodedError
+	if !errors.As(err, &coded) {
+		conn.Logger().Error("request failed", "error", err)
+		coded = &models.CodedError{Code: models.ErrorCodeInternal, Message: "Internal error"}
+	}
+
+	errMessage := models.NewErrorMessage(coded.Code, coded.Message)
+	errMessage.RequestID = requestID
+	errMessage.Error.RetryAfterMs = coded.RetryAfter.Milliseconds()
+	return errMessage
+}
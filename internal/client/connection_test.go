@@ -0,0 +1,73 @@
+package client
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/models"
+	"slices"
+	"testing"
+)
+
+// drain returns the sequence numbers of everything queued on b
+func drain(b *Base) []uint64 {
+	var seqs []uint64
+	for len(b.Send) > 0 {
+		seqs = append(seqs, (<-b.Send).Seq)
+	}
+	return seqs
+}
+
+func TestRewind(t *testing.T) {
+	cfg := config.Default()
+	cfg.WebSocket.SendBufferSize = 4
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	b := NewBase(&models.User{ID: "alice"}, logger.With())
+	send := func(n int) {
+		for range n {
+			b.SendMessage(&models.Message{Type: models.MessageTypeText})
+		}
+	}
+
+	send(3)
+	if got := drain(b); !slices.Equal(got, []uint64{1, 2, 3}) {
+		t.Fatalf("queued seqs = %v, want [1 2 3]", got)
+	}
+
+	// The client only read up to 1; 2 and 3 were lost with the connection
+	if !b.Rewind(1) {
+		t.Fatal("Rewind(1) = false")
+	}
+	if got := drain(b); !slices.Equal(got, []uint64{2, 3}) {
+		t.Errorf("replayed seqs = %v, want [2 3]", got)
+	}
+
+	// Nothing missed replays nothing
+	if !b.Rewind(3) || len(b.Send) != 0 {
+		t.Error("Rewind(3) should succeed with an empty queue")
+	}
+	// The client can't have seen events that weren't sent
+	if b.Rewind(4) {
+		t.Error("Rewind(4) = true past the last event")
+	}
+
+	// Only the last cap(Send) events are kept
+	send(4)
+	drain(b)
+	if b.Rewind(2) {
+		t.Error("Rewind(2) = true though event 3 is no longer buffered")
+	}
+	if !b.Rewind(3) {
+		t.Fatal("Rewind(3) = false though events 4 to 7 are buffered")
+	}
+	if got := drain(b); !slices.Equal(got, []uint64{4, 5, 6, 7}) {
+		t.Errorf("replayed seqs = %v, want [4 5 6 7]", got)
+	}
+
+	// A queue that overflowed was closed and can't be resumed
+	send(5)
+	if !b.Closed() || b.Rewind(7) {
+		t.Error("Rewind = true after the queue overflowed")
+	}
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"chatstreamapp/internal/audit"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/moderation"
+	"chatstreamapp/internal/protocol"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Moderate carries out a moderator operation: mute, unmute, kick, ban or
+// unban. actor identifies the moderator in the sanction list and audit log,
+// and name in the system message announcing the action to the room.
+func Moderate(hub Hub, actor, name, op string, p *protocol.Moderate) error {
+	if p.UserID == "" {
+		return &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: "user_id is required"}
+	}
+	if p.DurationMs < 0 {
+		return &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: "duration_ms must not be negative"}
+	}
+	duration := time.Duration(p.DurationMs) * time.Millisecond
+
+	// The target may be offline; sanctions apply when they come back
+	target, online := hub.GetUsers()[p.UserID]
+	targetName := p.UserID
+	if online {
+		targetName = target.GetUser().Username
+	}
+
+	var announcement string
+	switch op {
+	case protocol.OpMute, protocol.OpBan:
+		kind := moderation.Mute
+		if op == protocol.OpBan {
+			kind = moderation.Ban
+		}
+		sanction := moderation.Sanction{
+			Kind:      kind,
+			UserID:    p.UserID,
+			Room:      p.Room,
+			Reason:    p.Reason,
+			By:        actor,
+			CreatedAt: time.Now(),
+		}
+		if duration > 0 {
+			expires := sanction.CreatedAt.Add(duration)
+			sanction.ExpiresAt = &expires
+		}
+		if err := moderation.Sanctions.Add(sanction); err != nil {
+			return err
+		}
+		if kind == moderation.Ban && p.Room != "" {
+			// Take them out of the room if they are in it
+			if err := hub.Kick(p.UserID, p.Room); err != nil && !errors.Is(err, models.ErrNotMember) && !errors.Is(err, models.ErrRoomNotFound) {
+				return err
+			}
+		}
+
+		verb := "muted"
+		if kind == moderation.Ban {
+			verb = "banned"
+			if p.Room != "" {
+				verb = "banned from the room"
+			}
+		}
+		if duration > 0 {
+			verb += " for " + formatDuration(duration)
+		}
+		announcement = fmt.Sprintf("%s was %s by %s", targetName, verb, name)
+
+	case protocol.OpUnmute, protocol.OpUnban:
+		kind := moderation.Mute
+		if op == protocol.OpUnban {
+			kind = moderation.Ban
+		}
+		lifted, err := moderation.Sanctions.Remove(kind, p.UserID, p.Room)
+		if err != nil {
+			return err
+		}
+		if !lifted {
+			return &models.CodedError{
+				Code:    models.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("%s has no %s to lift", p.UserID, kind),
+			}
+		}
+		if op == protocol.OpUnmute {
+			announcement = fmt.Sprintf("%s was unmuted by %s", targetName, name)
+		}
+
+	case protocol.OpKick:
+		if p.Room == "" {
+			return &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: "room is required"}
+		}
+		if err := hub.Kick(p.UserID, p.Room); err != nil {
+			return err
+		}
+		announcement = fmt.Sprintf("%s was removed from the room by %s", targetName, name)
+
+	default:
+		return &models.CodedError{Code: models.ErrorCodeUnknownType, Message: fmt.Sprintf("Unknown operation %q", op)}
+	}
+
+	entry := audit.Entry{
+		Actor:  actor,
+		Action: "user." + op,
+		UserID: p.UserID,
+		Room:   p.Room,
+		Reason: p.Reason,
+	}
+	if duration > 0 {
+		entry.Details = map[string]string{"duration_ms": strconv.FormatInt(p.DurationMs, 10)}
+	}
+	audit.Record(entry)
+
+	if announcement == "" {
+		return nil
+	}
+	if p.Reason != "" {
+		announcement += ": " + p.Reason
+	}
+	room := p.Room
+	if room == "" && online {
+		room = target.GetRoomID()
+	}
+	announce(hub, room, announcement)
+
+	if !online {
+		return nil
+	}
+	// Users who were kicked, or who are elsewhere, won't see the
+	// announcement in the room
+	if target.GetRoomID() != room || room == "" {
+		target.SendMessage(systemMessage(announcement))
+	}
+	if op == protocol.OpBan && p.Room == "" {
+		if err := hub.Disconnect(p.UserID); err != nil && !errors.Is(err, models.ErrUserNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// announce sends a system message to a room. Rooms that don't exist yet are
+// skipped.
+func announce(hub Hub, room, text string) {
+	if room == "" {
+		return
+	}
+	message := systemMessage(text)
+	message.Room = room
+	if err := hub.Broadcast(message); err != nil && !errors.Is(err, models.ErrRoomNotFound) {
+		logger.Warning("failed to announce moderator action", logger.RoomID, room, "error", err)
+	}
+}
+
+// systemMessage creates a message from the server
+func systemMessage(text string) *models.Message {
+	return newMessage(&models.User{Username: "System"}, models.MessageTypeSystem, text)
+}
+
+// formatDuration renders a duration without trailing zero units, e.g. "10m"
+// rather than "10m0s"
+func formatDuration(d time.Duration) string {
+	s := d.Round(time.Second).String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,166 @@
+package command
+
+import (
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/moderation"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// builtins returns the commands the server handles itself
+func builtins() []*Command {
+	return []*Command{
+		{
+			Name:        "help",
+			Usage:       "[command]",
+			Description: "List the commands you can use, or describe one",
+			Permission:  Everyone,
+			handler:     help,
+		},
+		{
+			Name:        "me",
+			Usage:       "<action>",
+			Description: "Describe what you're doing, e.g. /me waves",
+			Permission:  Everyone,
+			handler:     me,
+		},
+		{
+			Name:        "invite",
+			Usage:       "<user_id>",
+			Description: "Invite a user to this room",
+			Permission:  Everyone,
+			handler:     invite,
+		},
+		{
+			Name:        "topic",
+			Usage:       "<topic>",
+			Description: "Set this room's topic",
+			Permission:  Moderator,
+			handler:     topic,
+		},
+	}
+}
+
+// help lists the commands the user may run, or describes one
+func help(r *Registry, hub Hub, inv *Invocation) (*Reply, error) {
+	commands := r.List(inv.User)
+	if len(inv.Args) > 0 {
+		name := strings.ToLower(strings.TrimPrefix(inv.Args[0], "/"))
+		for _, cmd := range commands {
+			if cmd.Name == name {
+				return &Reply{Text: describe(cmd), Visibility: Ephemeral}, nil
+			}
+		}
+		return nil, &models.CodedError{
+			Code:    models.ErrorCodeUnknownCommand,
+			Message: fmt.Sprintf("Unknown command /%s. Type /help for a list.", name),
+		}
+	}
+
+	lines := make([]string, 0, len(commands)+1)
+	lines = append(lines, "Commands:")
+	for _, cmd := range commands {
+		lines = append(lines, describe(cmd))
+	}
+	return &Reply{Text: strings.Join(lines, "\n"), Visibility: Ephemeral}, nil
+}
+
+// describe renders a command's usage line
+func describe(cmd Command) string {
+	line := "/" + cmd.Name
+	if cmd.Usage != "" {
+		line += " " + cmd.Usage
+	}
+	if cmd.Description != "" {
+		line += " - " + cmd.Description
+	}
+	return line
+}
+
+// me sends an action to the room
+func me(r *Registry, hub Hub, inv *Invocation) (*Reply, error) {
+	if inv.Text == "" {
+		return nil, usage("me")
+	}
+	message := &models.Message{
+		ID:        uuid.New().String(),
+		Type:      models.MessageTypeAction,
+		Content:   inv.Text,
+		Sender:    inv.User.Username,
+		SenderID:  inv.User.ID,
+		Room:      inv.Room,
+		Timestamp: time.Now(),
+		Bot:       inv.User.Bot,
+	}
+	if err := moderation.Apply(message); err != nil {
+		return nil, err
+	}
+	return nil, hub.Broadcast(message)
+}
+
+// invite sends a user a private message asking them to join the room. It is
+// from the inviter, so it is subject to the invitee's privacy settings.
+func invite(r *Registry, hub Hub, inv *Invocation) (*Reply, error) {
+	if len(inv.Args) != 1 {
+		return nil, usage("invite")
+	}
+	userID := inv.Args[0]
+	if userID == inv.User.ID {
+		return nil, invalid("You can't invite yourself")
+	}
+	// The hub changes room members as users come and go, so it checks
+	// membership under its lock; a room's name never changes
+	room, ok := hub.GetRooms()[inv.Room]
+	if !ok {
+		return nil, models.ErrRoomNotFound
+	}
+	member, err := hub.IsMember(room.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if member {
+		return nil, invalid("%s is already in %s", userID, room.Name)
+	}
+
+	message := &models.Message{
+		ID:        uuid.New().String(),
+		Type:      models.MessageTypePrivate,
+		Content:   fmt.Sprintf("%s invited you to join %s (room ID %s)", inv.User.Username, room.Name, room.ID),
+		Sender:    inv.User.Username,
+		SenderID:  inv.User.ID,
+		Recipient: userID,
+		Timestamp: time.Now(),
+		Bot:       inv.User.Bot,
+	}
+	if err := moderation.Apply(message); err != nil {
+		return nil, err
+	}
+	if err := hub.SendToUser(userID, message); err != nil {
+		return nil, err
+	}
+	return &Reply{Text: fmt.Sprintf("Invited %s to %s", userID, room.Name), Visibility: Ephemeral}, nil
+}
+
+// topic sets the room's topic and tells the room
+func topic(r *Registry, hub Hub, inv *Invocation) (*Reply, error) {
+	if inv.Text == "" {
+		return nil, usage("topic")
+	}
+	if err := hub.SetTopic(inv.Room, inv.Text); err != nil {
+		return nil, err
+	}
+	return &Reply{Text: fmt.Sprintf("%s set the topic to: %s", inv.User.Username, inv.Text), Visibility: InRoom}, nil
+}
+
+// usage returns the error for a built-in run with the wrong arguments
+func usage(name string) error {
+	for _, cmd := range builtins() {
+		if cmd.Name == name {
+			return invalid("Usage: %s", describe(*cmd))
+		}
+	}
+	return invalid("Usage: /%s", name)
+}
@@ -0,0 +1,63 @@
+package command
+
+import (
+	"chatstreamapp/internal/models"
+	"strings"
+	"testing"
+)
+
+// fakeHub is a hub with one room, "general", holding alice and bob
+type fakeHub struct {
+	Hub
+	sent []*models.Message
+}
+
+func (h *fakeHub) GetRooms() map[string]*models.Room {
+	return map[string]*models.Room{"general": {ID: "general", Name: "General Chat"}}
+}
+
+func (h *fakeHub) IsMember(roomID, userID string) (bool, error) {
+	if roomID != "general" {
+		return false, models.ErrRoomNotFound
+	}
+	return userID == "alice" || userID == "bob", nil
+}
+
+func (h *fakeHub) SendToUser(userID string, message *models.Message) error {
+	h.sent = append(h.sent, message)
+	return nil
+}
+
+func TestInvite(t *testing.T) {
+	alice := &models.User{ID: "alice", Username: "alice"}
+
+	tests := []struct {
+		name string
+		args []string
+		want string // reply text, or error message
+	}{
+		{"outside the room", []string{"carol"}, "Invited carol to General Chat"},
+		{"already a member", []string{"bob"}, "bob is already in General Chat"},
+		{"yourself", []string{"alice"}, "You can't invite yourself"},
+		{"no user", nil, "Usage: /invite <user_id>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := &fakeHub{}
+			reply, err := invite(NewRegistry(), hub, &Invocation{Name: "invite", Args: tt.args, Room: "general", User: alice})
+
+			var got string
+			if err != nil {
+				got = err.Error()
+			} else {
+				got = reply.Text
+			}
+			if !strings.HasPrefix(got, tt.want) {
+				t.Fatalf("invite() = %q, want %q", got, tt.want)
+			}
+			if invited := err == nil; invited != (len(hub.sent) == 1) {
+				t.Fatalf("sent %d invitations", len(hub.sent))
+			}
+		})
+	}
+}
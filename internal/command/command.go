@@ -0,0 +1,381 @@
+package command
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/moderation"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Who may run a command
+const (
+	Everyone  = "everyone"
+	Moderator = "moderator"
+)
+
+// Permissions are the permissions a command can require
+var Permissions = []string{Everyone, Moderator}
+
+// Who sees a reply
+const (
+	// Only the user who ran the command
+	Ephemeral = "ephemeral"
+
+	// Everyone in the room
+	InRoom = "room"
+)
+
+// Hub is what commands act on
+type Hub interface {
+	Broadcast(message *models.Message) error
+	SendToUser(userID string, message *models.Message) error
+	SendEphemeral(userID, connectionID string, message *models.Message) error
+	SetTopic(roomID, topic string) error
+	IsMember(roomID, userID string) (bool, error)
+	GetRooms() map[string]*models.Room
+}
+
+// Invocation is one run of a command, in the room it was typed in
+type Invocation struct {
+	Name string
+	Args []string
+
+	// Everything after the name, as typed
+	Text string
+
+	Room string
+	User *models.User
+
+	// The connection the command was typed on, which ephemeral replies go to
+	ConnectionID string
+}
+
+// Reply is what a command answers with
+type Reply struct {
+	Text string
+
+	// Ephemeral or InRoom
+	Visibility string
+}
+
+// Handler runs a built-in command from the registry r. It returns nil when
+// there is nothing to reply.
+type Handler func(r *Registry, hub Hub, inv *Invocation) (*Reply, error)
+
+// Command is a slash command users can run
+type Command struct {
+	Name string `json:"name"`
+
+	// Arguments as shown by /help, e.g. "<user_id>"
+	Usage string `json:"usage,omitempty"`
+
+	Description string `json:"description,omitempty"`
+
+	// Everyone or Moderator
+	Permission string `json:"permission"`
+
+	// User ID of the bot that handles the command; empty for built-ins
+	Bot string `json:"bot,omitempty"`
+
+	handler Handler
+}
+
+// pending is a bot command waiting for the bot's response
+type pending struct {
+	name string
+	bot  string
+
+	// Where the command was run, which replies go back to
+	room string
+	user string
+	conn string
+
+	// Whether the bot has responded yet
+	answered bool
+}
+
+// Registry holds the commands users can run and the invocations bots are
+// still answering
+type Registry struct {
+	mu       sync.Mutex
+	commands map[string]*Command
+	pending  map[string]*pending
+}
+
+// NewRegistry creates a registry holding the built-in commands
+func NewRegistry() *Registry {
+	r := &Registry{
+		commands: make(map[string]*Command),
+		pending:  make(map[string]*pending),
+	}
+	for _, cmd := range builtins() {
+		r.commands[cmd.Name] = cmd
+	}
+	return r
+}
+
+// Commands is the server's command registry
+var Commands = NewRegistry()
+
+// namePattern matches a command name
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// Parse reads a slash command from message content: a slash, the command
+// name and whitespace-separated arguments. ok is false for anything else,
+// which is sent as an ordinary message.
+func Parse(content string) (inv *Invocation, ok bool) {
+	rest, found := strings.CutPrefix(content, "/")
+	if !found {
+		return nil, false
+	}
+	end := strings.IndexFunc(rest, unicode.IsSpace)
+	if end < 0 {
+		end = len(rest)
+	}
+	name := strings.ToLower(rest[:end])
+	if !namePattern.MatchString(name) {
+		return nil, false
+	}
+	text := strings.TrimSpace(rest[end:])
+	return &Invocation{Name: name, Args: strings.Fields(text), Text: text}, true
+}
+
+// Register adds a command handled by a bot. A bot registering a name again
+// replaces its earlier registration; names taken by built-ins or other bots
+// are refused.
+func (r *Registry) Register(cmd Command) error {
+	cmd.Name = strings.ToLower(cmd.Name)
+	if !namePattern.MatchString(cmd.Name) {
+		return invalid("name must be 1 to 32 lowercase letters, digits, _ or -, starting with a letter")
+	}
+	if cmd.Permission == "" {
+		cmd.Permission = Everyone
+	}
+	if !slices.Contains(Permissions, cmd.Permission) {
+		return invalid("permission must be one of %s", strings.Join(Permissions, ", "))
+	}
+	if cmd.Bot == "" {
+		return errors.New("bot commands need a bot")
+	}
+	cmd.handler = nil
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.commands[cmd.Name]; ok && existing.Bot != cmd.Bot {
+		return invalid("/%s is already taken", cmd.Name)
+	}
+	r.commands[cmd.Name] = &cmd
+	return nil
+}
+
+// Unregister removes a command a bot registered, reporting false if it had
+// none by that name
+func (r *Registry) Unregister(botID, name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd, ok := r.commands[strings.ToLower(name)]
+	if !ok || cmd.Bot != botID {
+		return false
+	}
+	delete(r.commands, cmd.Name)
+	return true
+}
+
+// DropBot removes every command a bot registered, e.g. when the bot is
+// deleted
+func (r *Registry) DropBot(botID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, cmd := range r.commands {
+		if cmd.Bot == botID {
+			delete(r.commands, name)
+		}
+	}
+}
+
+// List returns the commands user may run, by name
+func (r *Registry) List(user *models.User) []Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var list []Command
+	for _, cmd := range r.commands {
+		if allowed(cmd, user) {
+			list = append(list, *cmd)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// All returns every command, by name
+func (r *Registry) All() []Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]Command, 0, len(r.commands))
+	for _, cmd := range r.commands {
+		list = append(list, *cmd)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// lookup returns the command by name, or nil
+func (r *Registry) lookup(name string) *Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.commands[name]
+}
+
+// Run runs a command on behalf of its user. Built-ins run here; bot commands
+// are sent to their bot, which answers with Respond.
+func (r *Registry) Run(hub Hub, inv *Invocation) error {
+	cmd := r.lookup(inv.Name)
+	if cmd == nil {
+		return &models.CodedError{
+			Code:    models.ErrorCodeUnknownCommand,
+			Message: fmt.Sprintf("Unknown command /%s. Type /help for a list.", inv.Name),
+		}
+	}
+	if !allowed(cmd, inv.User) {
+		return &models.CodedError{Code: models.ErrorCodeUnauthorized, Message: fmt.Sprintf("Only moderators can use /%s", cmd.Name)}
+	}
+
+	if cmd.handler != nil {
+		reply, err := cmd.handler(r, hub, inv)
+		if err != nil || reply == nil {
+			return err
+		}
+		return send(hub, &pending{room: inv.Room, user: inv.User.ID, conn: inv.ConnectionID}, nil, reply)
+	}
+
+	id := uuid.New().String()
+	message := &models.Message{
+		ID:        uuid.New().String(),
+		Type:      models.MessageTypeCommand,
+		Sender:    "System",
+		Room:      inv.Room,
+		Timestamp: time.Now(),
+		Command: &models.Invocation{
+			ID:       id,
+			Name:     cmd.Name,
+			Args:     inv.Args,
+			Text:     inv.Text,
+			Room:     inv.Room,
+			UserID:   inv.User.ID,
+			Username: inv.User.Username,
+		},
+	}
+
+	p := &pending{name: cmd.Name, bot: cmd.Bot, room: inv.Room, user: inv.User.ID, conn: inv.ConnectionID}
+	r.mu.Lock()
+	r.pending[id] = p
+	r.mu.Unlock()
+	time.AfterFunc(config.Get().Bots.ResponseTimeout.Duration(), func() { r.expire(hub, id) })
+
+	if err := hub.SendToUser(cmd.Bot, message); err != nil {
+		r.mu.Lock()
+		delete(r.pending, id)
+		r.mu.Unlock()
+		if errors.Is(err, models.ErrUserNotFound) {
+			return &models.CodedError{Code: models.ErrorCodeUserNotFound, Message: fmt.Sprintf("The bot handling /%s isn't connected", cmd.Name)}
+		}
+		return err
+	}
+	return nil
+}
+
+// Respond delivers a bot's response to a command it was sent
+func (r *Registry) Respond(hub Hub, bot *models.User, invocationID string, reply *Reply) error {
+	if reply.Visibility == "" {
+		reply.Visibility = Ephemeral
+	}
+	if reply.Visibility != Ephemeral && reply.Visibility != InRoom {
+		return invalid("visibility must be %s or %s", Ephemeral, InRoom)
+	}
+	if strings.TrimSpace(reply.Text) == "" {
+		return invalid("text is required")
+	}
+
+	r.mu.Lock()
+	p, ok := r.pending[invocationID]
+	if ok && p.bot == bot.ID {
+		p.answered = true
+	}
+	r.mu.Unlock()
+	if !ok || p.bot != bot.ID {
+		return invalid("Unknown or expired invocation %q", invocationID)
+	}
+	return send(hub, p, bot, reply)
+}
+
+// expire forgets an invocation once its bot can no longer respond, telling
+// the user when the bot never did
+func (r *Registry) expire(hub Hub, invocationID string) {
+	r.mu.Lock()
+	p, ok := r.pending[invocationID]
+	delete(r.pending, invocationID)
+	r.mu.Unlock()
+	if !ok || p.answered {
+		return
+	}
+
+	notice := &Reply{Text: fmt.Sprintf("/%s didn't respond", p.name), Visibility: Ephemeral}
+	if err := send(hub, p, nil, notice); err != nil {
+		// The user left the room or disconnected meanwhile
+		logger.Debug("command timeout not delivered", "command", p.name, logger.UserID, p.user, "error", err)
+	}
+}
+
+// send delivers a reply to where a command was run, from a bot or, when bot
+// is nil, from the server. Ephemeral replies appear in the room for the
+// command's connection only.
+func send(hub Hub, to *pending, bot *models.User, reply *Reply) error {
+	message := &models.Message{
+		ID:        uuid.New().String(),
+		Type:      models.MessageTypeSystem,
+		Content:   reply.Text,
+		Sender:    "System",
+		Room:      to.room,
+		Timestamp: time.Now(),
+	}
+	if bot != nil {
+		message.Type = models.MessageTypeText
+		message.Sender = bot.Username
+		message.SenderID = bot.ID
+		message.Bot = true
+	}
+
+	if reply.Visibility == Ephemeral {
+		return hub.SendEphemeral(to.user, to.conn, message)
+	}
+	if bot != nil {
+		if err := moderation.Apply(message); err != nil {
+			return err
+		}
+	}
+	return hub.Broadcast(message)
+}
+
+// allowed reports whether user may run cmd
+func allowed(cmd *Command, user *models.User) bool {
+	return cmd.Permission != Moderator || moderation.IsModerator(user)
+}
+
+func invalid(format string, args ...any) error {
+	return &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: fmt.Sprintf(format, args...)}
+}
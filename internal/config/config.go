@@ -0,0 +1,837 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Config holds all server settings
+type Config struct {
+	// "development" or "production"; selects defaults for settings the
+	// file leaves out. Overridable with CHAT_ENV.
+	Environment string `json:"environment"`
+
+	Server        ServerConfig        `json:"server"`
+	Log           LogConfig           `json:"log"`
+	CORS          CORSConfig          `json:"cors"`
+	WebSocket     WebSocketConfig     `json:"websocket"`
+	Fallback      FallbackConfig      `json:"fallback"`
+	Hub           HubConfig           `json:"hub"`
+	Announcements AnnouncementsConfig `json:"announcements"`
+	Moderation    ModerationConfig    `json:"moderation"`
+	Audit         AuditConfig         `json:"audit"`
+	Privacy       PrivacyConfig       `json:"privacy"`
+	Webhooks      WebhooksConfig      `json:"webhooks"`
+	Bots          BotsConfig          `json:"bots"`
+	Admin         AdminConfig         `json:"admin"`
+	Tracing       TracingConfig       `json:"tracing"`
+	RateLimit     RateLimitConfig     `json:"rate_limit"`
+}
+
+// ServerConfig holds listener settings. Changes to the address and TLS
+// settings require a restart.
+type ServerConfig struct {
+	Addr string    `json:"addr"`
+	TLS  TLSConfig `json:"tls"`
+
+	// How long /readyz reports draining before the listener closes,
+	// giving load balancers time to stop sending traffic
+	DrainDelay Duration `json:"drain_delay"`
+
+	// How long in-flight HTTP requests get to finish on shutdown
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+}
+
+// TLSConfig enables HTTPS/WSS on the main listener
+type TLSConfig struct {
+	// PEM certificate and key. TLS is enabled when both are set.
+	// The files are watched and re-read when they change on disk.
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+
+	// PEM bundle of CAs trusted to sign client certificates
+	ClientCAFile string `json:"client_ca_file"`
+
+	// Client certificate policy: "none", "optional" or "require"
+	ClientAuth string `json:"client_auth"`
+
+	// Plain HTTP listener that redirects to HTTPS. Empty disables it.
+	RedirectAddr string `json:"redirect_addr"`
+
+	// How often the certificate files are checked for changes
+	ReloadInterval Duration `json:"reload_interval"`
+}
+
+// Enabled reports whether TLS is configured
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// LogConfig holds logging settings
+type LogConfig struct {
+	// Minimum level: "debug", "info", "warning" or "error"
+	Level string `json:"level"`
+
+	// Output format: "json" or "logfmt". Changes require a restart.
+	Format string `json:"format"`
+}
+
+// CORSConfig controls which browser origins may call the HTTP API and open
+// WebSockets. Same-origin requests and requests without an Origin header
+// (non-browser clients) are always allowed.
+type CORSConfig struct {
+	// Exact origins such as "https://chat.example.com", or
+	// "https://*.example.com" for any subdomain. "*" allows every origin
+	// and is refused in production. Defaults depend on the environment.
+	AllowedOrigins []string `json:"allowed_origins"`
+
+	// Let browsers send cookies and HTTP auth on cross-origin requests.
+	// Can't be combined with "*".
+	AllowCredentials bool `json:"allow_credentials"`
+
+	// How long browsers may cache preflight responses
+	MaxAge Duration `json:"max_age"`
+}
+
+// WebSocketConfig holds settings used by the client pumps
+type WebSocketConfig struct {
+	// Maximum message size allowed from peer
+	MaxMessageSize int64 `json:"max_message_size"`
+
+	// Time allowed to write a message to the peer
+	WriteWait Duration `json:"write_wait"`
+
+	// Time allowed to read the next pong message from the peer
+	PongWait Duration `json:"pong_wait"`
+
+	// Size of the per-connection send queue. Applies to new connections only.
+	// It also bounds how many events are kept for replay on resume.
+	SendBufferSize int `json:"send_buffer_size"`
+
+	// How long a dropped connection stays in its rooms waiting to be
+	// resumed; 0 disables resumption
+	ResumeGrace Duration `json:"resume_grace"`
+
+	// permessage-deflate settings
+	Compression CompressionConfig `json:"compression"`
+
+	// Coalescing of queued messages into batch frames
+	Batch BatchConfig `json:"batch"`
+}
+
+// CompressionConfig controls permessage-deflate. Enabling or disabling it
+// applies to new connections; level and threshold apply immediately.
+type CompressionConfig struct {
+	// Offer permessage-deflate to clients that ask for it
+	Enabled bool `json:"enabled"`
+
+	// flate level, from 1 (fastest) to 9 (smallest)
+	Level int `json:"level"`
+
+	// Frames smaller than this many bytes are sent uncompressed
+	Threshold int `json:"threshold"`
+}
+
+// BatchConfig controls how writePump coalesces queued messages. Only
+// protocol versions with a batch frame are batched.
+type BatchConfig struct {
+	// How long to wait for more messages after the first one; 0 disables
+	// batching
+	Window Duration `json:"window"`
+
+	// Most messages sent in one batch frame
+	MaxMessages int `json:"max_messages"`
+}
+
+// PingPeriod returns how often pings are sent. Must be less than PongWait.
+func (w WebSocketConfig) PingPeriod() time.Duration {
+	return (w.PongWait.Duration() * 9) / 10
+}
+
+// FallbackConfig holds settings for the SSE and long-polling transports
+// used by clients that can't open a WebSocket
+type FallbackConfig struct {
+	// How long a session survives with no open stream or poll
+	SessionTimeout Duration `json:"session_timeout"`
+
+	// How long a long-poll request waits for events before returning empty
+	PollTimeout Duration `json:"poll_timeout"`
+
+	// Interval between SSE comments that keep idle proxies from closing
+	// the stream
+	KeepAlive Duration `json:"keepalive"`
+}
+
+// HubConfig holds settings used by the hub
+type HubConfig struct {
+	// Number of messages kept in each room's history
+	MaxRoomHistory int `json:"max_room_history"`
+
+	// Rooms reported by ID in chat_room_users. Users in any other room are
+	// summed under room="other", so clients creating rooms can't add
+	// series. Changes require a restart.
+	MetricRooms []string `json:"metric_rooms"`
+}
+
+// AnnouncementsConfig holds the welcome messages and where scheduled
+// announcements are kept. Welcome messages are text/template templates
+// given the user's .Username and, for rooms, the .Room name and .RoomID.
+type AnnouncementsConfig struct {
+	// Sent to every new connection; empty sends none
+	Welcome string `json:"welcome"`
+
+	// Sent to a user joining a room, by room ID. "*" applies to rooms
+	// without their own.
+	RoomWelcome map[string]string `json:"room_welcome"`
+
+	// JSON file scheduled announcements are kept in so they survive
+	// restarts. Empty keeps them in memory only. Changes require a restart.
+	File string `json:"file"`
+}
+
+// RoomWelcomeFor returns the welcome template for a room, or "" for none
+func (a AnnouncementsConfig) RoomWelcomeFor(roomID string) string {
+	if tmpl, ok := a.RoomWelcome[roomID]; ok {
+		return tmpl
+	}
+	return a.RoomWelcome["*"]
+}
+
+// ModerationConfig selects the filters chat messages pass through before
+// they are delivered. Each filter's action is "redact", "hold" (queue for
+// review) or "reject"; an empty action turns the filter off.
+type ModerationConfig struct {
+	BannedWords BannedWordsConfig `json:"banned_words"`
+	Rules       []ModerationRule  `json:"rules"`
+	Links       LinksConfig       `json:"links"`
+	Spam        SpamConfig        `json:"spam"`
+
+	// Most messages waiting for review at once; holds beyond it are rejected
+	MaxHeld int `json:"max_held"`
+
+	// Users allowed to mute, kick and ban over the chat protocol. They
+	// prove who they are with their token when connecting.
+	Moderators []Moderator `json:"moderators"`
+
+	// JSON file mutes and bans are kept in so they survive restarts. Empty
+	// keeps them in memory only. Changes require a restart.
+	SanctionsFile string `json:"sanctions_file"`
+}
+
+// Moderator is a user allowed to moderate over the chat protocol
+type Moderator struct {
+	UserID string `json:"user_id"`
+
+	// Secret the moderator connects with
+	Token string `json:"token"`
+}
+
+// BannedWordsConfig matches whole words after folding case, accents,
+// leetspeak, stretched letters and spelled-out letters
+type BannedWordsConfig struct {
+	Words  []string `json:"words"`
+	Action string   `json:"action"`
+}
+
+// ModerationRule applies an action to messages matching a regular expression
+type ModerationRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+
+	// Told to the sender when the message is held or rejected
+	Reason string `json:"reason"`
+}
+
+// LinksConfig blocks URLs other than those on the allowed domains
+type LinksConfig struct {
+	Action string `json:"action"`
+
+	// Links to these domains and their subdomains are let through
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+// SpamConfig flags shouting, stretched characters and repeated messages.
+// Its action is "hold" or "reject"; a zero threshold turns that check off.
+type SpamConfig struct {
+	Action string `json:"action"`
+
+	// Largest share of capital letters, from 0 to 1, in messages with at
+	// least MinCapsLength letters
+	MaxCapsRatio  float64 `json:"max_caps_ratio"`
+	MinCapsLength int     `json:"min_caps_length"`
+
+	// Longest run of one repeated character
+	MaxRepeatedChars int `json:"max_repeated_chars"`
+
+	// How many identical messages a user may send within DuplicateWindow
+	MaxDuplicates   int      `json:"max_duplicates"`
+	DuplicateWindow Duration `json:"duplicate_window"`
+}
+
+// ModerationActions are the actions a filter can take
+var ModerationActions = []string{"redact", "hold", "reject"}
+
+// AuditConfig selects where admin and moderation actions are recorded. Changes
+// require a restart.
+type AuditConfig struct {
+	// JSON lines file entries are appended to. Empty records them in the
+	// structured log only.
+	Path string `json:"path"`
+}
+
+// PrivacyConfig holds the defaults for users' privacy settings
+type PrivacyConfig struct {
+	// Who may send private messages to users who haven't chosen:
+	// "everyone", "shared_room" or "nobody"
+	DirectMessages string `json:"direct_messages"`
+
+	// JSON file block lists and privacy settings are kept in so they
+	// survive restarts. Empty keeps them in memory only. Changes require a
+	// restart.
+	SettingsFile string `json:"settings_file"`
+
+	// Users one user may block. The settings file is rewritten on every
+	// block, so this also bounds its size.
+	MaxBlocked int `json:"max_blocked"`
+}
+
+// DirectMessagePolicies are the accepted direct message settings
+var DirectMessagePolicies = []string{"everyone", "shared_room", "nobody"}
+
+// WebhooksConfig controls how room events are delivered to the HTTP
+// endpoints admins register
+type WebhooksConfig struct {
+	// JSON file registered webhooks are kept in so they survive restarts.
+	// Empty keeps them in memory only. Changes require a restart.
+	File string `json:"file"`
+
+	// Deliveries waiting to be sent; events beyond it go straight to the
+	// dead-letter list. Changes require a restart.
+	QueueSize int `json:"queue_size"`
+
+	// Deliveries sent at once. Changes require a restart.
+	Workers int `json:"workers"`
+
+	// How long an endpoint gets to respond
+	Timeout Duration `json:"timeout"`
+
+	// Attempts before a delivery is dead-lettered
+	MaxAttempts int `json:"max_attempts"`
+
+	// Wait before the first retry, doubling after each failure up to
+	// MaxBackoff
+	InitialBackoff Duration `json:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff"`
+
+	// Delivery attempts kept per webhook
+	LogSize int `json:"log_size"`
+
+	// Failed deliveries kept for inspection and retry
+	MaxDeadLetters int `json:"max_dead_letters"`
+
+	// JSON file incoming webhooks, which post messages into rooms, are
+	// kept in. Empty keeps them in memory only. Changes require a restart.
+	IncomingFile string `json:"incoming_file"`
+
+	// Largest request body an incoming webhook accepts
+	MaxIncomingBytes int64 `json:"max_incoming_bytes"`
+}
+
+// BotsConfig controls bot accounts and the commands they handle
+type BotsConfig struct {
+	// JSON file bot accounts are kept in so they survive restarts. Empty
+	// keeps them in memory only. Changes require a restart.
+	File string `json:"file"`
+
+	// How long a bot may keep answering a command after it was run
+	ResponseTimeout Duration `json:"response_timeout"`
+}
+
+// AdminConfig holds credentials for the admin endpoints
+type AdminConfig struct {
+	Operators []Operator `json:"operators"`
+}
+
+// Operator is a named holder of an admin API token
+type Operator struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+
+	// "admin" (the default) may use the whole admin API; "moderator" only
+	// the moderation endpoints
+	Role string `json:"role"`
+}
+
+// Operator roles
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
+
+// IsAdmin reports whether the operator may use the whole admin API
+func (o Operator) IsAdmin() bool {
+	return o.Role == "" || o.Role == RoleAdmin
+}
+
+// RateLimitConfig holds token-bucket limits per operation type
+type RateLimitConfig struct {
+	// Any inbound WebSocket frame, per connection
+	Frames RateLimit `json:"frames"`
+
+	// Chat messages over WebSocket or REST, per user
+	Messages RateLimit `json:"messages"`
+
+	// Room creation, per user or client IP
+	RoomCreation RateLimit `json:"room_creation"`
+
+	// Room joins, per user
+	Joins RateLimit `json:"joins"`
+
+	// Typing indicators, per user
+	Typing RateLimit `json:"typing"`
+
+	// Messages posted through an incoming webhook, per webhook
+	IncomingWebhooks RateLimit `json:"incoming_webhooks"`
+}
+
+// RateLimit allows Rate operations per second on average, with bursts of up
+// to Burst. A zero rate disables the limit.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// For returns the limit for an operation name
+func (r RateLimitConfig) For(op string) RateLimit {
+	switch op {
+	case "frames":
+		return r.Frames
+	case "messages":
+		return r.Messages
+	case "room_creation":
+		return r.RoomCreation
+	case "joins":
+		return r.Joins
+	case "typing":
+		return r.Typing
+	case "incoming_webhooks":
+		return r.IncomingWebhooks
+	}
+	return RateLimit{}
+}
+
+// TracingConfig selects where trace spans are sent. Only the sample ratio
+// can change without a restart.
+type TracingConfig struct {
+	// "none", "stdout" or "otlp"
+	Exporter string `json:"exporter"`
+
+	// OTLP/HTTP traces endpoint, e.g. http://localhost:4318/v1/traces
+	Endpoint string `json:"endpoint"`
+
+	ServiceName string `json:"service_name"`
+
+	// Fraction of new traces recorded, from 0 to 1
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		Environment: "production",
+		Server: ServerConfig{
+			Addr:            ":8080",
+			DrainDelay:      Duration(5 * time.Second),
+			ShutdownTimeout: Duration(10 * time.Second),
+			TLS: TLSConfig{
+				ClientAuth:     "none",
+				ReloadInterval: Duration(30 * time.Second),
+			},
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "logfmt",
+		},
+		CORS: CORSConfig{
+			MaxAge: Duration(10 * time.Minute),
+		},
+		WebSocket: WebSocketConfig{
+			MaxMessageSize: 512,
+			WriteWait:      Duration(10 * time.Second),
+			PongWait:       Duration(60 * time.Second),
+			SendBufferSize: 256,
+			ResumeGrace:    Duration(30 * time.Second),
+			Compression: CompressionConfig{
+				Enabled:   true,
+				Level:     1,
+				Threshold: 512,
+			},
+			Batch: BatchConfig{
+				MaxMessages: 32,
+			},
+		},
+		Fallback: FallbackConfig{
+			SessionTimeout: Duration(60 * time.Second),
+			PollTimeout:    Duration(25 * time.Second),
+			KeepAlive:      Duration(15 * time.Second),
+		},
+		Hub: HubConfig{
+			MaxRoomHistory: 100,
+			MetricRooms:    []string{"general"},
+		},
+		Announcements: AnnouncementsConfig{
+			Welcome: "Welcome to the chat!",
+			File:    "announcements.json",
+		},
+		Moderation: ModerationConfig{
+			BannedWords: BannedWordsConfig{
+				Action: "redact",
+			},
+			Spam: SpamConfig{
+				MaxCapsRatio:     0.7,
+				MinCapsLength:    12,
+				MaxRepeatedChars: 10,
+				MaxDuplicates:    3,
+				DuplicateWindow:  Duration(time.Minute),
+			},
+			MaxHeld:       500,
+			SanctionsFile: "sanctions.json",
+		},
+		Privacy: PrivacyConfig{
+			DirectMessages: "everyone",
+			SettingsFile:   "privacy.json",
+			MaxBlocked:     1000,
+		},
+		Webhooks: WebhooksConfig{
+			File:             "webhooks.json",
+			QueueSize:        1000,
+			Workers:          4,
+			Timeout:          Duration(10 * time.Second),
+			MaxAttempts:      5,
+			InitialBackoff:   Duration(time.Second),
+			MaxBackoff:       Duration(5 * time.Minute),
+			LogSize:          100,
+			MaxDeadLetters:   1000,
+			IncomingFile:     "incoming_webhooks.json",
+			MaxIncomingBytes: 16 << 10,
+		},
+		Bots: BotsConfig{
+			File:            "bots.json",
+			ResponseTimeout: Duration(time.Minute),
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "chatstream",
+			SampleRatio: 1,
+		},
+		RateLimit: RateLimitConfig{
+			Frames:           RateLimit{Rate: 20, Burst: 40},
+			Messages:         RateLimit{Rate: 5, Burst: 10},
+			RoomCreation:     RateLimit{Rate: 0.1, Burst: 3},
+			Joins:            RateLimit{Rate: 1, Burst: 5},
+			Typing:           RateLimit{Rate: 2, Burst: 4},
+			IncomingWebhooks: RateLimit{Rate: 1, Burst: 10},
+		},
+	}
+}
+
+// Load reads a JSON config file on top of the defaults and validates it.
+// An empty path returns the defaults.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if env := os.Getenv("CHAT_ENV"); env != "" {
+		cfg.Environment = env
+	}
+	if path == "" {
+		cfg.applyEnvironment()
+		return cfg, cfg.Validate()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	cfg.applyEnvironment()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Origins allowed by default in each environment. Production only allows
+// same-origin requests until origins are listed.
+var environmentOrigins = map[string][]string{
+	"development": {"*"},
+	"production":  {},
+}
+
+// applyEnvironment fills in the environment's defaults for settings the
+// file left out
+func (c *Config) applyEnvironment() {
+	if c.CORS.AllowedOrigins == nil {
+		c.CORS.AllowedOrigins = environmentOrigins[c.Environment]
+	}
+}
+
+// Validate checks the config for values the server cannot run with
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+
+	if c.Server.DrainDelay < 0 {
+		errs = append(errs, errors.New("server.drain_delay must not be negative"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout must be positive"))
+	}
+
+	tlsCfg := c.Server.TLS
+	if (tlsCfg.CertFile == "") != (tlsCfg.KeyFile == "") {
+		errs = append(errs, errors.New("server.tls.cert_file and server.tls.key_file must be set together"))
+	}
+	switch tlsCfg.ClientAuth {
+	case "", "none":
+	case "optional", "require":
+		if !tlsCfg.Enabled() {
+			errs = append(errs, errors.New("server.tls.client_auth requires cert_file and key_file"))
+		}
+		if tlsCfg.ClientCAFile == "" {
+			errs = append(errs, errors.New("server.tls.client_auth requires client_ca_file"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("server.tls.client_auth %q must be one of none, optional, require", tlsCfg.ClientAuth))
+	}
+	if tlsCfg.RedirectAddr != "" && !tlsCfg.Enabled() {
+		errs = append(errs, errors.New("server.tls.redirect_addr requires cert_file and key_file"))
+	}
+	if tlsCfg.Enabled() && tlsCfg.ReloadInterval <= 0 {
+		errs = append(errs, errors.New("server.tls.reload_interval must be positive"))
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warning", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level %q must be one of debug, info, warning, error", c.Log.Level))
+	}
+	switch c.Log.Format {
+	case "json", "logfmt":
+	default:
+		errs = append(errs, fmt.Errorf("log.format %q must be json or logfmt", c.Log.Format))
+	}
+
+	if _, ok := environmentOrigins[c.Environment]; !ok {
+		errs = append(errs, fmt.Errorf("environment %q must be development or production", c.Environment))
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			if c.Environment == "production" {
+				errs = append(errs, errors.New(`cors.allowed_origins must not contain "*" in production`))
+			}
+			if c.CORS.AllowCredentials {
+				errs = append(errs, errors.New(`cors.allow_credentials can't be combined with "*" in cors.allowed_origins`))
+			}
+			continue
+		}
+		if err := validOriginPattern(origin); err != nil {
+			errs = append(errs, fmt.Errorf("cors.allowed_origins: %w", err))
+		}
+	}
+	if c.CORS.MaxAge < 0 {
+		errs = append(errs, errors.New("cors.max_age must not be negative"))
+	}
+
+	if c.WebSocket.MaxMessageSize <= 0 {
+		errs = append(errs, errors.New("websocket.max_message_size must be positive"))
+	}
+	if c.WebSocket.WriteWait <= 0 {
+		errs = append(errs, errors.New("websocket.write_wait must be positive"))
+	}
+	if c.WebSocket.PongWait <= 0 {
+		errs = append(errs, errors.New("websocket.pong_wait must be positive"))
+	}
+	if c.WebSocket.SendBufferSize <= 0 {
+		errs = append(errs, errors.New("websocket.send_buffer_size must be positive"))
+	}
+	if c.WebSocket.ResumeGrace < 0 {
+		errs = append(errs, errors.New("websocket.resume_grace must not be negative"))
+	}
+	if level := c.WebSocket.Compression.Level; level < 1 || level > 9 {
+		errs = append(errs, errors.New("websocket.compression.level must be between 1 and 9"))
+	}
+	if c.WebSocket.Compression.Threshold < 0 {
+		errs = append(errs, errors.New("websocket.compression.threshold must not be negative"))
+	}
+	if c.WebSocket.Batch.Window < 0 {
+		errs = append(errs, errors.New("websocket.batch.window must not be negative"))
+	}
+	if c.WebSocket.Batch.MaxMessages <= 0 {
+		errs = append(errs, errors.New("websocket.batch.max_messages must be positive"))
+	}
+
+	if c.Fallback.SessionTimeout <= 0 {
+		errs = append(errs, errors.New("fallback.session_timeout must be positive"))
+	}
+	if c.Fallback.PollTimeout <= 0 {
+		errs = append(errs, errors.New("fallback.poll_timeout must be positive"))
+	}
+	if c.Fallback.KeepAlive <= 0 {
+		errs = append(errs, errors.New("fallback.keepalive must be positive"))
+	}
+
+	if c.Hub.MaxRoomHistory <= 0 {
+		errs = append(errs, errors.New("hub.max_room_history must be positive"))
+	}
+	for _, room := range c.Hub.MetricRooms {
+		if room == "" || room == "other" {
+			errs = append(errs, fmt.Errorf("hub.metric_rooms must not contain %q", room))
+		}
+	}
+
+	if err := validWelcome(c.Announcements.Welcome); err != nil {
+		errs = append(errs, fmt.Errorf("announcements.welcome: %w", err))
+	}
+	for roomID, tmpl := range c.Announcements.RoomWelcome {
+		if err := validWelcome(tmpl); err != nil {
+			errs = append(errs, fmt.Errorf("announcements.room_welcome[%q]: %w", roomID, err))
+		}
+	}
+
+	errs = append(errs, c.Moderation.validate()...)
+
+	if !slices.Contains(DirectMessagePolicies, c.Privacy.DirectMessages) {
+		errs = append(errs, fmt.Errorf("privacy.direct_messages %q must be one of %s", c.Privacy.DirectMessages, strings.Join(DirectMessagePolicies, ", ")))
+	}
+	if c.Privacy.MaxBlocked <= 0 {
+		errs = append(errs, errors.New("privacy.max_blocked must be positive"))
+	}
+
+	if c.Webhooks.QueueSize <= 0 {
+		errs = append(errs, errors.New("webhooks.queue_size must be positive"))
+	}
+	if c.Webhooks.Workers <= 0 {
+		errs = append(errs, errors.New("webhooks.workers must be positive"))
+	}
+	if c.Webhooks.Timeout <= 0 {
+		errs = append(errs, errors.New("webhooks.timeout must be positive"))
+	}
+	if c.Webhooks.MaxAttempts <= 0 {
+		errs = append(errs, errors.New("webhooks.max_attempts must be positive"))
+	}
+	if c.Webhooks.InitialBackoff <= 0 {
+		errs = append(errs, errors.New("webhooks.initial_backoff must be positive"))
+	}
+	if c.Webhooks.MaxBackoff < c.Webhooks.InitialBackoff {
+		errs = append(errs, errors.New("webhooks.max_backoff must not be less than initial_backoff"))
+	}
+	if c.Webhooks.LogSize < 0 || c.Webhooks.MaxDeadLetters < 0 {
+		errs = append(errs, errors.New("webhooks.log_size and webhooks.max_dead_letters must not be negative"))
+	}
+	if c.Webhooks.MaxIncomingBytes <= 0 {
+		errs = append(errs, errors.New("webhooks.max_incoming_bytes must be positive"))
+	}
+	if c.Bots.ResponseTimeout <= 0 {
+		errs = append(errs, errors.New("bots.response_timeout must be positive"))
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if c.Tracing.Endpoint == "" {
+			errs = append(errs, errors.New("tracing.endpoint is required for the otlp exporter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter %q must be one of none, stdout, otlp", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing.sample_ratio must be between 0 and 1"))
+	}
+
+	for _, op := range []string{"frames", "messages", "room_creation", "joins", "typing", "incoming_webhooks"} {
+		limit := c.RateLimit.For(op)
+		if limit.Rate < 0 || limit.Burst < 0 {
+			errs = append(errs, fmt.Errorf("rate_limit.%s must not be negative", op))
+		}
+		if limit.Rate > 0 && limit.Burst < 1 {
+			errs = append(errs, fmt.Errorf("rate_limit.%s.burst must be at least 1", op))
+		}
+	}
+
+	for i, op := range c.Admin.Operators {
+		if op.Name == "" || op.Token == "" {
+			errs = append(errs, fmt.Errorf("admin.operators[%d] needs both name and token", i))
+		}
+		if op.Role != "" && op.Role != RoleAdmin && op.Role != RoleModerator {
+			errs = append(errs, fmt.Errorf("admin.operators[%d].role %q must be one of admin, moderator", i, op.Role))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validWelcome checks that a welcome template parses and only uses the
+// fields it is given
+func validWelcome(text string) error {
+	tmpl, err := template.New("welcome").Parse(text)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(io.Discard, struct{ Username, Room, RoomID string }{})
+}
+
+// Duration is a time.Duration that reads and writes as a string such as "10s"
+type Duration time.Duration
+
+// Duration returns the value as a time.Duration
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// String formats the duration like time.Duration
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON encodes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON accepts a duration string or a number of nanoseconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+		return nil
+	}
+
+	var n int64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	*d = Duration(n)
+	return nil
+}
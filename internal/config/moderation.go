@@ -0,0 +1,103 @@
+package config
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// validate checks the moderation settings, including that every rule's
+// pattern compiles
+func (m ModerationConfig) validate() []error {
+	var errs []error
+
+	if err := validAction(m.BannedWords.Action, ModerationActions); err != nil {
+		errs = append(errs, fmt.Errorf("moderation.banned_words.action %w", err))
+	}
+	for i, word := range m.BannedWords.Words {
+		if strings.TrimSpace(word) == "" {
+			errs = append(errs, fmt.Errorf("moderation.banned_words.words[%d] is empty", i))
+		}
+	}
+
+	for i, rule := range m.Rules {
+		if rule.Name == "" {
+			errs = append(errs, fmt.Errorf("moderation.rules[%d].name is required", i))
+		}
+		if rule.Action == "" {
+			errs = append(errs, fmt.Errorf("moderation.rules[%d].action is required", i))
+		} else if err := validAction(rule.Action, ModerationActions); err != nil {
+			errs = append(errs, fmt.Errorf("moderation.rules[%d].action %w", i, err))
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			errs = append(errs, fmt.Errorf("moderation.rules[%d].pattern: %w", i, err))
+		}
+	}
+
+	if err := validAction(m.Links.Action, ModerationActions); err != nil {
+		errs = append(errs, fmt.Errorf("moderation.links.action %w", err))
+	}
+	for i, domain := range m.Links.AllowedDomains {
+		if domain == "" || strings.ContainsAny(domain, "/:* ") {
+			errs = append(errs, fmt.Errorf("moderation.links.allowed_domains[%d] %q must be a bare domain such as example.com", i, domain))
+		}
+	}
+
+	spam := m.Spam
+	if err := validAction(spam.Action, []string{"hold", "reject"}); err != nil {
+		errs = append(errs, fmt.Errorf("moderation.spam.action %w", err))
+	}
+	if spam.MaxCapsRatio < 0 || spam.MaxCapsRatio > 1 {
+		errs = append(errs, errors.New("moderation.spam.max_caps_ratio must be between 0 and 1"))
+	}
+	if spam.MinCapsLength < 0 || spam.MaxRepeatedChars < 0 || spam.MaxDuplicates < 0 {
+		errs = append(errs, errors.New("moderation.spam thresholds must not be negative"))
+	}
+	if spam.MaxDuplicates > 0 && spam.DuplicateWindow <= 0 {
+		errs = append(errs, errors.New("moderation.spam.duplicate_window must be positive when max_duplicates is set"))
+	}
+
+	if m.MaxHeld <= 0 {
+		errs = append(errs, errors.New("moderation.max_held must be positive"))
+	}
+	tokens := make(map[string]bool)
+	for i, mod := range m.Moderators {
+		if mod.UserID == "" || mod.Token == "" {
+			errs = append(errs, fmt.Errorf("moderation.moderators[%d] needs both user_id and token", i))
+		}
+		if mod.Token != "" && tokens[mod.Token] {
+			errs = append(errs, fmt.Errorf("moderation.moderators[%d].token is already used by another moderator", i))
+		}
+		tokens[mod.Token] = true
+	}
+	return errs
+}
+
+// IsModerator reports whether userID is configured as a moderator. It doesn't
+// prove the user is who they claim to be; see AuthenticateModerator.
+func (m ModerationConfig) IsModerator(userID string) bool {
+	return slices.ContainsFunc(m.Moderators, func(mod Moderator) bool { return mod.UserID == userID })
+}
+
+// AuthenticateModerator returns the user ID of the moderator a token
+// belongs to
+func (m ModerationConfig) AuthenticateModerator(token string) (string, bool) {
+	for _, mod := range m.Moderators {
+		if subtle.ConstantTimeCompare([]byte(mod.Token), []byte(token)) == 1 {
+			return mod.UserID, true
+		}
+	}
+	return "", false
+}
+
+// validAction checks a filter action against the allowed ones. Empty turns
+// the filter off and is always valid.
+func validAction(action string, allowed []string) error {
+	if action == "" || slices.Contains(allowed, action) {
+		return nil
+	}
+	return fmt.Errorf("%q must be one of %s", action, strings.Join(allowed, ", "))
+}
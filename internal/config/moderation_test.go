@@ -0,0 +1,71 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAuthenticateModerator(t *testing.T) {
+	m := ModerationConfig{Moderators: []Moderator{
+		{UserID: "alice", Token: "alice-token"},
+		{UserID: "bob", Token: "bob-token"},
+	}}
+
+	tests := []struct {
+		token  string
+		userID string
+		ok     bool
+	}{
+		{"alice-token", "alice", true},
+		{"bob-token", "bob", true},
+		{"alice", "", false},
+		{"alice-token ", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		userID, ok := m.AuthenticateModerator(tt.token)
+		if userID != tt.userID || ok != tt.ok {
+			t.Errorf("AuthenticateModerator(%q) = %q, %v; want %q, %v", tt.token, userID, ok, tt.userID, tt.ok)
+		}
+	}
+
+	if !m.IsModerator("alice") || m.IsModerator("carol") {
+		t.Error("IsModerator doesn't follow the configured user IDs")
+	}
+}
+
+func TestValidateModerators(t *testing.T) {
+	tests := []struct {
+		name       string
+		moderators []Moderator
+		want       string
+	}{
+		{"valid", []Moderator{{UserID: "alice", Token: "a"}, {UserID: "bob", Token: "b"}}, ""},
+		{"missing token", []Moderator{{UserID: "alice"}}, "moderation.moderators[0] needs both user_id and token"},
+		{"missing user", []Moderator{{Token: "a"}}, "moderation.moderators[0] needs both user_id and token"},
+		{"shared token", []Moderator{{UserID: "alice", Token: "a"}, {UserID: "bob", Token: "a"}}, "moderation.moderators[1].token is already used"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Moderation.Moderators = tt.moderators
+			err := cfg.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Fatalf("Validate() = %v, want nil", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Fatalf("Validate() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffHidesModeratorTokens(t *testing.T) {
+	old, new := Default(), Default()
+	new.Moderation.Moderators = []Moderator{{UserID: "alice", Token: "s3cret"}}
+
+	changes := Diff(old, new)
+	if len(changes) != 1 || strings.Contains(changes[0], "s3cret") {
+		t.Fatalf("Diff() = %q, want one change without the token", changes)
+	}
+}
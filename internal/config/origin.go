@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// AllowsOrigin reports whether a browser on origin may call a server
+// reached as host. Requests without an Origin header don't come from a
+// browser page and are allowed, as are same-origin requests.
+func (c CORSConfig) AllowsOrigin(origin, host string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, host) {
+		return true
+	}
+
+	for _, pattern := range c.AllowedOrigins {
+		if matchOrigin(pattern, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin compares an origin with one allowlist entry: "*", an exact
+// origin, or scheme://*.domain[:port] for any subdomain of domain
+func matchOrigin(pattern string, origin *url.URL) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	scheme, rest, ok := strings.Cut(pattern, "://")
+	if !ok || !strings.EqualFold(scheme, origin.Scheme) {
+		return false
+	}
+	if domain, ok := strings.CutPrefix(rest, "*."); ok {
+		// Matching on "."+domain keeps lookalikes such as evilexample.com
+		// out; the length check keeps out an empty label
+		host := strings.ToLower(origin.Host)
+		return strings.HasSuffix(host, "."+strings.ToLower(domain)) && len(host) > len(domain)+1
+	}
+	return strings.EqualFold(rest, origin.Host)
+}
+
+// validOriginPattern checks that an allowlist entry is an origin, with at
+// most a leading "*." wildcard label
+func validOriginPattern(pattern string) error {
+	u, err := url.Parse(strings.Replace(pattern, "://*.", "://wildcard.", 1))
+	if err != nil {
+		return fmt.Errorf("%q is not a valid origin: %w", pattern, err)
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return fmt.Errorf("%q must start with http:// or https://", pattern)
+	case u.Host == "":
+		return fmt.Errorf("%q has no host", pattern)
+	case u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil:
+		return fmt.Errorf("%q must be scheme://host[:port] with no path", pattern)
+	case strings.Contains(u.Host, "*"):
+		return fmt.Errorf("%q may only use * as the first label, as in https://*.example.com", pattern)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"*", "https://anything.test", true},
+		{"https://chat.example.com", "https://chat.example.com", true},
+		{"https://chat.example.com", "https://CHAT.example.com", true},
+		{"https://chat.example.com", "https://chat.example.com:8443", false},
+		{"https://chat.example.com", "http://chat.example.com", false},
+		{"https://chat.example.com:8443", "https://chat.example.com:8443", true},
+		{"https://*.example.com", "https://chat.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "https://example.com.evil.test", false},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "http://chat.example.com", false},
+		{"https://*.example.com", "https://chat.example.com:8443", false},
+		{"https://*.example.com:8443", "https://chat.example.com:8443", true},
+		{"chat.example.com", "https://chat.example.com", false},
+	}
+	for _, tt := range tests {
+		origin, err := url.Parse(tt.origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := matchOrigin(tt.pattern, origin); got != tt.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	cfg := CORSConfig{AllowedOrigins: []string{"https://chat.example.com", "https://*.example.org"}}
+
+	tests := []struct {
+		name   string
+		origin string
+		host   string
+		want   bool
+	}{
+		{"no origin", "", "api.example.com", true},
+		{"same origin", "https://api.example.com", "api.example.com", true},
+		{"same origin with port", "http://localhost:8080", "localhost:8080", true},
+		{"other port on same host", "http://localhost:3000", "localhost:8080", false},
+		{"exact", "https://chat.example.com", "api.example.com", true},
+		{"wildcard subdomain", "https://app.example.org", "api.example.com", true},
+		{"bare apex of wildcard", "https://example.org", "api.example.com", false},
+		{"suffix spoof", "https://evilexample.org", "api.example.com", false},
+		{"scheme mismatch", "http://chat.example.com", "api.example.com", false},
+		{"port mismatch", "https://chat.example.com:8443", "api.example.com", false},
+		{"null", "null", "api.example.com", false},
+		{"not a url", "://chat.example.com", "api.example.com", false},
+		{"unlisted", "https://evil.test", "api.example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.AllowsOrigin(tt.origin, tt.host); got != tt.want {
+				t.Errorf("AllowsOrigin(%q, %q) = %v, want %v", tt.origin, tt.host, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"chatstreamapp/internal/logger"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var current atomic.Pointer[Config]
+
+func init() {
+	current.Store(Default())
+}
+
+// Get returns the active configuration. The returned value must not be modified.
+func Get() *Config {
+	return current.Load()
+}
+
+// Set replaces the active configuration
+func Set(cfg *Config) {
+	current.Store(cfg)
+}
+
+// Reloader re-reads the config file and swaps it in when it is valid
+type Reloader struct {
+	path string
+
+	// Serializes reloads so concurrent SIGHUP and admin requests don't interleave
+	mu sync.Mutex
+
+	// Checks run before the swap; any error rejects the reload
+	onValidate []func(old, new *Config) error
+
+	// Callbacks run after a successful swap
+	onReload []func(old, new *Config)
+}
+
+// NewReloader creates a reloader for the given config file
+func NewReloader(path string) *Reloader {
+	return &Reloader{path: path}
+}
+
+// OnValidate registers a check run on each new config before it replaces
+// the active one, for settings only other packages can check. An error
+// rejects the whole reload.
+func (r *Reloader) OnValidate(fn func(old, new *Config) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onValidate = append(r.onValidate, fn)
+}
+
+// OnReload registers a callback invoked after each successful reload
+func (r *Reloader) OnReload(fn func(old, new *Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onReload = append(r.onReload, fn)
+}
+
+// Reload loads and validates the config file, then atomically replaces the
+// active config. It returns the list of changed settings. On error the
+// active config is left untouched.
+func (r *Reloader) Reload() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.path == "" {
+		return nil, fmt.Errorf("no config file to reload")
+	}
+
+	next, err := Load(r.path)
+	if err != nil {
+		return nil, err
+	}
+
+	old := Get()
+	changes := Diff(old, next)
+	if len(changes) == 0 {
+		logger.Info("config reloaded, nothing changed")
+		return nil, nil
+	}
+	for _, fn := range r.onValidate {
+		if err := fn(old, next); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", r.path, err)
+		}
+	}
+
+	Set(next)
+	for _, fn := range r.onReload {
+		fn(old, next)
+	}
+
+	for _, change := range changes {
+		logger.Info("config changed", "setting", change)
+	}
+	if RestartRequired(changes) {
+		logger.Warning("some config changes only take effect after a restart")
+	}
+	return changes, nil
+}
+
+// Settings that are only read at startup
+var restartOnly = []string{
+	"server.addr",
+	"server.tls.",
+	"log.format",
+	"tracing.exporter",
+	"tracing.endpoint",
+	"tracing.service_name",
+	"audit.",
+	"moderation.sanctions_file",
+	"privacy.settings_file",
+	"announcements.file",
+	"webhooks.file",
+	"webhooks.queue_size",
+	"webhooks.workers",
+	"webhooks.incoming_file",
+	"bots.file",
+	"hub.metric_rooms",
+}
+
+// RestartRequired reports whether any of the changes only apply after a restart
+func RestartRequired(changes []string) bool {
+	for _, change := range changes {
+		for _, prefix := range restartOnly {
+			if strings.HasPrefix(change, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Diff returns a human readable description of each setting that differs
+// between old and new, keyed by its JSON path
+func Diff(old, new *Config) []string {
+	var changes []string
+	diffValue("", reflect.ValueOf(*old), reflect.ValueOf(*new), &changes)
+	return changes
+}
+
+func diffValue(path string, old, new reflect.Value, changes *[]string) {
+	if old.Kind() == reflect.Struct && old.Type() != reflect.TypeOf(Duration(0)) {
+		for i := 0; i < old.NumField(); i++ {
+			field := old.Type().Field(i)
+			diffValue(joinPath(path, jsonName(field)), old.Field(i), new.Field(i), changes)
+		}
+		return
+	}
+
+	if reflect.DeepEqual(old.Interface(), new.Interface()) {
+		return
+	}
+
+	if isSecret(path) {
+		*changes = append(*changes, path+" changed")
+		return
+	}
+	*changes = append(*changes, fmt.Sprintf("%s: %v -> %v", path, old.Interface(), new.Interface()))
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// isSecret hides values that must not end up in the logs
+func isSecret(path string) bool {
+	return strings.HasPrefix(path, "admin.") || strings.HasPrefix(path, "moderation.moderators")
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	t.Setenv("CHAT_ENV", "")
+	t.Cleanup(func() { Set(Default()) })
+	// The server starts from Load, which fills in the environment's defaults
+	initial, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Set(initial)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := NewReloader(path)
+	var reloads int
+	r.OnReload(func(old, new *Config) { reloads++ })
+
+	write(`{"hub": {"max_room_history": 50}}`)
+	changes, err := r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"hub.max_room_history: 100 -> 50"}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %q, want %q", changes, want)
+	}
+	if Get().Hub.MaxRoomHistory != 50 || reloads != 1 {
+		t.Fatalf("after reload: max_room_history %d and %d callbacks, want 50 and 1", Get().Hub.MaxRoomHistory, reloads)
+	}
+	if RestartRequired(changes) {
+		t.Error("hub.max_room_history should apply without a restart")
+	}
+
+	// Nothing changed
+	if changes, err := r.Reload(); err != nil || changes != nil || reloads != 1 {
+		t.Errorf("unchanged reload = %q, %v with %d callbacks", changes, err, reloads)
+	}
+
+	// Invalid files keep the running config
+	for _, data := range []string{`{"hub": `, `{"hub": {"max_room_history": 0}}`} {
+		write(data)
+		if _, err := r.Reload(); err == nil {
+			t.Errorf("Reload(%s) succeeded", data)
+		}
+		if Get().Hub.MaxRoomHistory != 50 || reloads != 1 {
+			t.Errorf("Reload(%s) replaced the running config", data)
+		}
+	}
+
+	write(`{"hub": {"max_room_history": 50}, "server": {"addr": ":9090"}}`)
+	changes, err = r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !RestartRequired(changes) {
+		t.Errorf("RestartRequired(%q) = false", changes)
+	}
+
+	// Checks registered by other packages reject the reload as a whole
+	r.OnValidate(func(old, new *Config) error {
+		if new.Hub.MaxRoomHistory == 20 {
+			return errors.New("moderation: bad rule")
+		}
+		return nil
+	})
+	reloads = 0
+	write(`{"hub": {"max_room_history": 20}}`)
+	if _, err := r.Reload(); err == nil {
+		t.Error("Reload() succeeded though a check failed")
+	}
+	if Get().Hub.MaxRoomHistory != 50 || reloads != 0 {
+		t.Errorf("rejected reload left max_room_history %d and ran %d callbacks", Get().Hub.MaxRoomHistory, reloads)
+	}
+}
@@ -0,0 +1,91 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrDraining is reported by readiness while the server shuts down
+var ErrDraining = errors.New("server is draining")
+
+// CheckFunc reports whether a dependency is usable
+type CheckFunc func(ctx context.Context) error
+
+// Checker tracks the dependencies the server needs to accept traffic
+type Checker struct {
+	draining atomic.Bool
+
+	mu     sync.RWMutex
+	checks map[string]CheckFunc
+}
+
+// NewChecker creates an empty checker
+func NewChecker() *Checker {
+	return &Checker{
+		checks: make(map[string]CheckFunc),
+	}
+}
+
+// AddCheck registers a named readiness check, such as a storage ping
+func (c *Checker) AddCheck(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks[name] = check
+}
+
+// SetDraining marks the server as shutting down so it stops receiving traffic
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+// Draining reports whether shutdown has started
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Run executes every check and reports whether all of them passed
+func (c *Checker) Run(ctx context.Context) ([]Result, bool) {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	checks := make(map[string]CheckFunc, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.RUnlock()
+	sort.Strings(names)
+
+	results := make([]Result, 0, len(names)+1)
+	ready := true
+
+	draining := Result{Name: "draining", OK: !c.Draining()}
+	if !draining.OK {
+		draining.Error = ErrDraining.Error()
+		ready = false
+	}
+	results = append(results, draining)
+
+	for _, name := range names {
+		result := Result{Name: name, OK: true}
+		if err := checks[name](ctx); err != nil {
+			result.OK = false
+			result.Error = err.Error()
+			ready = false
+		}
+		results = append(results, result)
+	}
+	return results, ready
+}
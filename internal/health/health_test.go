@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	failing := func(context.Context) error { return errors.New("storage unreachable") }
+	passing := func(context.Context) error { return nil }
+
+	tests := []struct {
+		name     string
+		checks   map[string]CheckFunc
+		draining bool
+		want     []Result
+		ready    bool
+	}{
+		{
+			name:  "no checks",
+			want:  []Result{{Name: "draining", OK: true}},
+			ready: true,
+		},
+		{
+			name:   "all passing",
+			checks: map[string]CheckFunc{"storage": passing, "hub": passing},
+			want:   []Result{{Name: "draining", OK: true}, {Name: "hub", OK: true}, {Name: "storage", OK: true}},
+			ready:  true,
+		},
+		{
+			// Every check still runs so the response shows all failures
+			name:   "one failing",
+			checks: map[string]CheckFunc{"storage": failing, "hub": passing},
+			want: []Result{
+				{Name: "draining", OK: true},
+				{Name: "hub", OK: true},
+				{Name: "storage", OK: false, Error: "storage unreachable"},
+			},
+		},
+		{
+			name:     "draining",
+			checks:   map[string]CheckFunc{"hub": passing},
+			draining: true,
+			want:     []Result{{Name: "draining", OK: false, Error: ErrDraining.Error()}, {Name: "hub", OK: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker()
+			for name, check := range tt.checks {
+				checker.AddCheck(name, check)
+			}
+			if tt.draining {
+				checker.SetDraining()
+			}
+
+			results, ready := checker.Run(context.Background())
+			if ready != tt.ready {
+				t.Errorf("ready = %v, want %v", ready, tt.ready)
+			}
+			if !reflect.DeepEqual(results, tt.want) {
+				t.Errorf("results = %+v, want %+v", results, tt.want)
+			}
+			if checker.Draining() != tt.draining {
+				t.Errorf("Draining() = %v, want %v", checker.Draining(), tt.draining)
+			}
+		})
+	}
+}
+
+func TestAddCheckReplaces(t *testing.T) {
+	checker := NewChecker()
+	checker.AddCheck("hub", func(context.Context) error { return errors.New("down") })
+	checker.AddCheck("hub", func(context.Context) error { return nil })
+
+	if results, ready := checker.Run(context.Background()); !ready || len(results) != 2 {
+		t.Errorf("Run() = %+v, %v, want only the replacement check, passing", results, ready)
+	}
+}
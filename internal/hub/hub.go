@@ -1,10 +1,24 @@
 package hub
 
 import (
+	"chatstreamapp/internal/announce"
 	"chatstreamapp/internal/client"
+	"chatstreamapp/internal/config"
 	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/markdown"
+	"chatstreamapp/internal/metrics"
 	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/moderation"
+	"chatstreamapp/internal/privacy"
+	"chatstreamapp/internal/tracing"
+	"chatstreamapp/internal/webhook"
+	"context"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,127 +27,446 @@ import (
 // Hub maintains the set of active clients and broadcasts messages to the clients
 type Hub struct {
 	// Registered clients
-	clients map[*client.Client]bool
+	clients map[client.Connection]bool
 
 	// User ID to client mapping for private messages
-	userClients map[string]*client.Client
+	userClients map[string]client.Connection
 
 	// Rooms
 	rooms map[string]*models.Room
 
+	// Rooms reported by ID in chat_room_users; fixed at start so the
+	// series for other rooms stays consistent
+	metricRooms map[string]bool
+
+	// When each user last left each room, by user ID then room ID. Drives
+	// unread counts and keeps private rooms listed to former members.
+	lastSeen map[string]map[string]time.Time
+
 	// Inbound messages from the clients
-	broadcast chan *models.Message
+	broadcast chan *RoomMessage
 
 	// Register requests from the clients
-	register chan *client.Client
+	register chan client.Connection
 
 	// Unregister requests from clients
-	unregister chan *client.Client
+	unregister chan client.Connection
+
+	// Dropped connections that may resume, by resume token
+	detached map[string]*detachedClient
+
+	// Resumption: clients that dropped, resume attempts and expired grace periods
+	detach chan client.Connection
+	resume chan *ResumeRequest
+	expire chan *detachedClient
 
 	// Private message channel
 	privateMessage chan *PrivateMessage
 
+	// Messages shown in a room to one user only
+	ephemeral chan *EphemeralMessage
+
 	// Room operations
 	joinRoom  chan *RoomOperation
 	leaveRoom chan *RoomOperation
 
+	// Moderator operations
+	kick       chan *UserOperation
+	disconnect chan *UserOperation
+
+	// Admin operations
+	closeConnection chan *ConnectionOperation
+	deleteRoom      chan *RoomOperation
+	purge           chan *PurgeRequest
+	announce        chan *RoomMessage
+
+	// Liveness probes answered by the event loop
+	probe chan chan struct{}
+
+	// Unix nanoseconds of the last event the loop finished handling
+	lastEvent atomic.Int64
+
 	// Mutex for thread safety
 	mu sync.RWMutex
 }
 
+// RoomMessage represents a message to every member of a room
+type RoomMessage struct {
+	Message *models.Message
+	Result  chan error
+}
+
 // PrivateMessage represents a private message to a specific user
 type PrivateMessage struct {
 	UserID  string
 	Message *models.Message
+	Result  chan error
+}
+
+// EphemeralMessage is a message shown in a room's timeline to one user. It
+// goes to ConnectionID when set, otherwise to UserID's connection.
+type EphemeralMessage struct {
+	UserID       string
+	ConnectionID string
+	Message      *models.Message
+	Result       chan error
 }
 
 // RoomOperation represents a room join/leave operation
 type RoomOperation struct {
-	Client *client.Client
+	Client client.Connection
+	RoomID string
+	Result chan error
+}
+
+// UserOperation acts on every connection of a user
+type UserOperation struct {
+	UserID string
 	RoomID string
+	Result chan error
+}
+
+// ConnectionOperation acts on one connection
+type ConnectionOperation struct {
+	ConnectionID string
+	Result       chan error
+}
+
+// PurgeRequest removes messages from a room's history, only those sent by
+// UserID when it is set
+type PurgeRequest struct {
+	RoomID string
+	UserID string
+	Result chan PurgeResult
+}
+
+// PurgeResult reports how many messages a purge removed
+type PurgeResult struct {
+	Purged int
+	Err    error
+}
+
+// ResumeRequest asks to reattach a detached client
+type ResumeRequest struct {
+	Token   string
+	UserID  string
+	LastSeq uint64
+	Result  chan client.Connection
+}
+
+// detachedClient is a dropped connection waiting out its grace period
+type detachedClient struct {
+	conn  client.Connection
+	timer *time.Timer
+}
+
+// reply reports the outcome of an operation to the caller waiting on it
+func reply(result chan error, err error) {
+	if result != nil {
+		result <- err
+	}
 }
 
 // NewHub creates a new Hub
 func NewHub() *Hub {
-	return &Hub{
-		clients:        make(map[*client.Client]bool),
-		userClients:    make(map[string]*client.Client),
-		rooms:          make(map[string]*models.Room),
-		broadcast:      make(chan *models.Message),
-		register:       make(chan *client.Client),
-		unregister:     make(chan *client.Client),
-		privateMessage: make(chan *PrivateMessage),
-		joinRoom:       make(chan *RoomOperation),
-		leaveRoom:      make(chan *RoomOperation),
+	h := &Hub{
+		clients:         make(map[client.Connection]bool),
+		userClients:     make(map[string]client.Connection),
+		rooms:           make(map[string]*models.Room),
+		metricRooms:     make(map[string]bool),
+		lastSeen:        make(map[string]map[string]time.Time),
+		broadcast:       make(chan *RoomMessage),
+		register:        make(chan client.Connection),
+		unregister:      make(chan client.Connection),
+		detached:        make(map[string]*detachedClient),
+		detach:          make(chan client.Connection),
+		resume:          make(chan *ResumeRequest),
+		expire:          make(chan *detachedClient),
+		privateMessage:  make(chan *PrivateMessage),
+		ephemeral:       make(chan *EphemeralMessage),
+		joinRoom:        make(chan *RoomOperation),
+		leaveRoom:       make(chan *RoomOperation),
+		kick:            make(chan *UserOperation),
+		disconnect:      make(chan *UserOperation),
+		closeConnection: make(chan *ConnectionOperation),
+		deleteRoom:      make(chan *RoomOperation),
+		purge:           make(chan *PurgeRequest),
+		announce:        make(chan *RoomMessage),
+		probe:           make(chan chan struct{}),
 	}
+	for _, room := range config.Get().Hub.MetricRooms {
+		h.metricRooms[room] = true
+	}
+	return h
 }
 
 // Run starts the hub
 func (h *Hub) Run() {
 	// Create a default general room
 	generalRoom := models.NewRoom("general", "General Chat")
+	h.mu.Lock()
 	h.rooms["general"] = generalRoom
+	metrics.Rooms.Set(float64(len(h.rooms)))
+	h.mu.Unlock()
 
 	for {
 		select {
 		case c := <-h.register:
-			h.registerClient(c)
+			h.timed("register", func() {
+				h.dropDetached(c.GetUser().ID)
+				h.registerClient(c)
+			})
 
 		case c := <-h.unregister:
-			h.unregisterClient(c)
+			h.timed("unregister", func() { h.unregisterClient(c) })
+
+		case c := <-h.detach:
+			h.timed("detach", func() { h.detachClient(c) })
 
-		case message := <-h.broadcast:
-			h.broadcastMessage(message)
+		case req := <-h.resume:
+			h.timed("resume", func() { req.Result <- h.resumeClient(req) })
+
+		case d := <-h.expire:
+			h.timed("expire", func() { h.expireClient(d) })
+
+		case rm := <-h.broadcast:
+			h.timed("broadcast", func() { reply(rm.Result, h.broadcastMessage(rm.Message)) })
 
 		case pm := <-h.privateMessage:
-			h.sendPrivateMessage(pm)
+			h.timed("private", func() { reply(pm.Result, h.sendPrivateMessage(pm)) })
+
+		case em := <-h.ephemeral:
+			h.timed("ephemeral", func() { reply(em.Result, h.sendEphemeral(em)) })
 
 		case op := <-h.joinRoom:
-			h.handleJoinRoom(op)
+			h.timed("join_room", func() { reply(op.Result, h.handleJoinRoom(op)) })
 
 		case op := <-h.leaveRoom:
-			h.handleLeaveRoom(op)
+			h.timed("leave_room", func() { reply(op.Result, h.handleLeaveRoom(op)) })
+
+		case op := <-h.kick:
+			h.timed("kick", func() { reply(op.Result, h.handleKick(op)) })
+
+		case op := <-h.disconnect:
+			h.timed("disconnect", func() { reply(op.Result, h.handleDisconnect(op)) })
+
+		case op := <-h.closeConnection:
+			h.timed("close_connection", func() { reply(op.Result, h.handleCloseConnection(op)) })
+
+		case op := <-h.deleteRoom:
+			h.timed("delete_room", func() { reply(op.Result, h.handleDeleteRoom(op)) })
+
+		case req := <-h.purge:
+			h.timed("purge", func() { req.Result <- h.handlePurge(req) })
+
+		case am := <-h.announce:
+			h.timed("announce", func() { reply(am.Result, h.announceMessage(am.Message)) })
+
+		case done := <-h.probe:
+			h.timed("probe", func() { close(done) })
 		}
 	}
 }
 
+// timed runs an event handler and records how long the loop spent on it
+func (h *Hub) timed(event string, handle func()) {
+	start := time.Now()
+	handle()
+	h.lastEvent.Store(time.Now().UnixNano())
+	metrics.HubEventDuration.WithLabelValues(event).Observe(time.Since(start).Seconds())
+}
+
+// Ping checks that the event loop is running by sending it a probe and
+// waiting for the answer
+func (h *Hub) Ping(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case h.probe <- reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-reply:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LastEvent returns when the event loop last finished handling an event
+func (h *Hub) LastEvent() time.Time {
+	ns := h.lastEvent.Load()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
 // Register adds a client to the hub
-func (h *Hub) Register(client *client.Client) {
+func (h *Hub) Register(client client.Connection) {
 	h.register <- client
 }
 
 // Unregister removes a client from the hub
-func (h *Hub) Unregister(client *client.Client) {
+func (h *Hub) Unregister(client client.Connection) {
 	h.unregister <- client
 }
 
-// Broadcast sends a message to all clients in the same room
-func (h *Hub) Broadcast(message *models.Message) {
-	h.broadcast <- message
+// Detach keeps a dropped client registered, in its room, for the resume
+// grace period so it can reconnect without leave and join messages. Events
+// for it queue up meanwhile. Without a grace period it is the same as
+// Unregister.
+func (h *Hub) Detach(client client.Connection) {
+	h.detach <- client
 }
 
-// SendToUser sends a private message to a specific user
-func (h *Hub) SendToUser(userID string, message *models.Message) {
+// Resume reattaches the detached client holding token and rewinds its queue
+// to the events after lastSeq. It returns nil when there is no such client
+// for userID or its missed events are no longer buffered; the caller then
+// registers a fresh connection.
+func (h *Hub) Resume(token, userID string, lastSeq uint64) client.Connection {
+	result := make(chan client.Connection, 1)
+	h.resume <- &ResumeRequest{
+		Token:   token,
+		UserID:  userID,
+		LastSeq: lastSeq,
+		Result:  result,
+	}
+	return <-result
+}
+
+// Broadcast sends a message to all clients in the same room. It returns
+// once the hub has routed the message, or ErrRoomNotFound.
+func (h *Hub) Broadcast(message *models.Message) error {
+	result := make(chan error, 1)
+	h.broadcast <- &RoomMessage{
+		Message: message,
+		Result:  result,
+	}
+	return <-result
+}
+
+// SendToUser sends a private message to a specific user. It returns
+// ErrUserNotFound when the user is not connected.
+func (h *Hub) SendToUser(userID string, message *models.Message) error {
+	result := make(chan error, 1)
 	h.privateMessage <- &PrivateMessage{
 		UserID:  userID,
 		Message: message,
+		Result:  result,
 	}
+	return <-result
 }
 
-// JoinRoom adds a client to a room
-func (h *Hub) JoinRoom(client *client.Client, roomID string) {
+// SendEphemeral shows a message in the timeline of its room to one user
+// only: to the connection with connectionID when it is set, otherwise to
+// userID's. The recipient must be in the room. The message is marked
+// ephemeral and never kept in history.
+func (h *Hub) SendEphemeral(userID, connectionID string, message *models.Message) error {
+	result := make(chan error, 1)
+	h.ephemeral <- &EphemeralMessage{
+		UserID:       userID,
+		ConnectionID: connectionID,
+		Message:      message,
+		Result:       result,
+	}
+	return <-result
+}
+
+// JoinRoom adds a client to a room, creating the room if needed. The client's
+// room is updated by the time it returns.
+func (h *Hub) JoinRoom(client client.Connection, roomID string) error {
+	result := make(chan error, 1)
 	h.joinRoom <- &RoomOperation{
 		Client: client,
 		RoomID: roomID,
+		Result: result,
 	}
+	return <-result
 }
 
-// LeaveRoom removes a client from a room
-func (h *Hub) LeaveRoom(client *client.Client, roomID string) {
+// LeaveRoom removes a client from a room. It returns ErrNotMember when the
+// client is not in that room.
+func (h *Hub) LeaveRoom(client client.Connection, roomID string) error {
+	result := make(chan error, 1)
 	h.leaveRoom <- &RoomOperation{
 		Client: client,
 		RoomID: roomID,
+		Result: result,
+	}
+	return <-result
+}
+
+// Kick removes a user from a room without the usual leave message. It
+// returns ErrNotMember when the user isn't in that room.
+func (h *Hub) Kick(userID, roomID string) error {
+	result := make(chan error, 1)
+	h.kick <- &UserOperation{
+		UserID: userID,
+		RoomID: roomID,
+		Result: result,
+	}
+	return <-result
+}
+
+// Disconnect unregisters every connection of a user, including ones waiting
+// to resume, and closes them once their queued messages are sent. It
+// returns ErrUserNotFound when the user isn't connected.
+func (h *Hub) Disconnect(userID string) error {
+	result := make(chan error, 1)
+	h.disconnect <- &UserOperation{
+		UserID: userID,
+		Result: result,
+	}
+	return <-result
+}
+
+// CloseConnection unregisters one connection and closes it once its queued
+// messages are sent. It returns ErrConnectionNotFound when there is no such
+// connection.
+func (h *Hub) CloseConnection(connectionID string) error {
+	result := make(chan error, 1)
+	h.closeConnection <- &ConnectionOperation{
+		ConnectionID: connectionID,
+		Result:       result,
+	}
+	return <-result
+}
+
+// DeleteRoom removes a room and its history. Its members are told and left
+// in no room. The default room can't be deleted.
+func (h *Hub) DeleteRoom(roomID string) error {
+	result := make(chan error, 1)
+	h.deleteRoom <- &RoomOperation{
+		RoomID: roomID,
+		Result: result,
 	}
+	return <-result
+}
+
+// PurgeMessages removes a room's message history, or only userID's messages
+// when it is set, and returns how many were removed
+func (h *Hub) PurgeMessages(roomID, userID string) (int, error) {
+	result := make(chan PurgeResult, 1)
+	h.purge <- &PurgeRequest{
+		RoomID: roomID,
+		UserID: userID,
+		Result: result,
+	}
+	res := <-result
+	return res.Purged, res.Err
+}
+
+// Announce sends a message to every connected client, whatever room they
+// are in. It is not kept in any room's history.
+func (h *Hub) Announce(message *models.Message) error {
+	result := make(chan error, 1)
+	h.announce <- &RoomMessage{
+		Message: message,
+		Result:  result,
+	}
+	return <-result
 }
 
 // GetRooms returns all rooms
@@ -149,61 +482,179 @@ func (h *Hub) GetRooms() map[string]*models.Room {
 }
 
 // GetUsers returns all connected users
-func (h *Hub) GetUsers() map[string]*client.Client {
+func (h *Hub) GetUsers() map[string]client.Connection {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	
-	users := make(map[string]*client.Client)
+	users := make(map[string]client.Connection)
 	for userID, c := range h.userClients {
 		users[userID] = c
 	}
 	return users
 }
 
-// CreateRoom creates a new room
-func (h *Hub) CreateRoom(name string) *models.Room {
+// CreateRoom creates a new room and announces it to connected clients.
+// visibility is models.RoomPublic or models.RoomPrivate; empty is public.
+func (h *Hub) CreateRoom(name, topic, visibility string) *models.Room {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	
 	roomID := uuid.New().String()
 	room := models.NewRoom(roomID, name)
+	room.Topic = topic
+	if visibility != "" {
+		room.Visibility = visibility
+	}
 	h.rooms[roomID] = room
+	metrics.Rooms.Set(float64(len(h.rooms)))
+	h.publishRoom(models.MessageTypeRoomCreated, room)
+	webhook.Hooks.Publish(webhook.RoomEvent(room))
 	
 	return room
 }
 
-func (h *Hub) registerClient(client *client.Client) {
+// SetTopic changes a room's topic and updates everyone's room list. It
+// returns ErrRoomNotFound when there is no such room.
+func (h *Hub) SetTopic(roomID, topic string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, exists := h.rooms[roomID]
+	if !exists {
+		return models.ErrRoomNotFound
+	}
+	room.Topic = topic
+	h.publishRoom(models.MessageTypeRoomUpdated, room)
+	return nil
+}
+
+// IsMember reports whether a user is in a room. It returns ErrRoomNotFound
+// when there is no such room.
+func (h *Hub) IsMember(roomID, userID string) (bool, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	room, exists := h.rooms[roomID]
+	if !exists {
+		return false, models.ErrRoomNotFound
+	}
+	_, member := room.Users[userID]
+	return member, nil
+}
+
+func (h *Hub) registerClient(client client.Connection) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
 	h.clients[client] = true
 	h.userClients[client.GetUser().ID] = client
+	metrics.ConnectionsActive.Set(float64(len(h.clients)))
 
-	user := client.GetUser()
-	logger.Infof("User %s (%s) connected", user.Username, user.ID)
+	client.Logger().Info("client registered", "username", client.GetUser().Username, "transport", client.Transport(), "clients", len(h.clients))
 
 	// Send welcome message
-	welcomeMessage := &models.Message{
-		ID:        uuid.New().String(),
-		Type:      models.MessageTypeSystem,
-		Content:   "Welcome to the chat!",
-		Sender:    "System",
-		Timestamp: time.Now(),
+	if welcome, err := announce.Welcome(client.GetUser().Username); err != nil {
+		client.Logger().Warning("failed to render welcome message", "error", err)
+	} else if welcome != "" {
+		welcomeMessage := &models.Message{
+			ID:        uuid.New().String(),
+			Type:      models.MessageTypeSystem,
+			Content:   welcome,
+			Sender:    "System",
+			Timestamp: time.Now(),
+		}
+		client.SendMessage(welcomeMessage)
 	}
-	client.SendMessage(welcomeMessage)
 
-	// Send list of available rooms
-	roomsMessage := &models.Message{
-		ID:        uuid.New().String(),
-		Type:      models.MessageTypeSystem,
-		Content:   h.getRoomsList(),
-		Sender:    "System",
-		Timestamp: time.Now(),
+	// Send the rooms the user can see
+	client.SendMessage(h.roomsSnapshot(client.GetUser().ID))
+}
+
+func (h *Hub) detachClient(client client.Connection) {
+	grace := config.Get().WebSocket.ResumeGrace.Duration()
+	if grace <= 0 {
+		h.unregisterClient(client)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; !ok {
+		return
 	}
-	client.SendMessage(roomsMessage)
+	d := &detachedClient{conn: client}
+	d.timer = time.AfterFunc(grace, func() { h.expire <- d })
+	h.detached[client.ResumeToken()] = d
+	metrics.SessionsDetached.Set(float64(len(h.detached)))
+
+	client.Logger().Info("client detached", "grace", grace.String())
 }
 
-func (h *Hub) unregisterClient(client *client.Client) {
+func (h *Hub) resumeClient(req *ResumeRequest) client.Connection {
+	h.mu.Lock()
+	d, ok := h.detached[req.Token]
+	if !ok || d.conn.GetUser().ID != req.UserID {
+		h.mu.Unlock()
+		metrics.SessionResumes.WithLabelValues("not_found").Inc()
+		return nil
+	}
+	d.timer.Stop()
+	delete(h.detached, req.Token)
+	metrics.SessionsDetached.Set(float64(len(h.detached)))
+	h.mu.Unlock()
+
+	if !d.conn.Rewind(req.LastSeq) {
+		d.conn.Logger().Info("resume failed, missed events no longer buffered", "last_seq", req.LastSeq)
+		metrics.SessionResumes.WithLabelValues("gap").Inc()
+		h.unregisterClient(d.conn)
+		return nil
+	}
+
+	d.conn.Logger().Info("client resumed", "last_seq", req.LastSeq)
+	metrics.SessionResumes.WithLabelValues("resumed").Inc()
+	return d.conn
+}
+
+// dropDetached unregisters the user's detached client, if any. A fresh
+// connection means the old one will never resume.
+func (h *Hub) dropDetached(userID string) {
+	h.mu.Lock()
+	var dropped *detachedClient
+	for token, d := range h.detached {
+		if d.conn.GetUser().ID == userID {
+			d.timer.Stop()
+			delete(h.detached, token)
+			dropped = d
+			break
+		}
+	}
+	metrics.SessionsDetached.Set(float64(len(h.detached)))
+	h.mu.Unlock()
+
+	if dropped != nil {
+		h.unregisterClient(dropped.conn)
+	}
+}
+
+// expireClient unregisters a detached client whose grace period ran out
+func (h *Hub) expireClient(d *detachedClient) {
+	token := d.conn.ResumeToken()
+	h.mu.Lock()
+	if h.detached[token] != d {
+		// Resumed, or replaced by a newer detach, before the timer fired
+		h.mu.Unlock()
+		return
+	}
+	delete(h.detached, token)
+	metrics.SessionsDetached.Set(float64(len(h.detached)))
+	h.mu.Unlock()
+
+	d.conn.Logger().Info("resume grace period expired")
+	h.unregisterClient(d.conn)
+}
+
+func (h *Hub) unregisterClient(client client.Connection) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
@@ -212,9 +663,13 @@ func (h *Hub) unregisterClient(client *client.Client) {
 		roomID := client.GetRoomID()
 
 		// Remove from room if in one
+		var left *models.Room
 		if roomID != "" {
 			if room, exists := h.rooms[roomID]; exists {
-				room.RemoveUser(user.ID)
+				h.removeRoomUser(room, user.ID)
+				h.markSeen(user.ID, roomID)
+				webhook.Hooks.Publish(webhook.UserEvent(webhook.UserLeft, roomID, user))
+				left = room
 				
 				// Notify room about user leaving
 				leaveMessage := &models.Message{
@@ -230,25 +685,66 @@ func (h *Hub) unregisterClient(client *client.Client) {
 		}
 
 		delete(h.clients, client)
-		delete(h.userClients, user.ID)
+		// The user may have reconnected on a new connection meanwhile
+		if h.userClients[user.ID] == client {
+			delete(h.userClients, user.ID)
+		}
+		metrics.ConnectionsActive.Set(float64(len(h.clients)))
+		if left != nil {
+			h.publishRoom(models.MessageTypeRoomUpdated, left)
+		}
 		
-		logger.Infof("User %s (%s) disconnected", user.Username, user.ID)
+		client.Logger().Info("client unregistered", "username", user.Username, logger.RoomID, roomID, "clients", len(h.clients))
 	}
 }
 
-func (h *Hub) broadcastMessage(message *models.Message) {
+func (h *Hub) broadcastMessage(message *models.Message) error {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	if message.Room != "" {
-		// Add message to room history
-		if room, exists := h.rooms[message.Room]; exists {
-			room.AddMessage(message)
+	ctx, span := startDispatch("hub.broadcast", message)
+	defer span.End()
+	span.SetAttributes(tracing.Attr(logger.RoomID, message.Room))
+
+	// Add message to room history
+	room, exists := h.rooms[message.Room]
+	if !exists {
+		metrics.MessagesDropped.WithLabelValues("room_not_found").Inc()
+		span.SetStatus(tracing.StatusError, "room not found")
+		return models.ErrRoomNotFound
+	}
+	if message.Type == models.MessageTypeText {
+		format(message)
+		message.Mentions = mentions(room, message)
+	}
+	// Typing indicators are transient and never kept in history
+	if message.Type != models.MessageTypeTyping {
+		room.AddMessage(message, config.Get().Hub.MaxRoomHistory)
+		metrics.MessagesTotal.WithLabelValues("broadcast").Inc()
+	}
+
+	// Broadcast to room
+	for userID := range room.Users {
+		if client, exists := h.userClients[userID]; exists {
+			deliver(ctx, client, message)
 		}
-		
-		// Broadcast to room
-		h.broadcastToRoom(message.Room, message)
 	}
+
+	if message.Type == models.MessageTypeText {
+		webhook.Hooks.Publish(webhook.MessageEvent(message))
+	}
+
+	// Former members see the room's unread count go up
+	if countsAsUnread(message) {
+		for userID, seen := range h.lastSeen {
+			_, wasHere := seen[room.ID]
+			_, member := room.Users[userID]
+			if client, exists := h.userClients[userID]; exists && wasHere && !member && userID != message.SenderID {
+				client.SendMessage(roomEvent(models.MessageTypeRoomUpdated, h.roomInfo(room, userID)))
+			}
+		}
+	}
+	return nil
 }
 
 func (h *Hub) broadcastToRoom(roomID string, message *models.Message) {
@@ -264,26 +760,206 @@ func (h *Hub) broadcastToRoom(roomID string, message *models.Message) {
 	}
 }
 
-func (h *Hub) sendPrivateMessage(pm *PrivateMessage) {
+// startDispatch opens the hub span for a message, continuing the trace
+// started where the message entered the server
+func startDispatch(name string, message *models.Message) (context.Context, *tracing.Span) {
+	ctx := tracing.ContextWithRemoteParent(context.Background(), message.TraceParent)
+	return tracing.Start(ctx, name,
+		tracing.WithAttributes(
+			tracing.Attr("message.id", message.ID),
+			tracing.Attr(logger.UserID, message.SenderID),
+		))
+}
+
+// deliver queues a message for one recipient. When the message is traced the
+// recipient gets a copy carrying its own delivery span, so the write on the
+// connection is attributed to the right recipient.
+func deliver(ctx context.Context, c client.Connection, message *models.Message) {
+	if tracing.SpanFromContext(ctx) == nil {
+		c.SendMessage(message)
+		return
+	}
+
+	depth, _ := c.QueueDepth()
+	_, span := tracing.Start(ctx, "hub.deliver",
+		tracing.WithAttributes(
+			tracing.Attr(logger.ConnectionID, c.ConnectionID()),
+			tracing.Attr("recipient_id", c.GetUser().ID),
+			tracing.Attr("transport", c.Transport()),
+			tracing.Attr("queue_depth", depth),
+		))
+	defer span.End()
+
+	copied := *message
+	copied.TraceParent = span.TraceParent()
+	c.SendMessage(&copied)
+}
+
+func (h *Hub) sendPrivateMessage(pm *PrivateMessage) error {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
+	ctx, span := startDispatch("hub.private", pm.Message)
+	defer span.End()
+	format(pm.Message)
+
 	if client, exists := h.userClients[pm.UserID]; exists {
-		client.SendMessage(pm.Message)
+		// Messages from the server itself have no sender and always go through
+		if sender := pm.Message.SenderID; sender != "" && !privacy.Users.AcceptsDirect(pm.UserID, sender, h.shareRoom(pm.UserID, sender)) {
+			metrics.MessagesDropped.WithLabelValues("dm_not_allowed").Inc()
+			span.SetStatus(tracing.StatusError, "recipient doesn't accept private messages from sender")
+			return models.ErrDMNotAllowed
+		}
+		metrics.MessagesTotal.WithLabelValues("private").Inc()
+		deliver(ctx, client, pm.Message)
+		return nil
 	}
+	metrics.MessagesDropped.WithLabelValues("recipient_offline").Inc()
+	span.SetStatus(tracing.StatusError, "recipient not connected")
+	logger.Debug("private message recipient not connected", logger.UserID, pm.Message.SenderID, "recipient_id", pm.UserID)
+	return models.ErrUserNotFound
 }
 
-func (h *Hub) handleJoinRoom(op *RoomOperation) {
+func (h *Hub) sendEphemeral(em *EphemeralMessage) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ctx, span := startDispatch("hub.ephemeral", em.Message)
+	defer span.End()
+	span.SetAttributes(tracing.Attr(logger.RoomID, em.Message.Room))
+
+	var target client.Connection
+	if em.ConnectionID != "" {
+		for c := range h.clients {
+			if c.ConnectionID() == em.ConnectionID {
+				target = c
+				break
+			}
+		}
+	} else {
+		target = h.userClients[em.UserID]
+	}
+	if target == nil {
+		metrics.MessagesDropped.WithLabelValues("recipient_offline").Inc()
+		span.SetStatus(tracing.StatusError, "recipient not connected")
+		if em.ConnectionID != "" {
+			return models.ErrConnectionNotFound
+		}
+		return models.ErrUserNotFound
+	}
+	if _, exists := h.rooms[em.Message.Room]; !exists {
+		metrics.MessagesDropped.WithLabelValues("room_not_found").Inc()
+		span.SetStatus(tracing.StatusError, "room not found")
+		return models.ErrRoomNotFound
+	}
+	if target.GetRoomID() != em.Message.Room {
+		metrics.MessagesDropped.WithLabelValues("not_member").Inc()
+		span.SetStatus(tracing.StatusError, "recipient not in room")
+		return models.ErrNotMember
+	}
+
+	copied := *em.Message
+	format(&copied)
+	copied.Ephemeral = true
+	copied.Recipient = target.GetUser().ID
+	metrics.MessagesTotal.WithLabelValues("ephemeral").Inc()
+	deliver(ctx, target, &copied)
+	return nil
+}
+
+// shareRoom reports whether two users are connected and in the same room
+func (h *Hub) shareRoom(userID, otherID string) bool {
+	c, ok := h.userClients[userID]
+	other, otherOK := h.userClients[otherID]
+	return ok && otherOK && c.GetRoomID() != "" && c.GetRoomID() == other.GetRoomID()
+}
+
+// mentionPattern matches an @username in message content
+var mentionPattern = regexp.MustCompile(`@([\p{L}\p{N}_.-]*[\p{L}\p{N}_])`)
+
+// mentions returns the IDs of the room members a message @mentions by
+// username, leaving out the sender and members who blocked the sender. A
+// markdown message's mention entities are given the IDs of the members they
+// name.
+func mentions(room *models.Room, message *models.Message) []string {
+	for i, entity := range message.Entities {
+		if entity.Type != models.EntityMention {
+			continue
+		}
+		for id, user := range room.Users {
+			if strings.EqualFold(user.Username, entity.Text) {
+				message.Entities[i].UserID = id
+				break
+			}
+		}
+	}
+
+	var ids []string
+	for _, name := range mentioned(message) {
+		for id, user := range room.Users {
+			if id == message.SenderID || !strings.EqualFold(user.Username, name) || slices.Contains(ids, id) {
+				continue
+			}
+			if privacy.Users.Blocks(id, message.SenderID) {
+				continue
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// mentioned returns the usernames a message @mentions. Mentions in markdown
+// code don't count.
+func mentioned(message *models.Message) []string {
+	var names []string
+	if message.Format == models.FormatMarkdown {
+		for _, entity := range message.Entities {
+			if entity.Type == models.EntityMention {
+				names = append(names, entity.Text)
+			}
+		}
+		return names
+	}
+	for _, match := range mentionPattern.FindAllStringSubmatch(message.Content, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// format renders a markdown message's content, as it stands after
+// moderation, into its HTML and entities. Content that no longer renders,
+// e.g. once redacted, is sent as plain text.
+func format(message *models.Message) {
+	if message.Format != models.FormatMarkdown {
+		return
+	}
+	html, entities, err := markdown.Render(message.Content)
+	if err != nil {
+		logger.Debug("markdown not rendered, sending as plain text", "message_id", message.ID, "error", err)
+		message.Format, message.HTML, message.Entities = models.FormatPlain, "", nil
+		return
+	}
+	message.HTML, message.Entities = html, entities
+}
+
+func (h *Hub) handleJoinRoom(op *RoomOperation) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
 	user := op.Client.GetUser()
+	if ban := moderation.Sanctions.Find(moderation.Ban, user.ID, op.RoomID); ban != nil {
+		return ban.Err()
+	}
 	
 	// Leave current room if in one
 	currentRoom := op.Client.GetRoomID()
 	if currentRoom != "" {
 		if room, exists := h.rooms[currentRoom]; exists {
-			room.RemoveUser(user.ID)
+			h.removeRoomUser(room, user.ID)
+			h.markSeen(user.ID, currentRoom)
+			h.publishRoom(models.MessageTypeRoomUpdated, room)
+			webhook.Hooks.Publish(webhook.UserEvent(webhook.UserLeft, currentRoom, user))
 			
 			leaveMessage := &models.Message{
 				ID:        uuid.New().String(),
@@ -303,11 +979,19 @@ func (h *Hub) handleJoinRoom(op *RoomOperation) {
 		// Create room if it doesn't exist
 		room = models.NewRoom(op.RoomID, op.RoomID)
 		h.rooms[op.RoomID] = room
+		metrics.Rooms.Set(float64(len(h.rooms)))
 	}
 
-	room.AddUser(user)
+	h.addRoomUser(room, user)
 	user.Room = op.RoomID
 	op.Client.SetRoomID(op.RoomID)
+	if exists {
+		h.publishRoom(models.MessageTypeRoomUpdated, room)
+	} else {
+		h.publishRoom(models.MessageTypeRoomCreated, room)
+		webhook.Hooks.Publish(webhook.RoomEvent(room))
+	}
+	webhook.Hooks.Publish(webhook.UserEvent(webhook.UserJoined, op.RoomID, user))
 
 	// Send join message to room
 	joinMessage := &models.Message{
@@ -325,38 +1009,418 @@ func (h *Hub) handleJoinRoom(op *RoomOperation) {
 		op.Client.SendMessage(msg)
 	}
 
-	logger.Infof("User %s joined room %s", user.Username, op.RoomID)
+	// Then the room's welcome message, if it has one
+	if welcome, err := announce.RoomWelcome(user.Username, room.ID, room.Name); err != nil {
+		op.Client.Logger().Warning("failed to render room welcome message", logger.RoomID, room.ID, "error", err)
+	} else if welcome != "" {
+		op.Client.SendMessage(&models.Message{
+			ID:        uuid.New().String(),
+			Type:      models.MessageTypeSystem,
+			Content:   welcome,
+			Sender:    "System",
+			Room:      room.ID,
+			Timestamp: time.Now(),
+		})
+	}
+
+	op.Client.Logger().Info("joined room", logger.RoomID, op.RoomID, "previous_room_id", currentRoom, "members", len(room.Users))
+	return nil
 }
 
-func (h *Hub) handleLeaveRoom(op *RoomOperation) {
+func (h *Hub) handleLeaveRoom(op *RoomOperation) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
 	user := op.Client.GetUser()
-	
-	if room, exists := h.rooms[op.RoomID]; exists {
-		room.RemoveUser(user.ID)
-		user.Room = ""
-		op.Client.SetRoomID("")
 
-		leaveMessage := &models.Message{
-			ID:        uuid.New().String(),
-			Type:      models.MessageTypeLeave,
-			Content:   user.Username + " left the room",
-			Sender:    "System",
-			Room:      op.RoomID,
-			Timestamp: time.Now(),
+	room, exists := h.rooms[op.RoomID]
+	if !exists {
+		return models.ErrRoomNotFound
+	}
+	if op.Client.GetRoomID() != op.RoomID {
+		return models.ErrNotMember
+	}
+
+	h.removeRoomUser(room, user.ID)
+	user.Room = ""
+	op.Client.SetRoomID("")
+	h.markSeen(user.ID, op.RoomID)
+	h.publishRoom(models.MessageTypeRoomUpdated, room)
+	webhook.Hooks.Publish(webhook.UserEvent(webhook.UserLeft, op.RoomID, user))
+
+	leaveMessage := &models.Message{
+		ID:        uuid.New().String(),
+		Type:      models.MessageTypeLeave,
+		Content:   user.Username + " left the room",
+		Sender:    "System",
+		Room:      op.RoomID,
+		Timestamp: time.Now(),
+	}
+	h.broadcastToRoom(op.RoomID, leaveMessage)
+
+	op.Client.Logger().Info("left room", logger.RoomID, op.RoomID)
+	return nil
+}
+
+func (h *Hub) handleKick(op *UserOperation) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, exists := h.rooms[op.RoomID]
+	if !exists {
+		return models.ErrRoomNotFound
+	}
+
+	var kicked *models.User
+	for c := range h.clients {
+		if c.GetUser().ID == op.UserID && c.GetRoomID() == op.RoomID {
+			c.GetUser().Room = ""
+			c.SetRoomID("")
+			kicked = c.GetUser()
+			c.Logger().Info("kicked from room", logger.RoomID, op.RoomID)
+		}
+	}
+	if kicked == nil {
+		return models.ErrNotMember
+	}
+
+	h.removeRoomUser(room, op.UserID)
+	h.markSeen(op.UserID, op.RoomID)
+	h.publishRoom(models.MessageTypeRoomUpdated, room)
+	webhook.Hooks.Publish(webhook.UserEvent(webhook.UserLeft, op.RoomID, kicked))
+	return nil
+}
+
+func (h *Hub) handleDisconnect(op *UserOperation) error {
+	h.mu.Lock()
+	var conns []client.Connection
+	for c := range h.clients {
+		if c.GetUser().ID == op.UserID {
+			conns = append(conns, c)
+		}
+	}
+	for token, d := range h.detached {
+		if d.conn.GetUser().ID == op.UserID {
+			d.timer.Stop()
+			delete(h.detached, token)
+		}
+	}
+	metrics.SessionsDetached.Set(float64(len(h.detached)))
+	h.mu.Unlock()
+
+	if len(conns) == 0 {
+		return models.ErrUserNotFound
+	}
+	for _, c := range conns {
+		c.Logger().Info("disconnecting client")
+		h.unregisterClient(c)
+		c.Close()
+	}
+	return nil
+}
+
+func (h *Hub) handleCloseConnection(op *ConnectionOperation) error {
+	h.mu.Lock()
+	var conn client.Connection
+	for c := range h.clients {
+		if c.ConnectionID() == op.ConnectionID {
+			conn = c
+			break
+		}
+	}
+	if conn != nil {
+		if d, ok := h.detached[conn.ResumeToken()]; ok {
+			d.timer.Stop()
+			delete(h.detached, conn.ResumeToken())
+			metrics.SessionsDetached.Set(float64(len(h.detached)))
+		}
+	}
+	h.mu.Unlock()
+
+	if conn == nil {
+		return models.ErrConnectionNotFound
+	}
+	conn.Logger().Info("closing connection")
+	h.unregisterClient(conn)
+	conn.Close()
+	return nil
+}
+
+func (h *Hub) handleDeleteRoom(op *RoomOperation) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if op.RoomID == "general" {
+		return &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: "The default room can't be deleted"}
+	}
+	room, exists := h.rooms[op.RoomID]
+	if !exists {
+		return models.ErrRoomNotFound
+	}
+
+	notice := &models.Message{
+		ID:        uuid.New().String(),
+		Type:      models.MessageTypeSystem,
+		Content:   "The room " + room.Name + " was deleted",
+		Sender:    "System",
+		Room:      room.ID,
+		Timestamp: time.Now(),
+	}
+	deleted := &models.Message{
+		ID:        uuid.New().String(),
+		Type:      models.MessageTypeRoomDeleted,
+		Sender:    "System",
+		Room:      room.ID,
+		Timestamp: time.Now(),
+	}
+	for c := range h.clients {
+		if c.GetRoomID() == room.ID {
+			c.GetUser().Room = ""
+			c.SetRoomID("")
+			c.SendMessage(notice)
+		}
+		if h.listed(room, c.GetUser().ID) {
+			c.SendMessage(deleted)
+		}
+	}
+	for _, seen := range h.lastSeen {
+		delete(seen, room.ID)
+	}
+
+	delete(h.rooms, room.ID)
+	metrics.Rooms.Set(float64(len(h.rooms)))
+	if h.metricRooms[room.ID] {
+		metrics.RoomUsers.DeleteLabelValues(room.ID)
+	} else {
+		metrics.RoomUsers.WithLabelValues("other").Add(-float64(len(room.Users)))
+	}
+	logger.Info("room deleted", logger.RoomID, room.ID, "members", len(room.Users))
+	return nil
+}
+
+func (h *Hub) handlePurge(req *PurgeRequest) PurgeResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, exists := h.rooms[req.RoomID]
+	if !exists {
+		return PurgeResult{Err: models.ErrRoomNotFound}
+	}
+
+	kept := room.Messages[:0]
+	for _, message := range room.Messages {
+		if req.UserID == "" || message.SenderID == req.UserID {
+			continue
 		}
-		h.broadcastToRoom(op.RoomID, leaveMessage)
+		kept = append(kept, message)
 	}
+	purged := len(room.Messages) - len(kept)
+	clear(room.Messages[len(kept):])
+	room.Messages = kept
 
-	logger.Infof("User %s left room %s", user.Username, op.RoomID)
+	logger.Info("room messages purged", logger.RoomID, room.ID, logger.UserID, req.UserID, "purged", purged)
+	return PurgeResult{Purged: purged}
 }
 
-func (h *Hub) getRoomsList() string {
-	rooms := "Available rooms: "
+func (h *Hub) announceMessage(message *models.Message) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ctx, span := startDispatch("hub.announce", message)
+	defer span.End()
+
+	for c := range h.clients {
+		deliver(ctx, c, message)
+	}
+	metrics.MessagesTotal.WithLabelValues("announcement").Inc()
+	return nil
+}
+
+// roomsSnapshot builds the room list event for userID, sorted by name
+func (h *Hub) roomsSnapshot(userID string) *models.Message {
+	rooms := make([]models.RoomInfo, 0, len(h.rooms))
 	for _, room := range h.rooms {
-		rooms += room.Name + " (" + room.ID + "), "
+		if h.listed(room, userID) {
+			rooms = append(rooms, h.roomInfo(room, userID))
+		}
 	}
-	return rooms
+	sort.Slice(rooms, func(i, j int) bool {
+		if rooms[i].Name != rooms[j].Name {
+			return rooms[i].Name < rooms[j].Name
+		}
+		return rooms[i].ID < rooms[j].ID
+	})
+	return roomEvent(models.MessageTypeRoomsSnapshot, rooms...)
+}
+
+// publishRoom sends a room_created or room_updated event to every client
+// the room is listed to, each with its own unread count
+func (h *Hub) publishRoom(eventType models.MessageType, room *models.Room) {
+	for c := range h.clients {
+		userID := c.GetUser().ID
+		if h.listed(room, userID) {
+			c.SendMessage(roomEvent(eventType, h.roomInfo(room, userID)))
+		}
+	}
+}
+
+// roomEvent builds a room list event
+func roomEvent(eventType models.MessageType, rooms ...models.RoomInfo) *models.Message {
+	return &models.Message{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		Sender:    "System",
+		Rooms:     rooms,
+		Timestamp: time.Now(),
+	}
+}
+
+// roomInfo describes a room as userID sees it in the room list. Unread
+// counts what arrived since the user last left the room; it is 0 while the
+// user is in the room and for rooms they have never been in.
+func (h *Hub) roomInfo(room *models.Room, userID string) models.RoomInfo {
+	info := models.RoomInfo{
+		ID:         room.ID,
+		Name:       room.Name,
+		Topic:      room.Topic,
+		Members:    len(room.Users),
+		Visibility: room.Visibility,
+	}
+	if _, member := room.Users[userID]; member {
+		return info
+	}
+	if seen, ok := h.lastSeen[userID][room.ID]; ok {
+		for _, message := range room.Messages {
+			if countsAsUnread(message) && message.SenderID != userID && message.Timestamp.After(seen) {
+				info.Unread++
+			}
+		}
+	}
+	return info
+}
+
+// countsAsUnread reports whether a room message adds to unread counts
+func countsAsUnread(message *models.Message) bool {
+	switch message.Type {
+	case models.MessageTypeText, models.MessageTypeAction, models.MessageTypeAnnouncement:
+		return true
+	}
+	return false
+}
+
+// listed reports whether room appears in userID's room list. Private rooms
+// are only listed to users who are or have been in them.
+func (h *Hub) listed(room *models.Room, userID string) bool {
+	if room.Visibility != models.RoomPrivate {
+		return true
+	}
+	_, member := room.Users[userID]
+	_, seen := h.lastSeen[userID][room.ID]
+	return member || seen
+}
+
+// markSeen records that userID just left roomID
+func (h *Hub) markSeen(userID, roomID string) {
+	seen, ok := h.lastSeen[userID]
+	if !ok {
+		seen = make(map[string]time.Time)
+		h.lastSeen[userID] = seen
+	}
+	seen[roomID] = time.Now()
+}
+
+// addRoomUser adds user to room and counts them in chat_room_users. h.mu
+// must be held.
+func (h *Hub) addRoomUser(room *models.Room, user *models.User) {
+	before := len(room.Users)
+	room.AddUser(user)
+	h.observeRoomUsers(room, len(room.Users)-before)
+}
+
+// removeRoomUser removes a user from room and from chat_room_users. h.mu
+// must be held.
+func (h *Hub) removeRoomUser(room *models.Room, userID string) {
+	before := len(room.Users)
+	room.RemoveUser(userID)
+	h.observeRoomUsers(room, len(room.Users)-before)
+}
+
+// observeRoomUsers applies a change in room's member count to its series
+func (h *Hub) observeRoomUsers(room *models.Room, delta int) {
+	if delta == 0 {
+		return
+	}
+	label := "other"
+	if h.metricRooms[room.ID] {
+		label = room.ID
+	}
+	metrics.RoomUsers.WithLabelValues(label).Add(float64(delta))
+}
+
+// Snapshot is a point-in-time view of the hub for diagnostics
+type Snapshot struct {
+	Clients     int                  `json:"clients"`
+	Rooms       []RoomSnapshot       `json:"rooms"`
+	Connections []ConnectionSnapshot `json:"connections"`
+	LastEvent   time.Time            `json:"last_event"`
+}
+
+// RoomSnapshot describes one room
+type RoomSnapshot struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Users    int    `json:"users"`
+	Messages int    `json:"messages"`
+}
+
+// ConnectionSnapshot describes one client's send queue
+type ConnectionSnapshot struct {
+	ConnectionID  string `json:"connection_id"`
+	UserID        string `json:"user_id"`
+	Username      string `json:"username"`
+	RoomID        string `json:"room_id,omitempty"`
+	Transport     string `json:"transport"`
+	Detached      bool   `json:"detached,omitempty"`
+	QueueDepth    int    `json:"queue_depth"`
+	QueueCapacity int    `json:"queue_capacity"`
+}
+
+// Snapshot returns the current rooms, counts and send-queue depths
+func (h *Hub) Snapshot() Snapshot {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	snapshot := Snapshot{
+		Clients:     len(h.clients),
+		Rooms:       make([]RoomSnapshot, 0, len(h.rooms)),
+		Connections: make([]ConnectionSnapshot, 0, len(h.clients)),
+		LastEvent:   h.LastEvent(),
+	}
+	for _, room := range h.rooms {
+		snapshot.Rooms = append(snapshot.Rooms, RoomSnapshot{
+			ID:       room.ID,
+			Name:     room.Name,
+			Users:    len(room.Users),
+			Messages: len(room.Messages),
+		})
+	}
+	for c := range h.clients {
+		depth, capacity := c.QueueDepth()
+		snapshot.Connections = append(snapshot.Connections, ConnectionSnapshot{
+			ConnectionID:  c.ConnectionID(),
+			UserID:        c.GetUser().ID,
+			Username:      c.GetUser().Username,
+			RoomID:        c.GetRoomID(),
+			Transport:     c.Transport(),
+			Detached:      h.detached[c.ResumeToken()] != nil,
+			QueueDepth:    depth,
+			QueueCapacity: capacity,
+		})
+	}
+
+	sort.Slice(snapshot.Rooms, func(i, j int) bool { return snapshot.Rooms[i].ID < snapshot.Rooms[j].ID })
+	sort.Slice(snapshot.Connections, func(i, j int) bool {
+		return snapshot.Connections[i].ConnectionID < snapshot.Connections[j].ConnectionID
+	})
+	return snapshot
 }
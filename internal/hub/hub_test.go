@@ -0,0 +1,205 @@
+package hub
+
+import (
+	"chatstreamapp/internal/client"
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/metrics"
+	"chatstreamapp/internal/models"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testConn is a connection with no transport behind it; what the hub sends
+// it stays in its queue
+type testConn struct {
+	*client.Base
+}
+
+func (testConn) Transport() string { return "test" }
+
+func newTestConn(userID string) testConn {
+	return testConn{client.NewBase(&models.User{ID: userID, Username: userID}, logger.With())}
+}
+
+func TestIsMember(t *testing.T) {
+	h := NewHub()
+	go h.Run()
+
+	alice := newTestConn("alice")
+	h.Register(alice)
+	if err := h.JoinRoom(alice, "dev"); err != nil {
+		t.Fatalf("JoinRoom() = %v", err)
+	}
+
+	tests := []struct {
+		room, user string
+		member     bool
+		err        error
+	}{
+		{"dev", "alice", true, nil},
+		{"dev", "bob", false, nil},
+		{"missing", "alice", false, models.ErrRoomNotFound},
+	}
+	for _, tt := range tests {
+		member, err := h.IsMember(tt.room, tt.user)
+		if member != tt.member || !errors.Is(err, tt.err) {
+			t.Errorf("IsMember(%q, %q) = %v, %v; want %v, %v", tt.room, tt.user, member, err, tt.member, tt.err)
+		}
+	}
+
+	// Membership changes while it is checked; run with -race
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			h.LeaveRoom(alice, "dev")
+			h.JoinRoom(alice, "dev")
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		h.IsMember("dev", "alice")
+	}
+	wg.Wait()
+}
+
+// roomUsers scrapes chat_room_users, by room label
+func roomUsers(t *testing.T) map[string]float64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	users := map[string]float64{}
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		series, ok := strings.CutPrefix(line, `chat_room_users{room="`)
+		if !ok {
+			continue
+		}
+		room, value, _ := strings.Cut(series, `"} `)
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("chat_room_users line %q: %v", line, err)
+		}
+		users[room] = f
+	}
+	return users
+}
+
+func TestRoomUsersMetric(t *testing.T) {
+	h := NewHub()
+	go h.Run()
+	before := roomUsers(t)
+
+	check := func(step string, general, other float64) {
+		t.Helper()
+		users := roomUsers(t)
+		if got := users["general"] - before["general"]; got != general {
+			t.Errorf("%s: general changed by %v, want %v", step, got, general)
+		}
+		if got := users["other"] - before["other"]; got != other {
+			t.Errorf("%s: other changed by %v, want %v", step, got, other)
+		}
+		for label := range users {
+			if strings.HasPrefix(label, "client-room-") {
+				t.Errorf("%s: chat_room_users is labelled with client-created room %s", step, label)
+			}
+		}
+	}
+
+	conns := map[string]testConn{}
+	for _, join := range []struct{ user, room string }{
+		{"alice", "general"},
+		{"bob", "general"},
+		{"carol", "client-room-a"},
+		{"dave", "client-room-b"},
+	} {
+		conns[join.user] = newTestConn(join.user)
+		h.Register(conns[join.user])
+		if err := h.JoinRoom(conns[join.user], join.room); err != nil {
+			t.Fatalf("JoinRoom() = %v", err)
+		}
+	}
+	check("joined", 2, 2)
+
+	if err := h.JoinRoom(conns["bob"], "client-room-a"); err != nil {
+		t.Fatalf("JoinRoom() = %v", err)
+	}
+	check("moved", 1, 3)
+
+	if err := h.LeaveRoom(conns["dave"], "client-room-b"); err != nil {
+		t.Fatalf("LeaveRoom() = %v", err)
+	}
+	check("left", 1, 2)
+
+	if err := h.DeleteRoom("client-room-a"); err != nil {
+		t.Fatalf("DeleteRoom() = %v", err)
+	}
+	check("deleted", 1, 0)
+}
+
+func TestResume(t *testing.T) {
+	cfg := config.Default()
+	cfg.WebSocket.ResumeGrace = config.Duration(time.Minute)
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	h := NewHub()
+	go h.Run()
+
+	alice, bob := newTestConn("alice"), newTestConn("bob")
+	for _, conn := range []testConn{alice, bob} {
+		h.Register(conn)
+		if err := h.JoinRoom(conn, "dev"); err != nil {
+			t.Fatalf("JoinRoom() = %v", err)
+		}
+	}
+	var lastSeq uint64
+	for len(alice.Send) > 0 {
+		lastSeq = (<-alice.Send).Seq
+	}
+
+	// Alice drops; messages sent meanwhile wait for her
+	h.Detach(alice)
+	for _, content := range []string{"one", "two"} {
+		if err := h.Broadcast(&models.Message{Type: models.MessageTypeText, Content: content, SenderID: "bob", Room: "dev"}); err != nil {
+			t.Fatalf("Broadcast() = %v", err)
+		}
+	}
+
+	if conn := h.Resume(alice.ResumeToken(), "bob", lastSeq); conn != nil {
+		t.Error("Resume() with another user's ID succeeded")
+	}
+	if conn := h.Resume("wrong-token", "alice", lastSeq); conn != nil {
+		t.Error("Resume() with a wrong token succeeded")
+	}
+
+	conn := h.Resume(alice.ResumeToken(), "alice", lastSeq)
+	if conn != alice {
+		t.Fatalf("Resume() = %v, want alice's connection", conn)
+	}
+	var missed []string
+	for len(alice.Send) > 0 {
+		if message := <-alice.Send; message.Type == models.MessageTypeText {
+			missed = append(missed, message.Content)
+		}
+	}
+	if !slices.Equal(missed, []string{"one", "two"}) {
+		t.Errorf("replayed %v, want [one two]", missed)
+	}
+	if member, _ := h.IsMember("dev", "alice"); !member {
+		t.Error("alice left dev while detached")
+	}
+
+	// A token resumes once
+	if h.Resume(alice.ResumeToken(), "alice", lastSeq) != nil {
+		t.Error("Resume() succeeded twice with one token")
+	}
+}
@@ -1,49 +1,184 @@
 package logger
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Standard field names shared by every package
+const (
+	UserID       = "user_id"
+	RoomID       = "room_id"
+	ConnectionID = "connection_id"
+	RequestID    = "request_id"
 )
 
 var (
-	InfoLogger    *log.Logger
-	WarningLogger *log.Logger
-	ErrorLogger   *log.Logger
+	// Minimum level, adjustable at runtime
+	level slog.LevelVar
+
+	base atomic.Pointer[slog.Logger]
 )
 
+type contextKey struct{}
+
 func init() {
-	InfoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	WarningLogger = log.New(os.Stdout, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
-	ErrorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	base.Store(slog.New(newHandler(os.Stdout, "logfmt")))
+}
+
+// Configure selects the output format ("json" or "logfmt") and minimum level
+func Configure(format, minLevel string) error {
+	if err := SetLevel(minLevel); err != nil {
+		return err
+	}
+	return SetOutput(os.Stdout, format)
+}
+
+// SetOutput writes events to w in the given format ("json" or "logfmt")
+func SetOutput(w io.Writer, format string) error {
+	switch format {
+	case "json", "logfmt":
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	base.Store(slog.New(newHandler(w, format)))
+	return nil
+}
+
+func newHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{
+		AddSource: true,
+		Level:     &level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			// Keep source short: file:line instead of the full path
+			if a.Key == slog.SourceKey {
+				if src, ok := a.Value.Any().(*slog.Source); ok {
+					file := src.File
+					if i := strings.LastIndexByte(file, '/'); i >= 0 {
+						file = file[i+1:]
+					}
+					return slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", file, src.Line))
+				}
+			}
+			return a
+		},
+	}
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// ParseLevel converts a level name such as "info" into a slog level
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warning", "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// SetLevel changes the minimum level at runtime
+func SetLevel(name string) error {
+	l, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// With returns a logger that adds the given key/value fields to every event
+func With(args ...any) *Logger {
+	return &Logger{l: base.Load().With(args...)}
+}
+
+// NewContext returns a context carrying the logger
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx, or the base logger
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return &Logger{l: base.Load()}
+}
+
+// Logger writes structured events with a fixed set of fields
+type Logger struct {
+	l *slog.Logger
 }
 
-// Info logs info messages
-func Info(v ...interface{}) {
-	InfoLogger.Println(v...)
+// With returns a logger with additional fields
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{l: l.l.With(args...)}
 }
 
-// Warning logs warning messages
-func Warning(v ...interface{}) {
-	WarningLogger.Println(v...)
+// Debug logs a debug event
+func (l *Logger) Debug(msg string, args ...any) {
+	write(l.l, slog.LevelDebug, msg, args)
 }
 
-// Error logs error messages
-func Error(v ...interface{}) {
-	ErrorLogger.Println(v...)
+// Info logs an info event
+func (l *Logger) Info(msg string, args ...any) {
+	write(l.l, slog.LevelInfo, msg, args)
 }
 
-// Infof logs formatted info messages
-func Infof(format string, v ...interface{}) {
-	InfoLogger.Printf(format, v...)
+// Warning logs a warning event
+func (l *Logger) Warning(msg string, args ...any) {
+	write(l.l, slog.LevelWarn, msg, args)
 }
 
-// Warningf logs formatted warning messages
-func Warningf(format string, v ...interface{}) {
-	WarningLogger.Printf(format, v...)
+// Error logs an error event
+func (l *Logger) Error(msg string, args ...any) {
+	write(l.l, slog.LevelError, msg, args)
 }
 
-// Errorf logs formatted error messages
-func Errorf(format string, v ...interface{}) {
-	ErrorLogger.Printf(format, v...)
+// Debug logs a debug event
+func Debug(msg string, args ...any) {
+	write(base.Load(), slog.LevelDebug, msg, args)
 }
 
+// Info logs an info event
+func Info(msg string, args ...any) {
+	write(base.Load(), slog.LevelInfo, msg, args)
+}
+
+// Warning logs a warning event
+func Warning(msg string, args ...any) {
+	write(base.Load(), slog.LevelWarn, msg, args)
+}
+
+// Error logs an error event
+func Error(msg string, args ...any) {
+	write(base.Load(), slog.LevelError, msg, args)
+}
+
+// write records the event with the caller of the exported function as source
+func write(l *slog.Logger, lvl slog.Level, msg string, args []any) {
+	ctx := context.Background()
+	if !l.Enabled(ctx, lvl) {
+		return
+	}
+
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), lvl, msg, pcs[0])
+	r.Add(args...)
+	_ = l.Handler().Handle(ctx, r)
+}
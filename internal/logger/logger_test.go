@@ -0,0 +1,169 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// capture sends events to a buffer until the test ends
+func capture(t *testing.T, format, minLevel string) *bytes.Buffer {
+	t.Helper()
+	var out bytes.Buffer
+	if err := SetOutput(&out, format); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLevel(minLevel); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		SetOutput(os.Stdout, "logfmt")
+		SetLevel("info")
+	})
+	return &out
+}
+
+// events decodes the JSON events written so far
+func events(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var decoded []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var event map[string]any
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("event %q: %v", line, err)
+		}
+		decoded = append(decoded, event)
+	}
+	return decoded
+}
+
+func TestLevelFiltering(t *testing.T) {
+	tests := []struct {
+		minLevel string
+		want     []string
+	}{
+		{"debug", []string{"DEBUG", "INFO", "WARN", "ERROR"}},
+		{"info", []string{"INFO", "WARN", "ERROR"}},
+		{"warning", []string{"WARN", "ERROR"}},
+		{"WARN", []string{"WARN", "ERROR"}},
+		{"error", []string{"ERROR"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.minLevel, func(t *testing.T) {
+			out := capture(t, "json", tt.minLevel)
+
+			// Package functions and loggers share the minimum level
+			for _, l := range []struct {
+				debug, info, warning, error func(string, ...any)
+			}{
+				{Debug, Info, Warning, Error},
+				{With().Debug, With().Info, With().Warning, With().Error},
+			} {
+				l.debug("event")
+				l.info("event")
+				l.warning("event")
+				l.error("event")
+			}
+
+			var got []string
+			for _, event := range events(t, out) {
+				got = append(got, event["level"].(string))
+			}
+			want := append(append([]string{}, tt.want...), tt.want...)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("logged %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSetLevelAtRuntime(t *testing.T) {
+	out := capture(t, "json", "info")
+	log := With(UserID, "alice")
+
+	log.Debug("hidden")
+	if err := SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	// Loggers made before the change follow it
+	log.Debug("shown")
+
+	got := events(t, out)
+	if len(got) != 1 || got[0]["msg"] != "shown" {
+		t.Errorf("events = %v, want only the debug event after the change", got)
+	}
+}
+
+func TestInvalidSettings(t *testing.T) {
+	capture(t, "json", "info")
+
+	if err := SetLevel("verbose"); err == nil {
+		t.Error("SetLevel(verbose) succeeded")
+	}
+	if err := SetOutput(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("SetOutput with format xml succeeded")
+	}
+	if err := Configure("json", "loud"); err == nil {
+		t.Error("Configure with level loud succeeded")
+	}
+}
+
+func TestFields(t *testing.T) {
+	out := capture(t, "json", "info")
+
+	// Fields added along the request path all reach the event
+	ctx := NewContext(context.Background(), With(RequestID, "req-1"))
+	ctx = NewContext(ctx, FromContext(ctx).With("trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"))
+	FromContext(ctx).With(ConnectionID, "conn-1", UserID, "alice").Info("joined", RoomID, "general")
+
+	got := events(t, out)
+	if len(got) != 1 {
+		t.Fatalf("got %d events, want 1", len(got))
+	}
+	want := map[string]any{
+		"msg":        "joined",
+		"level":      "INFO",
+		RequestID:    "req-1",
+		"trace_id":   "4bf92f3577b34da6a3ce929d0e0e4736",
+		ConnectionID: "conn-1",
+		UserID:       "alice",
+		RoomID:       "general",
+	}
+	for key, value := range want {
+		if got[0][key] != value {
+			t.Errorf("%s = %v, want %v", key, got[0][key], value)
+		}
+	}
+	// The source is the caller, not this package's wrappers
+	if source, _ := got[0]["source"].(string); !strings.HasPrefix(source, "logger_test.go:") {
+		t.Errorf("source = %q, want logger_test.go:<line>", source)
+	}
+}
+
+func TestLogfmt(t *testing.T) {
+	out := capture(t, "logfmt", "info")
+
+	With(RequestID, "req-1").Warning("slow request", "duration_ms", 1200)
+
+	line := out.String()
+	for _, field := range []string{"level=WARN", `msg="slow request"`, "request_id=req-1", "duration_ms=1200", "source=logger_test.go:"} {
+		if !strings.Contains(line, field) {
+			t.Errorf("%q is missing %s", line, field)
+		}
+	}
+}
+
+func TestFromContextWithoutLogger(t *testing.T) {
+	out := capture(t, "json", "info")
+
+	FromContext(context.Background()).Info("plain")
+	if got := events(t, out); len(got) != 1 || got[0][RequestID] != nil {
+		t.Errorf("events = %v, want one without a request_id", got)
+	}
+}
@@ -0,0 +1,540 @@
+// Package markdown renders the markdown subset chat messages may be written
+// in: emphasis, strikethrough, inline code, fenced code blocks, quotes,
+// lists, links and @mentions. Everything else is text, and all text is
+// escaped, so the HTML is safe to insert into a page as it is.
+package markdown
+
+import (
+	"chatstreamapp/internal/models"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits on markdown content
+const (
+	// Longest content, in characters
+	MaxLength = 4000
+
+	// Deepest nesting of quotes, lists, emphasis and links
+	MaxDepth = 6
+
+	// Most code blocks, links and mentions in one message
+	MaxEntities = 50
+)
+
+var (
+	// listPattern matches a list item's marker and the space after it
+	listPattern = regexp.MustCompile(`^(?:[-*+]|(\d{1,9})[.)])[ \t]`)
+
+	// languagePattern matches the language a code block is written in
+	languagePattern = regexp.MustCompile(`^[A-Za-z0-9_+#.-]{1,20}$`)
+
+	// mentionPattern matches an @mention, as the hub does for plain messages
+	mentionPattern = regexp.MustCompile(`^@([\p{L}\p{N}_.-]*[\p{L}\p{N}_])`)
+)
+
+// Validate checks that content is in a message format and, for markdown,
+// that it renders within the limits
+func Validate(format, content string) error {
+	if !models.ValidFormat(format) {
+		return invalid("format must be %s or %s", models.FormatPlain, models.FormatMarkdown)
+	}
+	if format != models.FormatMarkdown {
+		return nil
+	}
+	_, _, err := Render(content)
+	return err
+}
+
+// Render renders markdown content as HTML and returns the code blocks, links
+// and mentions in it, in order
+func Render(content string) (string, []models.Entity, error) {
+	if utf8.RuneCountInString(content) > MaxLength {
+		return "", nil, invalid("markdown messages must be at most %d characters", MaxLength)
+	}
+	r := &renderer{}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if err := r.blocks(strings.Split(content, "\n"), 0); err != nil {
+		return "", nil, err
+	}
+	return r.out.String(), r.entities, nil
+}
+
+// renderer accumulates the HTML and entities of one message
+type renderer struct {
+	out      strings.Builder
+	entities []models.Entity
+
+	// Whether the text being rendered is a link's label, which can't hold
+	// another link
+	inLink bool
+}
+
+// blocks renders lines as paragraphs, code blocks, quotes and lists
+func (r *renderer) blocks(lines []string, depth int) error {
+	if depth > MaxDepth {
+		return tooDeep()
+	}
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+
+		case isFence(line):
+			language := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "`"))
+			if !languagePattern.MatchString(language) {
+				language = ""
+			}
+			end := i + 1
+			for end < len(lines) && strings.TrimSpace(lines[end]) != "```" {
+				end++
+			}
+			if err := r.codeBlock(language, strings.Join(lines[i+1:end], "\n")); err != nil {
+				return err
+			}
+			i = end + 1
+
+		case isQuote(line):
+			var quoted []string
+			for ; i < len(lines) && isQuote(lines[i]); i++ {
+				quoted = append(quoted, unquote(lines[i]))
+			}
+			r.out.WriteString("<blockquote>")
+			if err := r.blocks(quoted, depth+1); err != nil {
+				return err
+			}
+			r.out.WriteString("</blockquote>")
+
+		case listPattern.MatchString(line):
+			var err error
+			if i, err = r.list(lines, i, depth); err != nil {
+				return err
+			}
+
+		default:
+			end := i + 1
+			for end < len(lines) && strings.TrimSpace(lines[end]) != "" && !startsBlock(lines[end]) {
+				end++
+			}
+			r.out.WriteString("<p>")
+			if err := r.lines(lines[i:end], depth); err != nil {
+				return err
+			}
+			r.out.WriteString("</p>")
+			i = end
+		}
+	}
+	return nil
+}
+
+// list renders the list starting at lines[i], returning the index of the
+// line after it. Indented lines continue the item above them.
+func (r *renderer) list(lines []string, i, depth int) (int, error) {
+	first := listPattern.FindStringSubmatch(lines[i])
+	ordered := first[1] != ""
+	switch {
+	case !ordered:
+		r.out.WriteString("<ul>")
+	case first[1] != "1":
+		start, _ := strconv.Atoi(first[1])
+		fmt.Fprintf(&r.out, `<ol start="%d">`, start)
+	default:
+		r.out.WriteString("<ol>")
+	}
+
+	for i < len(lines) {
+		marker := listPattern.FindStringSubmatch(lines[i])
+		if marker == nil || (marker[1] != "") != ordered {
+			break
+		}
+		item := []string{lines[i][len(marker[0]):]}
+		for i++; i < len(lines) && isIndented(lines[i]); i++ {
+			item = append(item, dedent(lines[i], len(marker[0])))
+		}
+
+		r.out.WriteString("<li>")
+		var err error
+		if simple(item) {
+			err = r.lines(item, depth+1)
+		} else {
+			err = r.blocks(item, depth+1)
+		}
+		if err != nil {
+			return i, err
+		}
+		r.out.WriteString("</li>")
+	}
+
+	if ordered {
+		r.out.WriteString("</ol>")
+	} else {
+		r.out.WriteString("</ul>")
+	}
+	return i, nil
+}
+
+// lines renders the lines of a paragraph, keeping their line breaks
+func (r *renderer) lines(lines []string, depth int) error {
+	for i, line := range lines {
+		if i > 0 {
+			r.out.WriteString("<br>")
+		}
+		if err := r.inline(strings.TrimSpace(line), depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// codeBlock renders a fenced code block
+func (r *renderer) codeBlock(language, code string) error {
+	if language != "" {
+		fmt.Fprintf(&r.out, `<pre><code class="language-%s">`, html.EscapeString(language))
+	} else {
+		r.out.WriteString("<pre><code>")
+	}
+	r.out.WriteString(html.EscapeString(code))
+	r.out.WriteString("</code></pre>")
+	return r.entity(models.Entity{Type: models.EntityCodeBlock, Text: code, Language: language})
+}
+
+// inline renders the text of one line
+func (r *renderer) inline(s string, depth int) error {
+	if depth > MaxDepth {
+		return tooDeep()
+	}
+	for i := 0; i < len(s); {
+		next, err := r.span(s, i, depth)
+		if err != nil {
+			return err
+		}
+		if next == i {
+			// Not the start of anything: copy text up to the next character
+			// that might be
+			next = i + 1
+			for next < len(s) && !strings.ContainsRune("\\`*_~[@h", rune(s[next])) {
+				next++
+			}
+			r.text(s[i:next])
+		}
+		i = next
+	}
+	return nil
+}
+
+// span renders the code, emphasis, link or mention starting at s[i] and
+// returns the index after it, or i when there is none
+func (r *renderer) span(s string, i, depth int) (int, error) {
+	switch c := s[i]; {
+	case c == '\\' && i+1 < len(s) && strings.IndexByte(escapable, s[i+1]) >= 0:
+		r.text(s[i+1 : i+2])
+		return i + 2, nil
+
+	case c == '`':
+		n := run(s, i, '`')
+		end := closingTicks(s, i+n, n)
+		if end < 0 {
+			// Unmatched backticks are text
+			r.text(s[i : i+n])
+			return i + n, nil
+		}
+		code := s[i+n : end]
+		if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' {
+			code = code[1 : len(code)-1]
+		}
+		r.out.WriteString("<code>" + html.EscapeString(code) + "</code>")
+		return end + n, nil
+
+	case c == '*' || c == '_' || c == '~':
+		return r.emphasis(s, i, depth)
+
+	case c == '[' && !r.inLink:
+		return r.link(s, i, depth)
+
+	case c == '@' && wordStart(s, i):
+		m := mentionPattern.FindStringSubmatch(s[i:])
+		if m == nil {
+			return i, nil
+		}
+		r.out.WriteString(`<span class="mention">@` + html.EscapeString(m[1]) + "</span>")
+		return i + len(m[0]), r.entity(models.Entity{Type: models.EntityMention, Text: m[1]})
+
+	case c == 'h' && !r.inLink && wordStart(s, i):
+		return r.autolink(s, i)
+	}
+	return i, nil
+}
+
+// escapable holds the characters a backslash makes literal
+const escapable = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// emphasis renders the emphasised or struck-through text starting at s[i]:
+// *em*, **strong**, ***both*** or ~~struck~~, with _ working like *. The
+// delimiters must hug the text they wrap and are closed by a run of the same
+// length. Underscores must also be at word boundaries, so snake_case stays
+// as it is. Delimiters that don't pair up are text.
+func (r *renderer) emphasis(s string, i, depth int) (int, error) {
+	c := s[i]
+	n := run(s, i, c)
+	delim := s[i : i+n]
+	start := i + n
+	end := -1
+	if n <= 3 && (c != '~' || n == 2) && start < len(s) && !unicode.IsSpace(rune(s[start])) && (c != '_' || wordStart(s, i)) {
+		end = closing(s, start, delim)
+	}
+	if end < 0 || c == '_' && !wordEnd(s, end+n) {
+		r.text(delim)
+		return start, nil
+	}
+
+	var open, close string
+	switch {
+	case c == '~':
+		open, close = "<del>", "</del>"
+	case n == 1:
+		open, close = "<em>", "</em>"
+	case n == 2:
+		open, close = "<strong>", "</strong>"
+	default:
+		open, close = "<strong><em>", "</em></strong>"
+		depth++
+	}
+	r.out.WriteString(open)
+	if err := r.inline(s[start:end], depth+1); err != nil {
+		return i, err
+	}
+	r.out.WriteString(close)
+	return end + n, nil
+}
+
+// link renders [label](url) starting at s[i]. Links to anything but http,
+// https and mailto URLs are left as text.
+func (r *renderer) link(s string, i, depth int) (int, error) {
+	labelEnd := closing(s, i+1, "]")
+	if labelEnd < 0 || !strings.HasPrefix(s[labelEnd+1:], "(") {
+		return i, nil
+	}
+	urlStart := labelEnd + 2
+	urlLength := strings.IndexByte(s[urlStart:], ')')
+	if urlLength < 0 {
+		return i, nil
+	}
+	target := s[urlStart : urlStart+urlLength]
+	if !safeURL(target) {
+		return i, nil
+	}
+	label := s[i+1 : labelEnd]
+	if strings.TrimSpace(label) == "" {
+		label = target
+	}
+
+	r.openLink(target)
+	r.inLink = true
+	err := r.inline(label, depth+1)
+	r.inLink = false
+	if err != nil {
+		return i, err
+	}
+	r.out.WriteString("</a>")
+	return urlStart + urlLength + 1, r.entity(models.Entity{Type: models.EntityLink, Text: label, URL: target})
+}
+
+// autolink renders a bare http or https URL starting at s[i]
+func (r *renderer) autolink(s string, i int) (int, error) {
+	if !strings.HasPrefix(s[i:], "http://") && !strings.HasPrefix(s[i:], "https://") {
+		return i, nil
+	}
+	end := i
+	for end < len(s) && !unicode.IsSpace(rune(s[end])) && s[end] != '<' && s[end] != '>' {
+		end++
+	}
+	// Punctuation ending a sentence isn't part of the URL
+	target := strings.TrimRight(s[i:end], `.,:;!?'")]*_~`)
+	if !safeURL(target) {
+		return i, nil
+	}
+
+	r.openLink(target)
+	r.text(target)
+	r.out.WriteString("</a>")
+	return i + len(target), r.entity(models.Entity{Type: models.EntityLink, Text: target, URL: target})
+}
+
+// openLink writes the start of a link to target
+func (r *renderer) openLink(target string) {
+	r.out.WriteString(`<a href="` + html.EscapeString(target) + `" rel="nofollow noopener noreferrer" target="_blank">`)
+}
+
+// text writes escaped text
+func (r *renderer) text(s string) {
+	r.out.WriteString(html.EscapeString(s))
+}
+
+// entity records an entity, failing once there are too many
+func (r *renderer) entity(e models.Entity) error {
+	if len(r.entities) >= MaxEntities {
+		return invalid("markdown messages can have at most %d code blocks, links and mentions", MaxEntities)
+	}
+	r.entities = append(r.entities, e)
+	return nil
+}
+
+// closing returns the index of the delimiter that closes a span whose text
+// starts at s[start], or -1. Escaped characters and code spans are skipped,
+// and a run of emphasis delimiters only closes a run of the same length, so
+// the ** of a nested bold doesn't close an *.
+func closing(s string, start int, delim string) int {
+	for j := start; j < len(s); {
+		switch {
+		case s[j] == '\\':
+			j += 2
+		case s[j] == '`':
+			n := run(s, j, '`')
+			if end := closingTicks(s, j+n, n); end >= 0 {
+				j = end + n
+			} else {
+				j += n
+			}
+		case delim == "]":
+			if s[j] == ']' && j > start {
+				return j
+			}
+			j++
+		case s[j] == delim[0]:
+			n := run(s, j, s[j])
+			if n == len(delim) && j > start && !unicode.IsSpace(rune(s[j-1])) {
+				return j
+			}
+			j += n
+		default:
+			j++
+		}
+	}
+	return -1
+}
+
+// closingTicks returns the index of the run of exactly n backticks that
+// closes a code span, or -1
+func closingTicks(s string, start, n int) int {
+	for j := start; j < len(s); {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+		length := run(s, j, '`')
+		if length == n {
+			return j
+		}
+		j += length
+	}
+	return -1
+}
+
+// run returns how many times c repeats from s[i]
+func run(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// wordStart reports whether s[i] is not preceded by a letter or digit
+func wordStart(s string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	before, _ := utf8.DecodeLastRuneInString(s[:i])
+	return !isWordRune(before)
+}
+
+// wordEnd reports whether s[i] is not a letter or digit
+func wordEnd(s string, i int) bool {
+	if i >= len(s) {
+		return true
+	}
+	after, _ := utf8.DecodeRuneInString(s[i:])
+	return !isWordRune(after)
+}
+
+func isWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_'
+}
+
+// safeURL reports whether a link may point at target
+func safeURL(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
+
+// isFence reports whether a line opens a code block. Backticks later in the
+// line make it inline code instead, e.g. ```code```.
+func isFence(line string) bool {
+	line = strings.TrimLeft(line, " ")
+	return strings.HasPrefix(line, "```") && !strings.Contains(strings.TrimLeft(line, "`"), "`")
+}
+
+func isQuote(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " "), ">")
+}
+
+// unquote removes a quote marker and the space after it
+func unquote(line string) string {
+	line = strings.TrimPrefix(strings.TrimLeft(line, " "), ">")
+	return strings.TrimPrefix(line, " ")
+}
+
+func startsBlock(line string) bool {
+	return isFence(line) || isQuote(line) || listPattern.MatchString(line)
+}
+
+func isIndented(line string) bool {
+	return strings.TrimSpace(line) != "" && (strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t"))
+}
+
+// dedent removes a list item's indentation, up to the width of its marker,
+// from one of its lines
+func dedent(line string, width int) string {
+	if strings.HasPrefix(line, "\t") {
+		return line[1:]
+	}
+	for i := 0; i < width && strings.HasPrefix(line, " "); i++ {
+		line = line[1:]
+	}
+	return line
+}
+
+// simple reports whether a list item is plain lines, which are rendered
+// without a paragraph around them
+func simple(item []string) bool {
+	for _, line := range item {
+		if strings.TrimSpace(line) == "" || startsBlock(line) {
+			return false
+		}
+	}
+	return true
+}
+
+func tooDeep() error {
+	return invalid("markdown can be nested at most %d levels deep", MaxDepth)
+}
+
+func invalid(format string, args ...any) error {
+	return &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: fmt.Sprintf(format, args...)}
+}
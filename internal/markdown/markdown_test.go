@@ -0,0 +1,175 @@
+package markdown
+
+import (
+	"chatstreamapp/internal/models"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const linkAttrs = `rel="nofollow noopener noreferrer" target="_blank"`
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "hello", "<p>hello</p>"},
+		{"emphasis", "*em* **strong** ***both*** ~~struck~~", "<p><em>em</em> <strong>strong</strong> <strong><em>both</em></strong> <del>struck</del></p>"},
+		{"underscore emphasis", "_em_ and __strong__", "<p><em>em</em> and <strong>strong</strong></p>"},
+		{"snake_case", "snake_case_word", "<p>snake_case_word</p>"},
+		{"snake_case beside emphasis", "call my_var_name, _not_ this", "<p>call my_var_name, <em>not</em> this</p>"},
+		{"unpaired delimiters", "2 * 3 and a_b", "<p>2 * 3 and a_b</p>"},
+		{"escaped", `\*not em\*`, "<p>*not em*</p>"},
+		{"inline code", "run `make <check>`", "<p>run <code>make &lt;check&gt;</code></p>"},
+		{"code keeps delimiters", "`*a*`", "<p><code>*a*</code></p>"},
+		{"line breaks", "one\ntwo", "<p>one<br>two</p>"},
+		{"quote", "> quoted\n\nafter", "<blockquote><p>quoted</p></blockquote><p>after</p>"},
+		{"list", "- a\n- b", "<ul><li>a</li><li>b</li></ul>"},
+		{"ordered list", "3. c\n4. d", `<ol start="3"><li>c</li><li>d</li></ol>`},
+		{"code block", "```go\nx := 1\n```", `<pre><code class="language-go">x := 1</code></pre>`},
+		{"link", "[docs](https://example.com/docs)", `<p><a href="https://example.com/docs" ` + linkAttrs + `>docs</a></p>`},
+		{"autolink", "see https://example.org.", `<p>see <a href="https://example.org" ` + linkAttrs + `>https://example.org</a>.</p>`},
+		{"mailto", "[me](mailto:me@example.com)", `<p><a href="mailto:me@example.com" ` + linkAttrs + `>me</a></p>`},
+		{"mention", "hi @bob!", `<p>hi <span class="mention">@bob</span>!</p>`},
+		{"email is not a mention", "me@example.com", "<p>me@example.com</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := Render(tt.in)
+			if err != nil {
+				t.Fatalf("Render(%q) = %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Render(%q)\n got %s\nwant %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// hrefPattern matches each href attribute up to the quote closing it
+var hrefPattern = regexp.MustCompile(`href="([^"]*)"`)
+
+func TestRenderEscapesUnsafeContent(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"script tag", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"html attribute", `<img src=x onerror="alert(1)">`, "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>"},
+		{"javascript link", "[click](javascript:alert(1))", "<p>[click](javascript:alert(1))</p>"},
+		{"javascript link in capitals", "[click](JavaScript:alert(1))", "<p>[click](JavaScript:alert(1))</p>"},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>[x](data:text/html;base64,PHNjcmlwdD4=)</p>"},
+		{"bare javascript url", "javascript:alert(1)", "<p>javascript:alert(1)</p>"},
+		{"quote in link", `[x](https://a.test/"onmouseover="alert(1))`,
+			`<p><a href="https://a.test/&#34;onmouseover=&#34;alert(1" ` + linkAttrs + `>x</a>)</p>`},
+		{"quote in autolink", `https://a.test/"onmouseover="x`,
+			`<p><a href="https://a.test/&#34;onmouseover=&#34;x" ` + linkAttrs + `>https://a.test/&#34;onmouseover=&#34;x</a></p>`},
+		{"html in link label", "[<b>x</b>](https://example.com)", `<p><a href="https://example.com" ` + linkAttrs + `>&lt;b&gt;x&lt;/b&gt;</a></p>`},
+		{"html in code block", "```\n</code><script>x</script>\n```", "<pre><code>&lt;/code&gt;&lt;script&gt;x&lt;/script&gt;</code></pre>"},
+		{"quote in fence language", "```js\" onload=\"x\ncode\n```", "<pre><code>code</code></pre>"},
+		{"tag as fence language", "```<script>\ncode\n```", "<pre><code>code</code></pre>"},
+		{"html in mention", "@bob<script>", `<p><span class="mention">@bob</span>&lt;script&gt;</p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := Render(tt.in)
+			if err != nil {
+				t.Fatalf("Render(%q) = %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Render(%q)\n got %s\nwant %s", tt.in, got, tt.want)
+			}
+			if strings.Contains(strings.ToLower(got), "<script") {
+				t.Errorf("Render(%q) contains a script tag: %s", tt.in, got)
+			}
+			for _, m := range hrefPattern.FindAllStringSubmatch(got, -1) {
+				if !strings.HasPrefix(m[1], "https://") && !strings.HasPrefix(m[1], "mailto:") {
+					t.Errorf("Render(%q) links to %s", tt.in, m[1])
+				}
+			}
+		})
+	}
+}
+
+func TestRenderEntities(t *testing.T) {
+	in := "@alice see [the docs](https://example.com/docs), https://example.org and\n```sh\nmake check\n```\n@bob"
+	want := []models.Entity{
+		{Type: models.EntityMention, Text: "alice"},
+		{Type: models.EntityLink, Text: "the docs", URL: "https://example.com/docs"},
+		{Type: models.EntityLink, Text: "https://example.org", URL: "https://example.org"},
+		{Type: models.EntityCodeBlock, Text: "make check", Language: "sh"},
+		{Type: models.EntityMention, Text: "bob"},
+	}
+	_, entities, err := Render(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entities, want) {
+		t.Errorf("entities\n got %+v\nwant %+v", entities, want)
+	}
+
+	// Text that isn't a link or mention yields no entities
+	_, entities, err = Render("me@example.com, [x](javascript:alert(1)) and `@code`")
+	if err != nil || len(entities) != 0 {
+		t.Errorf("entities = %+v, %v; want none", entities, err)
+	}
+}
+
+func TestRenderLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		ok   bool
+	}{
+		{"max length", strings.Repeat("é", MaxLength), true},
+		{"over max length", strings.Repeat("é", MaxLength+1), false},
+		{"max quote depth", strings.Repeat("> ", MaxDepth) + "deep", true},
+		{"over max quote depth", strings.Repeat("> ", MaxDepth+1) + "deep", false},
+		{"nested emphasis", "~~a *b **c _d __e__ d_ c** b* a~~", true},
+		{"over max emphasis depth", "~~a *b **c _d __e ___f___ e__ d_ c** b* a~~", false},
+		{"max depth with strong emphasis", "~~a *b **c _d ***e*** d_ c** b* a~~", true},
+		{"link adds a level", "~~a *b **c _d [***e***](https://example.com) d_ c** b* a~~", false},
+		{"max entities", strings.Repeat("@bob ", MaxEntities), true},
+		{"over max entities", strings.Repeat("@bob ", MaxEntities+1), false},
+		{"over max links", strings.Repeat("https://example.com ", MaxEntities+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Render(tt.in)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("Render = %v, want success", err)
+				}
+				return
+			}
+			var coded *models.CodedError
+			if !errors.As(err, &coded) || coded.Code != models.ErrorCodeInvalidRequest {
+				t.Fatalf("Render = %v, want an invalid_request error", err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		format  string
+		content string
+		ok      bool
+	}{
+		{"", "*hi*", true},
+		{models.FormatPlain, strings.Repeat("@bob ", MaxEntities+1), true},
+		{models.FormatMarkdown, "*hi*", true},
+		{models.FormatMarkdown, strings.Repeat("@bob ", MaxEntities+1), false},
+		{"html", "<b>hi</b>", false},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.format, tt.content); (err == nil) != tt.ok {
+			t.Errorf("Validate(%q, %.20q) = %v, want ok %v", tt.format, tt.content, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package metrics
+
+// Connection metrics
+var (
+	ConnectionsActive = NewGauge("chat_connections_active",
+		"Number of clients registered with the hub.")
+
+	UpgradeFailures = NewCounter("chat_websocket_upgrade_failures_total",
+		"WebSocket upgrade attempts that failed.")
+
+	OriginRejections = NewCounterVec("chat_origin_rejections_total",
+		"Requests refused because their Origin isn't allowed, by kind (http, websocket).", "kind")
+
+	SlowConsumerDisconnects = NewCounter("chat_slow_consumer_disconnects_total",
+		"Connections closed because their send queue was full.")
+
+	SendQueueDepth = NewHistogram("chat_send_queue_depth",
+		"Depth of a connection's send queue after each enqueue.",
+		append([]float64{0}, ExponentialBuckets(1, 2, 9)...))
+
+	SessionsDetached = NewGauge("chat_sessions_detached",
+		"Disconnected clients kept registered while they may resume.")
+
+	SessionResumes = NewCounterVec("chat_session_resumes_total",
+		"Resume attempts by result (resumed, not_found, gap).", "result")
+)
+
+// Frame metrics
+var (
+	PayloadBytes = NewCounter("chat_websocket_payload_bytes_total",
+		"Encoded bytes of outbound data frames before compression.")
+
+	WireBytes = NewCounter("chat_websocket_wire_bytes_total",
+		"Bytes written to WebSocket connections for outbound data frames, after compression and framing.")
+
+	CompressionSavedBytes = NewCounter("chat_websocket_compression_saved_bytes_total",
+		"Bytes saved by permessage-deflate on outbound data frames.")
+
+	BatchSize = NewHistogram("chat_websocket_batch_messages",
+		"Messages coalesced into each outbound batch frame.",
+		ExponentialBuckets(2, 2, 6))
+)
+
+// Room metrics
+var (
+	Rooms = NewGauge("chat_rooms",
+		"Number of rooms known to the hub.")
+
+	// Clients create rooms by joining them, so only the rooms configured in
+	// hub.metric_rooms get their own series
+	RoomUsers = NewGaugeVec("chat_room_users",
+		"Number of users in a room, by room for the rooms in hub.metric_rooms and under \"other\" for the rest.", "room")
+)
+
+// Message metrics
+var (
+	MessagesTotal = NewCounterVec("chat_messages_total",
+		"Messages routed by the hub, by kind (broadcast, private, ephemeral).", "kind")
+
+	MessagesDropped = NewCounterVec("chat_messages_dropped_total",
+		"Messages that could not be delivered, by reason.", "reason")
+)
+
+// Moderation metrics
+var (
+	ModerationActions = NewCounterVec("chat_moderation_actions_total",
+		"Messages acted on by moderation filters, by filter and action (redact, hold, reject).", "filter", "action")
+
+	ModerationHeld = NewGauge("chat_moderation_held",
+		"Messages waiting for a moderator's review.")
+)
+
+// Latency metrics
+var (
+	HubEventDuration = NewHistogramVec("chat_hub_event_duration_seconds",
+		"Time the hub event loop spent handling each event, by event type.",
+		DefBuckets, "event")
+
+	HTTPRequestDuration = NewHistogramVec("chat_http_request_duration_seconds",
+		"REST handler latency by method, route and status code.",
+		DefBuckets, "method", "route", "status")
+)
+
+// Webhook metrics
+var (
+	WebhookDeliveries = NewCounterVec("chat_webhook_deliveries_total",
+		"Webhook delivery attempts, by result (success, failure, dead_letter).", "result")
+)
@@ -0,0 +1,356 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry holds metrics and renders them in the Prometheus text format
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+type collector interface {
+	describe() (name, help, kind string)
+	write(w *bufio.Writer, name string)
+}
+
+// Default is the registry served by Handler
+var Default = &Registry{}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, c)
+}
+
+// Handler serves the registry in the Prometheus text exposition format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		r.mu.Lock()
+		collectors := append([]collector(nil), r.collectors...)
+		r.mu.Unlock()
+
+		buf := bufio.NewWriter(w)
+		for _, c := range collectors {
+			name, help, kind := c.describe()
+			fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+			c.write(buf, name)
+		}
+		buf.Flush()
+	})
+}
+
+// Handler serves the default registry
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// value is a float64 updated atomically
+type value struct {
+	bits atomic.Uint64
+}
+
+func (v *value) add(delta float64) {
+	for {
+		old := v.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if v.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func (v *value) set(f float64) {
+	v.bits.Store(math.Float64bits(f))
+}
+
+func (v *value) get() float64 {
+	return math.Float64frombits(v.bits.Load())
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	v value
+}
+
+// Inc adds one
+func (c *Counter) Inc() { c.v.add(1) }
+
+// Add adds delta, which must not be negative
+func (c *Counter) Add(delta float64) { c.v.add(delta) }
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	v value
+}
+
+// Set replaces the value
+func (g *Gauge) Set(f float64) { g.v.set(f) }
+
+// Inc adds one
+func (g *Gauge) Inc() { g.v.add(1) }
+
+// Dec subtracts one
+func (g *Gauge) Dec() { g.v.add(-1) }
+
+// Add adds delta
+func (g *Gauge) Add(delta float64) { g.v.add(delta) }
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64
+	sum     value
+	count   atomic.Uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]atomic.Uint64, len(buckets)),
+	}
+}
+
+// Observe records a single value
+func (h *Histogram) Observe(f float64) {
+	for i, upper := range h.buckets {
+		if f <= upper {
+			h.counts[i].Add(1)
+		}
+	}
+	h.sum.add(f)
+	h.count.Add(1)
+}
+
+func (h *Histogram) writeSeries(w *bufio.Writer, name, labels string) {
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(labels, "le", formatFloat(upper)), h.counts[i].Load())
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(labels, "le", "+Inf"), h.count.Load())
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, braces(labels), formatFloat(h.sum.get()))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, braces(labels), h.count.Load())
+}
+
+// DefBuckets suit latencies measured in seconds
+var DefBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ExponentialBuckets returns count buckets starting at start, each factor times the previous
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// family is a named metric with an optional set of labels
+type family[T any] struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	create func() *T
+	render func(w *bufio.Writer, name, labels string, m *T)
+
+	mu     sync.RWMutex
+	series map[string]*T
+	values map[string][]string
+}
+
+func newFamily[T any](name, help, kind string, labels []string, create func() *T, write func(*bufio.Writer, string, string, *T)) *family[T] {
+	f := &family[T]{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		create: create,
+		render: write,
+		series: make(map[string]*T),
+		values: make(map[string][]string),
+	}
+	Default.register(f)
+	return f
+}
+
+func (f *family[T]) with(values ...string) *T {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.RLock()
+	m, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return m
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if m, ok := f.series[key]; ok {
+		return m
+	}
+	m = f.create()
+	f.series[key] = m
+	f.values[key] = append([]string(nil), values...)
+	return m
+}
+
+func (f *family[T]) delete(values ...string) {
+	key := strings.Join(values, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.series, key)
+	delete(f.values, key)
+}
+
+func (f *family[T]) describe() (string, string, string) {
+	return f.name, f.help, f.kind
+}
+
+func (f *family[T]) write(w *bufio.Writer, name string) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f.render(w, name, formatLabels(f.labels, f.values[key]), f.series[key])
+	}
+}
+
+// NewCounter registers a counter without labels
+func NewCounter(name, help string) *Counter {
+	return NewCounterVec(name, help).WithLabelValues()
+}
+
+// NewGauge registers a gauge without labels
+func NewGauge(name, help string) *Gauge {
+	return NewGaugeVec(name, help).WithLabelValues()
+}
+
+// NewHistogram registers a histogram without labels
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return NewHistogramVec(name, help, buckets).WithLabelValues()
+}
+
+// CounterVec is a set of counters partitioned by labels
+type CounterVec struct {
+	f *family[Counter]
+}
+
+// NewCounterVec registers a counter family
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{f: newFamily(name, help, "counter", labels,
+		func() *Counter { return &Counter{} },
+		func(w *bufio.Writer, name, labels string, c *Counter) {
+			fmt.Fprintf(w, "%s%s %s\n", name, braces(labels), formatFloat(c.v.get()))
+		})}
+}
+
+// WithLabelValues returns the counter for the given label values
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.f.with(values...)
+}
+
+// GaugeVec is a set of gauges partitioned by labels
+type GaugeVec struct {
+	f *family[Gauge]
+}
+
+// NewGaugeVec registers a gauge family
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{f: newFamily(name, help, "gauge", labels,
+		func() *Gauge { return &Gauge{} },
+		func(w *bufio.Writer, name, labels string, g *Gauge) {
+			fmt.Fprintf(w, "%s%s %s\n", name, braces(labels), formatFloat(g.v.get()))
+		})}
+}
+
+// WithLabelValues returns the gauge for the given label values
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return v.f.with(values...)
+}
+
+// DeleteLabelValues removes the gauge for the given label values
+func (v *GaugeVec) DeleteLabelValues(values ...string) {
+	v.f.delete(values...)
+}
+
+// HistogramVec is a set of histograms partitioned by labels
+type HistogramVec struct {
+	f *family[Histogram]
+}
+
+// NewHistogramVec registers a histogram family
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{f: newFamily(name, help, "histogram", labels,
+		func() *Histogram { return newHistogram(buckets) },
+		func(w *bufio.Writer, name, labels string, h *Histogram) {
+			h.writeSeries(w, name, labels)
+		})}
+}
+
+// WithLabelValues returns the histogram for the given label values
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.f.with(values...)
+}
+
+func formatLabels(names, values []string) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(parts, ",")
+}
+
+func withLabel(labels, name, value string) string {
+	label := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + label + "}"
+	}
+	return "{" + labels + "," + label + "}"
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Error codes carried by error messages
+const (
+	ErrorCodeUnknownType        = "unknown_type"
+	ErrorCodeInvalidRequest     = "invalid_request"
+	ErrorCodeRoomNotFound       = "room_not_found"
+	ErrorCodeUserNotFound       = "user_not_found"
+	ErrorCodeConnectionNotFound = "connection_not_found"
+	ErrorCodeNotMember          = "not_member"
+	ErrorCodePayloadTooLarge    = "payload_too_large"
+	ErrorCodeRateLimited        = "rate_limited"
+	ErrorCodeUnauthorized       = "unauthorized"
+	ErrorCodeMessageHeld        = "message_held"
+	ErrorCodeMessageRejected    = "message_rejected"
+	ErrorCodeBanned             = "banned"
+	ErrorCodeMuted              = "muted"
+	ErrorCodeDMNotAllowed       = "dm_not_allowed"
+	ErrorCodeUnknownCommand     = "unknown_command"
+	ErrorCodeInternal           = "internal_error"
+)
+
+// CodedError is an error that can be reported to clients with a
+// machine-readable code
+type CodedError struct {
+	Code    string
+	Message string
+
+	// How long the client should wait before retrying, if known
+	RetryAfter time.Duration
+}
+
+func (e *CodedError) Error() string {
+	return e.Message
+}
+
+// Errors returned by hub operations
+var (
+	ErrRoomNotFound       = &CodedError{Code: ErrorCodeRoomNotFound, Message: "Room not found"}
+	ErrUserNotFound       = &CodedError{Code: ErrorCodeUserNotFound, Message: "User not connected"}
+	ErrNotMember          = &CodedError{Code: ErrorCodeNotMember, Message: "Not a member of this room"}
+	ErrConnectionNotFound = &CodedError{Code: ErrorCodeConnectionNotFound, Message: "Connection not found"}
+	ErrDMNotAllowed       = &CodedError{Code: ErrorCodeDMNotAllowed, Message: "This user doesn't accept private messages from you"}
+)
@@ -2,29 +2,208 @@ package models
 
 import (
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // MessageType represents different types of messages
 type MessageType string
 
 const (
-	MessageTypeText     MessageType = "text"
-	MessageTypeJoin     MessageType = "join"
-	MessageTypeLeave    MessageType = "leave"
-	MessageTypeSystem   MessageType = "system"
-	MessageTypePrivate  MessageType = "private"
+	MessageTypeText         MessageType = "text"
+	MessageTypeJoin         MessageType = "join"
+	MessageTypeLeave        MessageType = "leave"
+	MessageTypeSystem       MessageType = "system"
+	MessageTypePrivate      MessageType = "private"
+	MessageTypeTyping       MessageType = "typing"
+	MessageTypeError        MessageType = "error"
+	MessageTypeAck          MessageType = "ack"
+	MessageTypeSession      MessageType = "session"
+	MessageTypeAnnouncement MessageType = "announcement"
+
+	// Room list events; the rooms are in Rooms, or Room for deletions
+	MessageTypeRoomsSnapshot MessageType = "rooms_snapshot"
+	MessageTypeRoomCreated   MessageType = "room_created"
+	MessageTypeRoomUpdated   MessageType = "room_updated"
+	MessageTypeRoomDeleted   MessageType = "room_deleted"
+
+	// A /me emote; Content is the action, shown after the sender's name
+	MessageTypeAction MessageType = "action"
+
+	// A slash command forwarded to the bot that handles it; the details are
+	// in Command
+	MessageTypeCommand MessageType = "command"
 )
 
-// Message represents a chat message
+// ErrorInfo describes why an operation was rejected
+type ErrorInfo struct {
+	Code         string `json:"code" proto:"1"`
+	Message      string `json:"message" proto:"2"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty" proto:"3"`
+}
+
+// SessionInfo identifies a connection's session so it can be resumed after
+// a reconnect
+type SessionInfo struct {
+	Token   string `json:"token" proto:"1"`
+	Resumed bool   `json:"resumed" proto:"2"`
+}
+
+// Message represents a chat message. The proto tags give the field numbers
+// used by the protobuf encoding and must never be reused.
 type Message struct {
-	ID        string      `json:"id"`
-	Type      MessageType `json:"type"`
-	Content   string      `json:"content"`
-	Sender    string      `json:"sender"`
-	SenderID  string      `json:"sender_id"`
-	Recipient string      `json:"recipient,omitempty"` // For private messages
-	Room      string      `json:"room,omitempty"`      // For group messages
-	Timestamp time.Time   `json:"timestamp"`
+	ID          string       `json:"id" proto:"1"`
+	Type        MessageType  `json:"type" proto:"2"`
+	Content     string       `json:"content" proto:"3"`
+	Sender      string       `json:"sender" proto:"4"`
+	SenderID    string       `json:"sender_id" proto:"5"`
+	Recipient   string       `json:"recipient,omitempty" proto:"6"`  // For private messages
+	Room        string       `json:"room,omitempty" proto:"7"`       // For group messages
+	RequestID   string       `json:"request_id,omitempty" proto:"8"` // Client-chosen, echoed in acks and errors
+	Timestamp   time.Time    `json:"timestamp" proto:"9"`
+	Error       *ErrorInfo   `json:"error,omitempty" proto:"10"`       // For error messages
+	Session     *SessionInfo `json:"session,omitempty" proto:"11"`     // For session messages
+	Mentions    []string     `json:"mentions,omitempty" proto:"12"`    // IDs of room members @mentioned
+	Rooms       []RoomInfo   `json:"rooms,omitempty" proto:"13"`       // For room list events
+	Attachments []Attachment `json:"attachments,omitempty" proto:"14"` // Structured content, e.g. from integrations
+	Bot         bool         `json:"bot,omitempty" proto:"15"`         // Sent by an integration rather than a person
+	Command     *Invocation  `json:"command,omitempty" proto:"16"`     // For command messages
+	Ephemeral   bool         `json:"ephemeral,omitempty" proto:"17"`   // Shown in the room to its recipient only; never kept in history
+	Format      string       `json:"format,omitempty" proto:"18"`      // How Content is written: "plain" (the default) or "markdown"
+	HTML        string       `json:"html,omitempty" proto:"19"`        // Sanitized rendering of markdown content
+	Entities    []Entity     `json:"entities,omitempty" proto:"20"`    // Code blocks, links and mentions in markdown content
+
+	// Position in the recipient connection's event stream, assigned when
+	// queued. Sent in the envelope rather than the payload.
+	Seq uint64 `json:"-"`
+
+	// W3C traceparent of the span that last handled this message. Internal
+	// only; never sent to clients.
+	TraceParent string `json:"-"`
+}
+
+// NewErrorMessage creates an error message for a client
+func NewErrorMessage(code, text string) *Message {
+	return &Message{
+		ID:        uuid.New().String(),
+		Type:      MessageTypeError,
+		Content:   text,
+		Sender:    "System",
+		Timestamp: time.Now(),
+		Error: &ErrorInfo{
+			Code:    code,
+			Message: text,
+		},
+	}
+}
+
+// NewAck acknowledges a client request. id is the ID of the message the
+// request created, if any.
+func NewAck(requestID, id string) *Message {
+	return &Message{
+		ID:        id,
+		Type:      MessageTypeAck,
+		Sender:    "System",
+		RequestID: requestID,
+		Timestamp: time.Now(),
+	}
+}
+
+// NewSession tells a client the token to resume its session with
+func NewSession(token string, resumed bool) *Message {
+	return &Message{
+		ID:        uuid.New().String(),
+		Type:      MessageTypeSession,
+		Sender:    "System",
+		Timestamp: time.Now(),
+		Session: &SessionInfo{
+			Token:   token,
+			Resumed: resumed,
+		},
+	}
+}
+
+// NewAnnouncement creates an announcement from the operators, to one room or,
+// with no room, to everyone
+func NewAnnouncement(content, room string) *Message {
+	return &Message{
+		ID:        uuid.New().String(),
+		Type:      MessageTypeAnnouncement,
+		Content:   content,
+		Sender:    "System",
+		Room:      room,
+		Timestamp: time.Now(),
+	}
+}
+
+// Attachment is a block of structured content shown below a message, such as
+// a build result posted by CI
+type Attachment struct {
+	Title     string            `json:"title,omitempty" proto:"1"`
+	TitleLink string            `json:"title_link,omitempty" proto:"2"`
+	Text      string            `json:"text,omitempty" proto:"3"`
+	Color     string            `json:"color,omitempty" proto:"4"` // "good", "warning", "danger" or "#rrggbb"
+	Fields    []AttachmentField `json:"fields,omitempty" proto:"5"`
+}
+
+// AttachmentField is a labelled value in an attachment. Short fields may be
+// shown side by side.
+type AttachmentField struct {
+	Title string `json:"title" proto:"1"`
+	Value string `json:"value" proto:"2"`
+	Short bool   `json:"short,omitempty" proto:"3"`
+}
+
+// Message formats
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+)
+
+// ValidFormat reports whether f is a message format. Empty is plain.
+func ValidFormat(f string) bool {
+	return f == "" || f == FormatPlain || f == FormatMarkdown
+}
+
+// Entity types
+const (
+	EntityCodeBlock = "code_block"
+	EntityLink      = "link"
+	EntityMention   = "mention"
+)
+
+// Entity is a structured part of a markdown message
+type Entity struct {
+	Type string `json:"type" proto:"1"`
+
+	// The code, the link's label or the mentioned username
+	Text string `json:"text" proto:"2"`
+
+	URL      string `json:"url,omitempty" proto:"3"`      // For links
+	Language string `json:"language,omitempty" proto:"4"` // For code blocks, when given
+	UserID   string `json:"user_id,omitempty" proto:"5"`  // For mentions of room members
+}
+
+// Invocation is a slash command run by a user, as sent to the bot that
+// handles it. The bot answers with the invocation's ID.
+type Invocation struct {
+	ID       string   `json:"id" proto:"1"`
+	Name     string   `json:"name" proto:"2"`
+	Args     []string `json:"args,omitempty" proto:"3"`
+	Text     string   `json:"text,omitempty" proto:"4"` // Everything after the name, as typed
+	Room     string   `json:"room" proto:"5"`
+	UserID   string   `json:"user_id" proto:"6"`
+	Username string   `json:"username" proto:"7"`
+}
+
+// RoomInfo describes a room in the room list, as seen by one user
+type RoomInfo struct {
+	ID         string `json:"id" proto:"1"`
+	Name       string `json:"name" proto:"2"`
+	Topic      string `json:"topic,omitempty" proto:"3"`
+	Members    int    `json:"members" proto:"4"`
+	Unread     int    `json:"unread" proto:"5"` // Messages since the user was last in the room
+	Visibility string `json:"visibility" proto:"6"`
 }
 
 // User represents a connected user
@@ -32,25 +211,47 @@ type User struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
 	Room     string `json:"room,omitempty"`
+	Bot      bool   `json:"bot,omitempty"`
+
+	// Whether the user connected with a moderator token
+	Moderator bool `json:"moderator,omitempty"`
+}
+
+// Room visibilities
+const (
+	// Listed to everyone
+	RoomPublic = "public"
+
+	// Only listed to users who are or have been in it; anyone with the ID
+	// can still join
+	RoomPrivate = "private"
+)
+
+// ValidVisibility reports whether v is a room visibility
+func ValidVisibility(v string) bool {
+	return v == RoomPublic || v == RoomPrivate
 }
 
 // Room represents a chat room
 type Room struct {
 	ID          string             `json:"id"`
 	Name        string             `json:"name"`
+	Topic       string             `json:"topic,omitempty"`
+	Visibility  string             `json:"visibility"`
 	Users       map[string]*User   `json:"users"`
 	Messages    []*Message         `json:"messages"`
 	CreatedAt   time.Time          `json:"created_at"`
 }
 
-// NewRoom creates a new room
+// NewRoom creates a new public room
 func NewRoom(id, name string) *Room {
 	return &Room{
-		ID:        id,
-		Name:      name,
-		Users:     make(map[string]*User),
-		Messages:  make([]*Message, 0),
-		CreatedAt: time.Now(),
+		ID:         id,
+		Name:       name,
+		Visibility: RoomPublic,
+		Users:      make(map[string]*User),
+		Messages:   make([]*Message, 0),
+		CreatedAt:  time.Now(),
 	}
 }
 
@@ -64,13 +265,13 @@ func (r *Room) RemoveUser(userID string) {
 	delete(r.Users, userID)
 }
 
-// AddMessage adds a message to the room
-func (r *Room) AddMessage(message *Message) {
+// AddMessage adds a message to the room, keeping at most limit messages
+// to prevent memory issues
+func (r *Room) AddMessage(message *Message, limit int) {
 	r.Messages = append(r.Messages, message)
-	
-	// Keep only last 100 messages to prevent memory issues
-	if len(r.Messages) > 100 {
-		r.Messages = r.Messages[1:]
+
+	if len(r.Messages) > limit {
+		r.Messages = r.Messages[len(r.Messages)-limit:]
 	}
 }
 
@@ -0,0 +1,338 @@
+package moderation
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/models"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BannedWords matches words from a list however they are disguised: case,
+// accents, leetspeak, stretched letters ("baaad") and spelled-out letters
+// ("b.a.d") are all folded away. Only whole words match, so banned words
+// inside longer, innocent words are left alone.
+type BannedWords struct {
+	action Action
+
+	// Squeezed, folded form of each banned word, mapped to the length of
+	// the shortest banned word with that form. Requiring at least that
+	// length keeps "as" from matching a banned "ass".
+	words map[string]int
+}
+
+// NewBannedWords creates a filter for the given words
+func NewBannedWords(list []string, action Action) *BannedWords {
+	f := &BannedWords{action: action, words: make(map[string]int)}
+	for _, w := range list {
+		var b strings.Builder
+		for _, r := range w {
+			b.WriteString(foldRune(r))
+		}
+		folded := b.String()
+		if folded == "" {
+			continue
+		}
+
+		key := squeeze(folded)
+		length := utf8.RuneCountInString(folded)
+		if shortest, ok := f.words[key]; !ok || length < shortest {
+			f.words[key] = length
+		}
+	}
+	return f
+}
+
+// Name implements Filter
+func (f *BannedWords) Name() string {
+	return "banned_words"
+}
+
+// Check implements Filter
+func (f *BannedWords) Check(message *models.Message) Verdict {
+	var matches []word
+	for _, w := range words(message.Content) {
+		shortest, ok := f.words[squeeze(w.folded)]
+		if ok && utf8.RuneCountInString(w.folded) >= shortest {
+			matches = append(matches, w)
+		}
+	}
+	if len(matches) == 0 {
+		return Verdict{}
+	}
+
+	found := make([]string, len(matches))
+	for i, m := range matches {
+		found[i] = m.folded
+	}
+	verdict := Verdict{
+		Action: f.action,
+		Reason: "Message contains a banned word",
+		Match:  strings.Join(found, ","),
+	}
+	if f.action == Redact {
+		verdict.Content = maskRanges(message.Content, matches)
+	}
+	return verdict
+}
+
+// maskRanges replaces the text of each word with asterisks. Words may overlap.
+func maskRanges(text string, list []word) string {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].start < list[j].start
+	})
+
+	var b strings.Builder
+	pos := 0
+	for _, w := range list {
+		if w.end <= pos {
+			continue
+		}
+		start := max(w.start, pos)
+		b.WriteString(text[pos:start])
+		b.WriteString(mask(text[start:w.end]))
+		pos = w.end
+	}
+	b.WriteString(text[pos:])
+	return b.String()
+}
+
+// Rule acts on messages matching a regular expression
+type Rule struct {
+	name    string
+	pattern *regexp.Regexp
+	action  Action
+	reason  string
+}
+
+// NewRule compiles a configured rule
+func NewRule(cfg config.ModerationRule) (*Rule, error) {
+	pattern, err := regexp.Compile(cfg.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("moderation rule %s: %w", cfg.Name, err)
+	}
+	action, err := ParseAction(cfg.Action)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := cfg.Reason
+	if reason == "" {
+		reason = "Message matches a blocked pattern"
+	}
+	return &Rule{name: cfg.Name, pattern: pattern, action: action, reason: reason}, nil
+}
+
+// Name implements Filter
+func (r *Rule) Name() string {
+	return "rule:" + r.name
+}
+
+// Check implements Filter
+func (r *Rule) Check(message *models.Message) Verdict {
+	loc := r.pattern.FindStringIndex(message.Content)
+	if loc == nil {
+		return Verdict{}
+	}
+
+	verdict := Verdict{Action: r.action, Reason: r.reason, Match: message.Content[loc[0]:loc[1]]}
+	if r.action == Redact {
+		verdict.Content = r.pattern.ReplaceAllStringFunc(message.Content, mask)
+	}
+	return verdict
+}
+
+// URLs with a scheme or www prefix, and bare domains on common TLDs
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"']+|\b(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+(?:com|net|org|io|co|info|biz|xyz|me|ly|gg|app|dev|ru|tk)\b(?:/[^\s<>"']*)?`)
+
+// Links blocks links to any domain not on an allowlist
+type Links struct {
+	action  Action
+	allowed []string
+}
+
+// NewLinks creates a filter letting through links to the allowed domains
+// and their subdomains
+func NewLinks(allowed []string, action Action) *Links {
+	domains := make([]string, len(allowed))
+	for i, domain := range allowed {
+		domains[i] = strings.ToLower(strings.TrimPrefix(domain, "."))
+	}
+	return &Links{action: action, allowed: domains}
+}
+
+// Name implements Filter
+func (l *Links) Name() string {
+	return "links"
+}
+
+// Check implements Filter
+func (l *Links) Check(message *models.Message) Verdict {
+	var blocked []string
+	content := linkPattern.ReplaceAllStringFunc(message.Content, func(link string) string {
+		// Sentence punctuation usually isn't part of the link
+		trimmed := strings.TrimRight(link, ".,;:!?)")
+		host := linkHost(trimmed)
+		if l.allows(host) {
+			return link
+		}
+		blocked = append(blocked, host)
+		return "[link removed]" + link[len(trimmed):]
+	})
+	if len(blocked) == 0 {
+		return Verdict{}
+	}
+
+	return Verdict{
+		Action:  l.action,
+		Reason:  "Links to other sites are not allowed",
+		Content: content,
+		Match:   strings.Join(blocked, ","),
+	}
+}
+
+// allows reports whether host is an allowed domain or one of its subdomains
+func (l *Links) allows(host string) bool {
+	if host == "" {
+		return false
+	}
+	for _, domain := range l.allowed {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkHost returns the lowercase host a link points to
+func linkHost(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// Spam flags shouting, stretched characters and users repeating the same
+// message
+type Spam struct {
+	cfg    config.SpamConfig
+	action Action
+
+	mu        sync.Mutex
+	lastSent  map[string]*sent // by sender ID
+	lastSweep time.Time
+}
+
+// sent tracks how often a user has recently sent the same message
+type sent struct {
+	content string
+	count   int
+	first   time.Time
+}
+
+// NewSpam creates a spam filter with the thresholds in cfg
+func NewSpam(cfg config.SpamConfig, action Action) *Spam {
+	return &Spam{
+		cfg:       cfg,
+		action:    action,
+		lastSent:  make(map[string]*sent),
+		lastSweep: time.Now(),
+	}
+}
+
+// Name implements Filter
+func (s *Spam) Name() string {
+	return "spam"
+}
+
+// Check implements Filter
+func (s *Spam) Check(message *models.Message) Verdict {
+	content := message.Content
+
+	if s.cfg.MaxRepeatedChars > 0 && longestRun(content) > s.cfg.MaxRepeatedChars {
+		return Verdict{Action: s.action, Reason: "Too many repeated characters"}
+	}
+
+	if s.cfg.MaxCapsRatio > 0 {
+		var letters, upper int
+		for _, r := range content {
+			if unicode.IsLetter(r) {
+				letters++
+				if unicode.IsUpper(r) {
+					upper++
+				}
+			}
+		}
+		if letters >= s.cfg.MinCapsLength && float64(upper)/float64(letters) > s.cfg.MaxCapsRatio {
+			return Verdict{Action: s.action, Reason: "Too many capital letters"}
+		}
+	}
+
+	if s.cfg.MaxDuplicates > 0 && s.duplicate(message.SenderID, content) {
+		return Verdict{Action: s.action, Reason: "Same message sent too many times"}
+	}
+	return Verdict{}
+}
+
+// duplicate counts a message from sender and reports whether they have sent
+// it more than MaxDuplicates times within DuplicateWindow. Messages that
+// differ only in case, accents or punctuation count as the same.
+func (s *Spam) duplicate(sender, content string) bool {
+	var folded []string
+	for _, w := range words(content) {
+		folded = append(folded, w.folded)
+	}
+	key := strings.Join(folded, " ")
+	if key == "" {
+		key = content
+	}
+
+	window := s.cfg.DuplicateWindow.Duration()
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > window {
+		for id, last := range s.lastSent {
+			if now.Sub(last.first) > window {
+				delete(s.lastSent, id)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	last, ok := s.lastSent[sender]
+	if !ok || last.content != key || now.Sub(last.first) > window {
+		s.lastSent[sender] = &sent{content: key, count: 1, first: now}
+		return false
+	}
+	last.count++
+	return last.count > s.cfg.MaxDuplicates
+}
+
+// longestRun returns the length of the longest run of one repeated character
+func longestRun(s string) int {
+	longest, run := 0, 0
+	var last rune = -1
+	for _, r := range s {
+		if r == last {
+			run++
+		} else {
+			run = 1
+			last = r
+		}
+		longest = max(longest, run)
+	}
+	return longest
+}
@@ -0,0 +1,131 @@
+package moderation
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBannedWords(t *testing.T) {
+	f := NewBannedWords([]string{"darn", "heck"}, Redact)
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"well darn it", "well **** it"},
+		{"DARN", "****"},
+		{"d4rn", "****"},
+		{"daaaarn", "*******"},
+		{"d.a.r.n!", "*******!"},
+		{"dárn", "****"},
+		{"what the heck, darn", "what the ****, ****"},
+		{"darning socks", ""},
+		{"checked", ""},
+		{"dan", ""},
+	}
+	for _, tt := range tests {
+		verdict := f.Check(&models.Message{Content: tt.in})
+		if tt.want == "" {
+			if verdict.Action != Allow {
+				t.Errorf("Check(%q) = %v, want allow", tt.in, verdict.Action)
+			}
+			continue
+		}
+		if verdict.Action != Redact || verdict.Content != tt.want {
+			t.Errorf("Check(%q) = %v %q, want redact %q", tt.in, verdict.Action, verdict.Content, tt.want)
+		}
+	}
+}
+
+func TestLinks(t *testing.T) {
+	f := NewLinks([]string{"example.com"}, Redact)
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"see https://example.com/docs", ""},
+		{"see https://docs.example.com.", ""},
+		{"see https://evil.test/x.", "see [link removed]."},
+		{"go to spam.ru now", "go to [link removed] now"},
+		{"www.example.com.evil.io", "[link removed]"},
+		{"https://notexample.com", "[link removed]"},
+		{"no links here", ""},
+	}
+	for _, tt := range tests {
+		verdict := f.Check(&models.Message{Content: tt.in})
+		if tt.want == "" {
+			if verdict.Action != Allow {
+				t.Errorf("Check(%q) = %v (%s), want allow", tt.in, verdict.Action, verdict.Match)
+			}
+			continue
+		}
+		if verdict.Action != Redact || verdict.Content != tt.want {
+			t.Errorf("Check(%q) = %v %q, want redact %q", tt.in, verdict.Action, verdict.Content, tt.want)
+		}
+	}
+}
+
+func TestSpam(t *testing.T) {
+	f := NewSpam(config.SpamConfig{
+		MaxCapsRatio:     0.7,
+		MinCapsLength:    8,
+		MaxRepeatedChars: 5,
+		MaxDuplicates:    2,
+		DuplicateWindow:  config.Duration(time.Minute),
+	}, Reject)
+
+	tests := []struct {
+		sender string
+		in     string
+		reject bool
+	}{
+		{"alice", "THIS IS SHOUTING", true},
+		{"alice", "OK FINE", false},
+		{"alice", "NASA and ESA launch", false},
+		{"alice", "sooooooo good", true},
+		{"alice", "soooo good", false},
+		{"bob", "buy now", false},
+		{"bob", "Buy now!", false},
+		{"bob", "buy NOW", true},
+		{"carol", "buy now", false},
+	}
+	for _, tt := range tests {
+		verdict := f.Check(&models.Message{SenderID: tt.sender, Content: tt.in})
+		if got := verdict.Action == Reject; got != tt.reject {
+			t.Errorf("%s: Check(%q) = %v (%s), want reject %v", tt.sender, tt.in, verdict.Action, verdict.Reason, tt.reject)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	p, err := FromConfig(config.ModerationConfig{
+		BannedWords: config.BannedWordsConfig{Words: []string{"darn"}, Action: "redact"},
+		Rules:       []config.ModerationRule{{Name: "secrets", Pattern: `(?i)password\s*[:=]`, Action: "reject"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := &models.Message{ID: "1", SenderID: "alice", Room: "dev", Content: "darn, forgot it"}
+	if err := p.Apply(message); err != nil {
+		t.Fatalf("Apply() = %v", err)
+	}
+	if message.Content != "****, forgot it" {
+		t.Errorf("content = %q, want the banned word redacted", message.Content)
+	}
+
+	message = &models.Message{ID: "2", SenderID: "alice", Room: "dev", Content: "darn Password: hunter2"}
+	var coded *models.CodedError
+	if err := p.Apply(message); !errors.As(err, &coded) || coded.Code != models.ErrorCodeMessageRejected {
+		t.Errorf("Apply() = %v, want message_rejected", err)
+	}
+
+	if _, err := FromConfig(config.ModerationConfig{Rules: []config.ModerationRule{{Name: "bad", Pattern: "(", Action: "reject"}}}); err == nil {
+		t.Error("FromConfig() accepted an invalid pattern")
+	}
+	if _, err := FromConfig(config.ModerationConfig{Links: config.LinksConfig{Action: "delete"}}); err == nil {
+		t.Error("FromConfig() accepted an unknown action")
+	}
+}
@@ -0,0 +1,212 @@
+package moderation
+
+import (
+	"chatstreamapp/internal/audit"
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/metrics"
+	"chatstreamapp/internal/models"
+	"fmt"
+	"sync/atomic"
+)
+
+// Action is what a filter decides to do with a message
+type Action int
+
+const (
+	// Deliver the message unchanged
+	Allow Action = iota
+
+	// Deliver the message with the offending parts replaced
+	Redact
+
+	// Queue the message for a moderator instead of delivering it
+	Hold
+
+	// Drop the message and tell the sender why
+	Reject
+)
+
+// String returns the action's name as used in config and metrics
+func (a Action) String() string {
+	switch a {
+	case Redact:
+		return "redact"
+	case Hold:
+		return "hold"
+	case Reject:
+		return "reject"
+	}
+	return "allow"
+}
+
+// ParseAction converts a configured action name. Empty means Allow.
+func ParseAction(name string) (Action, error) {
+	switch name {
+	case "", "allow":
+		return Allow, nil
+	case "redact":
+		return Redact, nil
+	case "hold":
+		return Hold, nil
+	case "reject":
+		return Reject, nil
+	}
+	return Allow, fmt.Errorf("unknown moderation action %q", name)
+}
+
+// Verdict is a filter's decision about one message
+type Verdict struct {
+	Action Action
+
+	// Why the filter acted; told to the sender of held and rejected messages
+	Reason string
+
+	// The rewritten content, for Redact
+	Content string
+
+	// What matched, for the audit log only
+	Match string
+}
+
+// Filter inspects messages before delivery. Filters run in order and may be
+// called concurrently.
+type Filter interface {
+	// Name identifies the filter in the audit log and metrics
+	Name() string
+
+	Check(message *models.Message) Verdict
+}
+
+// Pipeline runs messages through a list of filters
+type Pipeline struct {
+	filters []Filter
+}
+
+// NewPipeline creates a pipeline running filters in the given order
+func NewPipeline(filters ...Filter) *Pipeline {
+	return &Pipeline{filters: filters}
+}
+
+// FromConfig builds the built-in filters enabled in cfg, followed by extra
+func FromConfig(cfg config.ModerationConfig, extra ...Filter) (*Pipeline, error) {
+	var filters []Filter
+
+	if len(cfg.BannedWords.Words) > 0 && cfg.BannedWords.Action != "" {
+		action, err := ParseAction(cfg.BannedWords.Action)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, NewBannedWords(cfg.BannedWords.Words, action))
+	}
+
+	for _, rule := range cfg.Rules {
+		filter, err := NewRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	if cfg.Links.Action != "" {
+		action, err := ParseAction(cfg.Links.Action)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, NewLinks(cfg.Links.AllowedDomains, action))
+	}
+
+	if cfg.Spam.Action != "" {
+		action, err := ParseAction(cfg.Spam.Action)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, NewSpam(cfg.Spam, action))
+	}
+
+	return NewPipeline(append(filters, extra...)...), nil
+}
+
+// Apply runs message through the filters before it is delivered. Redactions
+// rewrite message.Content in place and later filters see the result. A held
+// message goes to the review queue and a rejected one is dropped; both
+// return an error to report to the sender. Every action is audited.
+func (p *Pipeline) Apply(message *models.Message) error {
+	for _, filter := range p.filters {
+		verdict := filter.Check(message)
+		if verdict.Action == Allow {
+			continue
+		}
+
+		record(filter.Name(), message, verdict)
+		switch verdict.Action {
+		case Redact:
+			message.Content = verdict.Content
+		case Hold:
+			if !Review.hold(message, filter.Name(), verdict.Reason) {
+				record(filter.Name(), message, Verdict{Action: Reject, Reason: "Review queue is full"})
+				return rejected(verdict.Reason)
+			}
+			return &models.CodedError{
+				Code:    models.ErrorCodeMessageHeld,
+				Message: "Message held for review: " + verdict.Reason,
+			}
+		case Reject:
+			return rejected(verdict.Reason)
+		}
+	}
+	return nil
+}
+
+// rejected builds the error telling the sender why their message was dropped
+func rejected(reason string) error {
+	return &models.CodedError{
+		Code:    models.ErrorCodeMessageRejected,
+		Message: "Message rejected: " + reason,
+	}
+}
+
+// record audits a filter's action on a message
+func record(filter string, message *models.Message, verdict Verdict) {
+	metrics.ModerationActions.WithLabelValues(filter, verdict.Action.String()).Inc()
+
+	entry := audit.Entry{
+		Actor:  "filter:" + filter,
+		Action: "message." + verdict.Action.String(),
+		Target: message.ID,
+		UserID: message.SenderID,
+		Room:   message.Room,
+		Reason: verdict.Reason,
+	}
+	if verdict.Match != "" {
+		entry.Details = map[string]string{"match": verdict.Match}
+	}
+	audit.Record(entry)
+}
+
+// The active pipeline, swapped on config reload
+var current atomic.Pointer[Pipeline]
+
+func init() {
+	current.Store(NewPipeline())
+}
+
+// SetPipeline makes p the pipeline used by Apply
+func SetPipeline(p *Pipeline) {
+	current.Store(p)
+}
+
+// Apply rejects messages from banned or muted senders, then runs message
+// through the active pipeline
+func Apply(message *models.Message) error {
+	if err := Sanctions.Check(message.SenderID, message.Room); err != nil {
+		return err
+	}
+	return current.Load().Apply(message)
+}
+
+// IsModerator reports whether a connected user may moderate: they connected
+// with a moderator token and are still configured as a moderator, so
+// moderators removed on reload lose the rights straight away
+func IsModerator(user *models.User) bool {
+	return user.Moderator && config.Get().Moderation.IsModerator(user.ID)
+}
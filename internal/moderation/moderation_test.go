@@ -0,0 +1,29 @@
+package moderation
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/models"
+	"testing"
+)
+
+func TestIsModerator(t *testing.T) {
+	cfg := config.Default()
+	cfg.Moderation.Moderators = []config.Moderator{{UserID: "alice", Token: "alice-token"}}
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	tests := []struct {
+		name string
+		user *models.User
+		want bool
+	}{
+		{"authenticated moderator", &models.User{ID: "alice", Moderator: true}, true},
+		{"claimed moderator ID", &models.User{ID: "alice"}, false},
+		{"removed moderator", &models.User{ID: "bob", Moderator: true}, false},
+	}
+	for _, tt := range tests {
+		if got := IsModerator(tt.user); got != tt.want {
+			t.Errorf("%s: IsModerator() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package moderation
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Digits and symbols commonly substituted for letters
+var leetspeak = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'8': 'b',
+	'@': 'a',
+	'$': 's',
+}
+
+// word is a run of letters in a message
+type word struct {
+	// Byte range of the word in the original text
+	start, end int
+
+	// The word folded by foldRune
+	folded string
+}
+
+// foldRune reduces a character to the plain lowercase letters it stands
+// for: accents are stripped, compatibility forms such as fullwidth letters
+// and ligatures are decomposed, and leetspeak digits become letters. It
+// returns "" for separators.
+func foldRune(r rune) string {
+	if letter, ok := leetspeak[r]; ok {
+		return string(letter)
+	}
+
+	var b strings.Builder
+	for _, d := range norm.NFKD.String(string(r)) {
+		switch {
+		case unicode.Is(unicode.Mn, d):
+			// Combining accent
+		case unicode.IsLetter(d) || unicode.IsDigit(d):
+			b.WriteRune(unicode.ToLower(d))
+		}
+	}
+	return b.String()
+}
+
+// words splits text into folded words. Runs of single letters with
+// separators between them, as in "b.a.d" or "b a d", are also joined into
+// one word so spelling a word out doesn't hide it.
+func words(text string) []word {
+	var list []word
+	var current strings.Builder
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			list = append(list, word{start: start, end: end, folded: current.String()})
+			current.Reset()
+			start = -1
+		}
+	}
+
+	for i, r := range text {
+		folded := foldRune(r)
+		if folded == "" {
+			flush(i)
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		current.WriteString(folded)
+	}
+	flush(len(text))
+
+	return append(list, spelledOut(list)...)
+}
+
+// spelledOut joins each run of two or more consecutive one-letter words
+func spelledOut(list []word) []word {
+	var joined []word
+	for i := 0; i < len(list); {
+		j := i
+		var b strings.Builder
+		for j < len(list) && utf8.RuneCountInString(list[j].folded) == 1 {
+			b.WriteString(list[j].folded)
+			j++
+		}
+		if j-i >= 2 {
+			joined = append(joined, word{start: list[i].start, end: list[j-1].end, folded: b.String()})
+		}
+		if j == i {
+			j++
+		}
+		i = j
+	}
+	return joined
+}
+
+// squeeze collapses runs of a repeated letter, so "baaad" and "bad" compare
+// equal
+func squeeze(s string) string {
+	var b strings.Builder
+	var last rune = -1
+	for _, r := range s {
+		if r != last {
+			b.WriteRune(r)
+			last = r
+		}
+	}
+	return b.String()
+}
+
+// mask replaces every character of s with an asterisk
+func mask(s string) string {
+	return strings.Repeat("*", utf8.RuneCountInString(s))
+}
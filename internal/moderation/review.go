@@ -0,0 +1,75 @@
+package moderation
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/metrics"
+	"chatstreamapp/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HeldMessage is a message waiting for a moderator's decision
+type HeldMessage struct {
+	Message *models.Message `json:"message"`
+	Filter  string          `json:"filter"`
+	Reason  string          `json:"reason"`
+	HeldAt  time.Time       `json:"held_at"`
+}
+
+// ReviewQueue holds messages until a moderator approves or discards them
+type ReviewQueue struct {
+	mu   sync.Mutex
+	held map[string]*HeldMessage
+}
+
+// Review is the queue held messages go to
+var Review = &ReviewQueue{held: make(map[string]*HeldMessage)}
+
+// hold queues a message, reporting false when the queue is full
+func (q *ReviewQueue) hold(message *models.Message, filter, reason string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.held) >= config.Get().Moderation.MaxHeld {
+		return false
+	}
+	copied := *message
+	q.held[message.ID] = &HeldMessage{
+		Message: &copied,
+		Filter:  filter,
+		Reason:  reason,
+		HeldAt:  time.Now(),
+	}
+	metrics.ModerationHeld.Set(float64(len(q.held)))
+	return true
+}
+
+// List returns the held messages, oldest first
+func (q *ReviewQueue) List() []*HeldMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	list := make([]*HeldMessage, 0, len(q.held))
+	for _, held := range q.held {
+		list = append(list, held)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].HeldAt.Before(list[j].HeldAt)
+	})
+	return list
+}
+
+// Take removes a held message from the queue so it can be delivered or
+// discarded
+func (q *ReviewQueue) Take(id string) (*HeldMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	held, ok := q.held[id]
+	if ok {
+		delete(q.held, id)
+		metrics.ModerationHeld.Set(float64(len(q.held)))
+	}
+	return held, ok
+}
@@ -0,0 +1,189 @@
+package moderation
+
+import (
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/store"
+	"sync"
+	"time"
+)
+
+// SanctionKind is a type of restriction placed on a user
+type SanctionKind string
+
+const (
+	// Banned users can't connect, or can't join the room the ban is for
+	Ban SanctionKind = "ban"
+
+	// Muted users can't send messages or typing indicators
+	Mute SanctionKind = "mute"
+)
+
+// Sanction restricts a user on the whole server or, with Room set, in one room
+type Sanction struct {
+	Kind   SanctionKind `json:"kind"`
+	UserID string       `json:"user_id"`
+	Room   string       `json:"room,omitempty"`
+	Reason string       `json:"reason,omitempty"`
+
+	// Who imposed it: an operator name or a moderator's user ID
+	By        string    `json:"by"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Nil for sanctions that last until lifted
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// active reports whether the sanction is still in force at now
+func (s *Sanction) active(now time.Time) bool {
+	return s.ExpiresAt == nil || now.Before(*s.ExpiresAt)
+}
+
+// Err builds the error reported to a user the sanction stops
+func (s *Sanction) Err() error {
+	coded := &models.CodedError{}
+	switch s.Kind {
+	case Ban:
+		coded.Code = models.ErrorCodeBanned
+		coded.Message = "You are banned"
+		if s.Room != "" {
+			coded.Message = "You are banned from this room"
+		}
+	default:
+		coded.Code = models.ErrorCodeMuted
+		coded.Message = "You are muted"
+	}
+	if s.Reason != "" {
+		coded.Message += ": " + s.Reason
+	}
+	if s.ExpiresAt != nil {
+		coded.RetryAfter = time.Until(*s.ExpiresAt)
+	}
+	return coded
+}
+
+// SanctionList holds the active mutes and bans. Changes are saved to a file
+// when one is set, so they survive restarts.
+type SanctionList struct {
+	mu   sync.Mutex
+	path string
+	list []*Sanction
+}
+
+// Sanctions is the server's list of mutes and bans
+var Sanctions = &SanctionList{}
+
+// Load reads the sanctions saved at path, which later changes are saved to.
+// A missing file is an empty list.
+func (l *SanctionList) Load(path string) error {
+	var list []*Sanction
+	if err := store.LoadJSON(path, "sanctions", &list); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.path = path
+	l.list = list
+	return nil
+}
+
+// Add imposes a sanction, replacing any of the same kind for the same user
+// and room
+func (l *SanctionList) Add(s Sanction) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.remove(s.Kind, s.UserID, s.Room)
+	l.list = append(l.list, &s)
+	return l.save()
+}
+
+// Remove lifts a sanction, reporting false if there was none
+func (l *SanctionList) Remove(kind SanctionKind, userID, room string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.remove(kind, userID, room) {
+		return false, nil
+	}
+	return true, l.save()
+}
+
+func (l *SanctionList) remove(kind SanctionKind, userID, room string) bool {
+	now := time.Now()
+	kept := l.list[:0]
+	found := false
+	for _, s := range l.list {
+		if s.Kind == kind && s.UserID == userID && s.Room == room && s.active(now) {
+			found = true
+			continue
+		}
+		kept = append(kept, s)
+	}
+	l.list = kept
+	return found
+}
+
+// Find returns the sanction of kind that applies to userID in room: one for
+// that room or one for the whole server. An empty room only matches
+// server-wide sanctions.
+func (l *SanctionList) Find(kind SanctionKind, userID, room string) *Sanction {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for _, s := range l.list {
+		if s.Kind == kind && s.UserID == userID && (s.Room == "" || s.Room == room) && s.active(now) {
+			copied := *s
+			return &copied
+		}
+	}
+	return nil
+}
+
+// Check returns the error for a ban or mute stopping userID from speaking in
+// room, or nil
+func (l *SanctionList) Check(userID, room string) error {
+	for _, kind := range []SanctionKind{Ban, Mute} {
+		if s := l.Find(kind, userID, room); s != nil {
+			return s.Err()
+		}
+	}
+	return nil
+}
+
+// List returns the sanctions in force
+func (l *SanctionList) List() []Sanction {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	list := make([]Sanction, 0, len(l.list))
+	for _, s := range l.list {
+		if s.active(now) {
+			list = append(list, *s)
+		}
+	}
+	return list
+}
+
+// save writes the sanctions in force to the file, replacing it atomically.
+// Expired ones are dropped.
+func (l *SanctionList) save() error {
+	now := time.Now()
+	kept := l.list[:0]
+	for _, s := range l.list {
+		if s.active(now) {
+			kept = append(kept, s)
+		}
+	}
+	l.list = kept
+
+	if l.path == "" {
+		return nil
+	}
+	if l.list == nil {
+		l.list = []*Sanction{}
+	}
+	return store.SaveJSON(l.path, "sanctions", l.list)
+}
@@ -0,0 +1,74 @@
+package moderation
+
+import (
+	"chatstreamapp/internal/models"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSanctionList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sanctions.json")
+	l := &SanctionList{}
+	if err := l.Load(path); err != nil {
+		t.Fatalf("Load() of a missing file = %v", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	for _, s := range []Sanction{
+		{Kind: Ban, UserID: "mallory", Room: "dev", Reason: "spam"},
+		{Kind: Mute, UserID: "eve"},
+		{Kind: Mute, UserID: "trent", ExpiresAt: &past},
+	} {
+		if err := l.Add(s); err != nil {
+			t.Fatalf("Add() = %v", err)
+		}
+	}
+
+	tests := []struct {
+		userID string
+		room   string
+		code   string
+	}{
+		{"mallory", "dev", models.ErrorCodeBanned},
+		{"mallory", "general", ""},
+		{"mallory", "", ""},
+		{"eve", "dev", models.ErrorCodeMuted},
+		{"eve", "", models.ErrorCodeMuted},
+		{"trent", "dev", ""},
+		{"bob", "dev", ""},
+	}
+	for _, tt := range tests {
+		err := l.Check(tt.userID, tt.room)
+		var coded *models.CodedError
+		switch {
+		case tt.code == "" && err != nil:
+			t.Errorf("Check(%s, %q) = %v, want nil", tt.userID, tt.room, err)
+		case tt.code != "" && (!errors.As(err, &coded) || coded.Code != tt.code):
+			t.Errorf("Check(%s, %q) = %v, want %s", tt.userID, tt.room, err, tt.code)
+		}
+	}
+	if err := l.Check("mallory", "dev"); err.Error() != "You are banned from this room: spam" {
+		t.Errorf("ban error = %q", err)
+	}
+
+	// Sanctions survive a restart, without the expired ones
+	reloaded := &SanctionList{}
+	if err := reloaded.Load(path); err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if got := len(reloaded.List()); got != 2 {
+		t.Errorf("reloaded %d sanctions, want 2", got)
+	}
+
+	if removed, err := reloaded.Remove(Ban, "mallory", "dev"); !removed || err != nil {
+		t.Fatalf("Remove() = %v, %v", removed, err)
+	}
+	if removed, _ := reloaded.Remove(Ban, "mallory", "dev"); removed {
+		t.Error("Remove() lifted a ban twice")
+	}
+	if err := reloaded.Check("mallory", "dev"); err != nil {
+		t.Errorf("Check() after unban = %v", err)
+	}
+}
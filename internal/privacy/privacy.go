@@ -0,0 +1,186 @@
+package privacy
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/store"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Who may send a user private messages
+const (
+	Everyone   = "everyone"
+	SharedRoom = "shared_room"
+	Nobody     = "nobody"
+)
+
+// Settings are one user's privacy choices
+type Settings struct {
+	// User IDs whose private messages and mentions are not delivered
+	Blocked []string `json:"blocked,omitempty"`
+
+	// Everyone, SharedRoom or Nobody. Empty uses the configured default.
+	DirectMessages string `json:"direct_messages,omitempty"`
+
+	// Leave the user out of GET /api/users
+	Hidden bool `json:"hidden,omitempty"`
+}
+
+// Store holds every user's settings by user ID. Changes are saved to a file
+// when one is set, so they survive restarts.
+type Store struct {
+	mu    sync.RWMutex
+	path  string
+	users map[string]*Settings
+}
+
+// Users is the server's privacy settings store
+var Users = &Store{users: make(map[string]*Settings)}
+
+// Load reads the settings saved at path, which later changes are saved to.
+// A missing file is an empty store.
+func (s *Store) Load(path string) error {
+	users := make(map[string]*Settings)
+	if err := store.LoadJSON(path, "privacy settings", &users); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	s.users = users
+	return nil
+}
+
+// Get returns a copy of userID's settings
+func (s *Store) Get(userID string) Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settings, ok := s.users[userID]
+	if !ok {
+		return Settings{}
+	}
+	copied := *settings
+	copied.Blocked = slices.Clone(settings.Blocked)
+	return copied
+}
+
+// Block stops other's private messages and mentions reaching userID. It
+// fails once userID has blocked privacy.max_blocked users.
+func (s *Store) Block(userID, other string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings := s.settings(userID)
+	if slices.Contains(settings.Blocked, other) {
+		return nil
+	}
+	if limit := config.Get().Privacy.MaxBlocked; len(settings.Blocked) >= limit {
+		return &models.CodedError{
+			Code:    models.ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("You can block at most %d users; unblock someone first", limit),
+		}
+	}
+	settings.Blocked = append(settings.Blocked, other)
+	return s.save()
+}
+
+// Unblock lifts a block, reporting false if there was none
+func (s *Store) Unblock(userID, other string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings, ok := s.users[userID]
+	if !ok || !slices.Contains(settings.Blocked, other) {
+		return false, nil
+	}
+	settings.Blocked = slices.DeleteFunc(settings.Blocked, func(id string) bool { return id == other })
+	return true, s.save()
+}
+
+// SetPrivacy replaces userID's direct message policy and directory
+// visibility, keeping their block list
+func (s *Store) SetPrivacy(userID, directMessages string, hidden bool) error {
+	if directMessages != "" && !slices.Contains(config.DirectMessagePolicies, directMessages) {
+		return fmt.Errorf("unknown direct message policy %q", directMessages)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings := s.settings(userID)
+	settings.DirectMessages = directMessages
+	settings.Hidden = hidden
+	return s.save()
+}
+
+// Blocks reports whether userID has blocked other
+func (s *Store) Blocks(userID, other string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settings, ok := s.users[userID]
+	return ok && slices.Contains(settings.Blocked, other)
+}
+
+// Hidden reports whether userID asked to be left out of the user directory
+func (s *Store) Hidden(userID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settings, ok := s.users[userID]
+	return ok && settings.Hidden
+}
+
+// AcceptsDirect reports whether recipient takes private messages from
+// sender. sharedRoom says whether the two are in the same room.
+func (s *Store) AcceptsDirect(recipient, sender string, sharedRoom bool) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	policy := config.Get().Privacy.DirectMessages
+	if settings, ok := s.users[recipient]; ok {
+		if slices.Contains(settings.Blocked, sender) {
+			return false
+		}
+		if settings.DirectMessages != "" {
+			policy = settings.DirectMessages
+		}
+	}
+
+	switch policy {
+	case Nobody:
+		return false
+	case SharedRoom:
+		return sharedRoom
+	}
+	return true
+}
+
+// settings returns userID's settings for changing, creating them if needed
+func (s *Store) settings(userID string) *Settings {
+	settings, ok := s.users[userID]
+	if !ok {
+		settings = &Settings{}
+		s.users[userID] = settings
+	}
+	return settings
+}
+
+// save writes every user's settings to the file, replacing it atomically.
+// Users left with the defaults are dropped.
+func (s *Store) save() error {
+	for userID, settings := range s.users {
+		if len(settings.Blocked) == 0 && settings.DirectMessages == "" && !settings.Hidden {
+			delete(s.users, userID)
+		}
+	}
+
+	if s.path == "" {
+		return nil
+	}
+	return store.SaveJSON(s.path, "privacy settings", s.users)
+}
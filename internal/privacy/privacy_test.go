@@ -0,0 +1,50 @@
+package privacy
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/models"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlockLimit(t *testing.T) {
+	cfg := config.Default()
+	cfg.Privacy.MaxBlocked = 2
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	path := filepath.Join(t.TempDir(), "privacy.json")
+	s := &Store{}
+	if err := s.Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, other := range []string{"bob", "carol", "bob"} {
+		if err := s.Block("alice", other); err != nil {
+			t.Fatalf("Block(%q) = %v", other, err)
+		}
+	}
+	var coded *models.CodedError
+	if err := s.Block("alice", "dave"); !errors.As(err, &coded) || coded.Code != models.ErrorCodeInvalidRequest {
+		t.Fatalf("Block beyond max_blocked = %v, want invalid_request", err)
+	}
+	if s.Blocks("alice", "dave") {
+		t.Error("block beyond max_blocked was kept")
+	}
+
+	// Unblocking makes room again, and the list survives a restart
+	if _, err := s.Unblock("alice", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Block("alice", "dave"); err != nil {
+		t.Fatalf("Block after unblock = %v", err)
+	}
+	reloaded := &Store{}
+	if err := reloaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Get("alice").Blocked; len(got) != 2 || got[0] != "carol" || got[1] != "dave" {
+		t.Errorf("reloaded block list = %v, want [carol dave]", got)
+	}
+}
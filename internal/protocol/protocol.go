@@ -0,0 +1,312 @@
+package protocol
+
+import (
+	"chatstreamapp/internal/models"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Subprotocol names negotiated through Sec-WebSocket-Protocol
+const (
+	// Envelope format: {"op", "request_id", "payload"}
+	V1 = "chat.v1"
+
+	// Legacy format: models.Message with commands in "type". Connections
+	// that don't ask for a subprotocol use it.
+	V0 = "chat.v0"
+)
+
+// Client operations
+const (
+	OpSendMessage = "send_message"
+	OpTyping      = "typing"
+	OpJoinRoom    = "join_room"
+	OpLeaveRoom   = "leave_room"
+
+	// Moderator operations
+	OpMute   = "mute"
+	OpUnmute = "unmute"
+	OpKick   = "kick"
+	OpBan    = "ban"
+	OpUnban  = "unban"
+
+	// Privacy operations
+	OpBlock      = "block"
+	OpUnblock    = "unblock"
+	OpSetPrivacy = "set_privacy"
+
+	// Bot operations
+	OpRegisterCommand   = "register_command"
+	OpUnregisterCommand = "unregister_command"
+	OpCommandResponse   = "command_response"
+)
+
+// Server events
+const (
+	EventMessage = "message"
+	EventAck     = "ack"
+	EventError   = "error"
+
+	// The session's resume token, sent first on every v1 connection. It is
+	// the only server event without a seq.
+	EventSession = "session"
+
+	// Several events coalesced into one frame, in order
+	EventBatch = "batch"
+
+	// The room list, sent in full on connecting and then kept current with
+	// one event per changed room
+	EventRoomsSnapshot = "rooms_snapshot"
+	EventRoomCreated   = "room_created"
+	EventRoomUpdated   = "room_updated"
+	EventRoomDeleted   = "room_deleted"
+
+	// A slash command for the bot that registered it to answer
+	EventCommand = "command"
+)
+
+// Envelope is the v1 frame wrapping every operation and event. Server
+// events carry Seq, their position in the connection's event stream.
+type Envelope struct {
+	Op        string          `json:"op"`
+	RequestID string          `json:"request_id,omitempty"`
+	Seq       uint64          `json:"seq,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// SendMessage sends a message to a room or, with a recipient, privately
+type SendMessage struct {
+	Room      string `json:"room,omitempty" proto:"1"`
+	Recipient string `json:"recipient,omitempty" proto:"2"`
+	Content   string `json:"content" proto:"3"`
+
+	// How Content is written: "plain" (the default) or "markdown"
+	Format string `json:"format,omitempty" proto:"4"`
+}
+
+// Typing tells the room the sender is typing
+type Typing struct {
+	Room string `json:"room" proto:"1"`
+}
+
+// JoinRoom moves the sender into a room, creating it if needed
+type JoinRoom struct {
+	Room string `json:"room" proto:"1"`
+}
+
+// LeaveRoom removes the sender from a room
+type LeaveRoom struct {
+	Room string `json:"room" proto:"1"`
+}
+
+// Moderate is the payload of the moderator operations. Without a room, mutes
+// and bans apply on the whole server; kick always needs one.
+type Moderate struct {
+	UserID string `json:"user_id" proto:"1"`
+	Room   string `json:"room,omitempty" proto:"2"`
+
+	// How long a mute or ban lasts; 0 makes it permanent
+	DurationMs int64 `json:"duration_ms,omitempty" proto:"3"`
+
+	Reason string `json:"reason,omitempty" proto:"4"`
+}
+
+// Block stops, or with unblock resumes, private messages and mentions from
+// another user
+type Block struct {
+	UserID string `json:"user_id" proto:"1"`
+}
+
+// SetPrivacy replaces the sender's privacy settings. The block list is kept.
+type SetPrivacy struct {
+	// "everyone", "shared_room" or "nobody"; empty uses the server default
+	DirectMessages string `json:"direct_messages,omitempty" proto:"1"`
+
+	// Leave the sender out of the user directory
+	Hidden bool `json:"hidden,omitempty" proto:"2"`
+}
+
+// RegisterCommand adds a slash command handled by the sending bot, replacing
+// its earlier registration of the same name
+type RegisterCommand struct {
+	Name string `json:"name" proto:"1"`
+
+	// Arguments as shown by /help, e.g. "<city>"
+	Usage string `json:"usage,omitempty" proto:"2"`
+
+	Description string `json:"description,omitempty" proto:"3"`
+
+	// Who may run it: "everyone" (the default) or "moderator"
+	Permission string `json:"permission,omitempty" proto:"4"`
+}
+
+// UnregisterCommand removes a slash command the sending bot registered
+type UnregisterCommand struct {
+	Name string `json:"name" proto:"1"`
+}
+
+// CommandResponse answers a command event. A bot may respond more than once,
+// e.g. to report progress, until the invocation expires.
+type CommandResponse struct {
+	InvocationID string `json:"invocation_id" proto:"1"`
+	Text         string `json:"text" proto:"2"`
+
+	// "ephemeral" (the default) shows the response only to the user who
+	// ran the command; "room" posts it to the room
+	Visibility string `json:"visibility,omitempty" proto:"3"`
+}
+
+// Ack confirms a request. ID is the message the request created, if any.
+type Ack struct {
+	ID string `json:"id,omitempty" proto:"1"`
+}
+
+// RoomsSnapshot is every room listed to the user
+type RoomsSnapshot struct {
+	Rooms []models.RoomInfo `json:"rooms" proto:"1"`
+}
+
+// RoomDeleted names a room that no longer exists
+type RoomDeleted struct {
+	ID string `json:"id" proto:"1"`
+}
+
+// Request is a decoded client operation, independent of the wire version.
+// Payload is a pointer to the op's payload type, or nil for unknown ops.
+type Request struct {
+	Op        string
+	RequestID string
+	Payload   any
+}
+
+// Payload types of client operations, used for decoding and the schema
+var requests = map[string]func() any{
+	OpSendMessage: func() any { return &SendMessage{} },
+	OpTyping:      func() any { return &Typing{} },
+	OpJoinRoom:    func() any { return &JoinRoom{} },
+	OpLeaveRoom:   func() any { return &LeaveRoom{} },
+	OpMute:        func() any { return &Moderate{} },
+	OpUnmute:      func() any { return &Moderate{} },
+	OpKick:        func() any { return &Moderate{} },
+	OpBan:         func() any { return &Moderate{} },
+	OpUnban:       func() any { return &Moderate{} },
+	OpBlock:       func() any { return &Block{} },
+	OpUnblock:     func() any { return &Block{} },
+	OpSetPrivacy:  func() any { return &SetPrivacy{} },
+
+	OpRegisterCommand:   func() any { return &RegisterCommand{} },
+	OpUnregisterCommand: func() any { return &UnregisterCommand{} },
+	OpCommandResponse:   func() any { return &CommandResponse{} },
+}
+
+// Payload types of server events
+var events = map[string]func() any{
+	EventMessage: func() any { return &models.Message{} },
+	EventAck:     func() any { return &Ack{} },
+	EventError:   func() any { return &models.ErrorInfo{} },
+	EventSession: func() any { return &models.SessionInfo{} },
+	EventBatch:   func() any { return &[]Envelope{} },
+
+	EventRoomsSnapshot: func() any { return &RoomsSnapshot{} },
+	EventRoomCreated:   func() any { return &models.RoomInfo{} },
+	EventRoomUpdated:   func() any { return &models.RoomInfo{} },
+	EventRoomDeleted:   func() any { return &RoomDeleted{} },
+
+	EventCommand: func() any { return &models.Invocation{} },
+}
+
+// NewRequest builds a request for op, filling the payload with decode. Unknown
+// ops get a nil payload and are reported by the caller; payloads that fail to
+// decode return an invalid_request error along with the request.
+func NewRequest(op, requestID string, decode func(payload any) error) (*Request, error) {
+	if op == "" {
+		return nil, invalid("Missing op")
+	}
+
+	req := &Request{Op: op, RequestID: requestID}
+	newPayload, ok := requests[op]
+	if !ok {
+		return req, nil
+	}
+
+	payload := newPayload()
+	if err := decode(payload); err != nil {
+		return req, invalid("Invalid %s payload: %v", op, err)
+	}
+	req.Payload = payload
+	return req, nil
+}
+
+// Event returns the server op and payload a message is sent as
+func Event(message *models.Message) (string, any) {
+	switch message.Type {
+	case models.MessageTypeAck:
+		return EventAck, &Ack{ID: message.ID}
+	case models.MessageTypeError:
+		return EventError, message.Error
+	case models.MessageTypeSession:
+		return EventSession, message.Session
+	case models.MessageTypeRoomsSnapshot:
+		return EventRoomsSnapshot, &RoomsSnapshot{Rooms: message.Rooms}
+	case models.MessageTypeRoomCreated, models.MessageTypeRoomUpdated:
+		if len(message.Rooms) == 1 {
+			return string(message.Type), &message.Rooms[0]
+		}
+	case models.MessageTypeRoomDeleted:
+		return EventRoomDeleted, &RoomDeleted{ID: message.Room}
+	case models.MessageTypeCommand:
+		return EventCommand, message.Command
+	}
+	return EventMessage, message
+}
+
+// Adapter translates between one wire format and the server's types
+type Adapter interface {
+	// Subprotocol returns the negotiated name of the format
+	Subprotocol() string
+
+	// Decode parses a client frame. Malformed frames return a CodedError,
+	// along with a request carrying the request ID if it could be read.
+	Decode(data []byte) (*Request, error)
+
+	// Encode renders a message for the client
+	Encode(message *models.Message) ([]byte, error)
+}
+
+// BatchEncoder is implemented by formats that can carry several messages in
+// one frame
+type BatchEncoder interface {
+	EncodeBatch(messages []*models.Message) ([]byte, error)
+}
+
+var adapters = map[string]Adapter{
+	V1: v1{},
+	V0: v0{},
+}
+
+// ForSubprotocol returns the adapter for a negotiated subprotocol. An empty
+// name selects the legacy format.
+func ForSubprotocol(name string) (Adapter, error) {
+	if name == "" {
+		return adapters[V0], nil
+	}
+	adapter, ok := adapters[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported subprotocol %q", name)
+	}
+	return adapter, nil
+}
+
+func invalid(format string, args ...any) error {
+	return &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+func sortedKeys(m map[string]func() any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,284 @@
+package protocol
+
+import (
+	"chatstreamapp/internal/models"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeV0(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   string
+		want    *Request
+		wantErr bool
+	}{
+		{
+			name:  "text message",
+			frame: `{"type":"text","room":"general","content":"hi","format":"markdown","request_id":"1"}`,
+			want: &Request{Op: OpSendMessage, RequestID: "1",
+				Payload: &SendMessage{Room: "general", Content: "hi", Format: "markdown"}},
+		},
+		{
+			name:  "private message",
+			frame: `{"type":"text","recipient":"bob","content":"psst"}`,
+			want:  &Request{Op: OpSendMessage, Payload: &SendMessage{Recipient: "bob", Content: "psst"}},
+		},
+		{
+			name:  "typing",
+			frame: `{"type":"typing","room":"general"}`,
+			want:  &Request{Op: OpTyping, Payload: &Typing{Room: "general"}},
+		},
+		{
+			// Room commands carry the room in content
+			name:  "join room",
+			frame: `{"type":"join_room","content":"random","request_id":"2"}`,
+			want:  &Request{Op: OpJoinRoom, RequestID: "2", Payload: &JoinRoom{Room: "random"}},
+		},
+		{
+			name:  "leave room",
+			frame: `{"type":"leave_room","content":"random"}`,
+			want:  &Request{Op: OpLeaveRoom, Payload: &LeaveRoom{Room: "random"}},
+		},
+		{
+			name:  "unknown type",
+			frame: `{"type":"dance","request_id":"3"}`,
+			want:  &Request{Op: "dance", RequestID: "3"},
+		},
+		{
+			name:    "malformed",
+			frame:   `{"type":`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := v0{}.Decode([]byte(tt.frame))
+			if tt.wantErr {
+				assertInvalid(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(req, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", req, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeV0(t *testing.T) {
+	// The legacy format sends every message as-is, whatever its type
+	for _, message := range []*models.Message{
+		{ID: "m1", Type: models.MessageTypeText, Content: "hi", Sender: "alice", Room: "general"},
+		{Type: models.MessageTypeAck, ID: "m1", RequestID: "1"},
+		{Type: models.MessageTypeError, Error: &models.ErrorInfo{Code: models.ErrorCodeRoomNotFound, Message: "Room not found"}},
+	} {
+		t.Run(string(message.Type), func(t *testing.T) {
+			data, err := v0{}.Encode(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := json.Marshal(message)
+			if string(data) != string(want) {
+				t.Errorf("Encode() = %s, want %s", data, want)
+			}
+		})
+	}
+}
+
+func TestDecodeV1(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   string
+		want    *Request
+		wantErr bool
+	}{
+		{
+			name:  "send message",
+			frame: `{"op":"send_message","request_id":"1","payload":{"room":"general","content":"hi"}}`,
+			want: &Request{Op: OpSendMessage, RequestID: "1",
+				Payload: &SendMessage{Room: "general", Content: "hi"}},
+		},
+		{
+			name:  "join room",
+			frame: `{"op":"join_room","payload":{"room":"random"}}`,
+			want:  &Request{Op: OpJoinRoom, Payload: &JoinRoom{Room: "random"}},
+		},
+		{
+			name:  "moderation",
+			frame: `{"op":"mute","payload":{"user_id":"bob","duration_ms":60000,"reason":"spam"}}`,
+			want:  &Request{Op: OpMute, Payload: &Moderate{UserID: "bob", DurationMs: 60000, Reason: "spam"}},
+		},
+		{
+			name:  "missing payload",
+			frame: `{"op":"typing"}`,
+			want:  &Request{Op: OpTyping, Payload: &Typing{}},
+		},
+		{
+			// The caller reports unknown ops, with the request ID
+			name:  "unknown op",
+			frame: `{"op":"dance","request_id":"2","payload":{}}`,
+			want:  &Request{Op: "dance", RequestID: "2"},
+		},
+		{
+			name:    "missing op",
+			frame:   `{"payload":{"room":"general"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown payload field",
+			frame:   `{"op":"join_room","payload":{"room":"random","password":"x"}}`,
+			want:    &Request{Op: OpJoinRoom},
+			wantErr: true,
+		},
+		{
+			name:    "wrong payload type",
+			frame:   `{"op":"join_room","request_id":"3","payload":{"room":7}}`,
+			want:    &Request{Op: OpJoinRoom, RequestID: "3"},
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			frame:   `not json`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := v1{}.Decode([]byte(tt.frame))
+			if tt.wantErr {
+				assertInvalid(t, err)
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			// Requests that fail to decode still carry their request ID
+			// when it could be read
+			if !reflect.DeepEqual(req, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", req, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeV1(t *testing.T) {
+	room := models.RoomInfo{ID: "general", Name: "General", Members: 2, Visibility: "public"}
+	text := &models.Message{ID: "m1", Type: models.MessageTypeText, Content: "hi", Sender: "alice", Room: "general", Seq: 7}
+
+	tests := []struct {
+		name    string
+		message *models.Message
+		op      string
+		payload any
+	}{
+		{"message", text, EventMessage, text},
+		{"ack", &models.Message{Type: models.MessageTypeAck, ID: "m1", RequestID: "1", Seq: 8}, EventAck, &Ack{ID: "m1"}},
+		{"error",
+			&models.Message{Type: models.MessageTypeError, RequestID: "2", Seq: 9,
+				Error: &models.ErrorInfo{Code: models.ErrorCodeRateLimited, Message: "Slow down", RetryAfterMs: 500}},
+			EventError, &models.ErrorInfo{Code: models.ErrorCodeRateLimited, Message: "Slow down", RetryAfterMs: 500}},
+		{"session",
+			&models.Message{Type: models.MessageTypeSession, Session: &models.SessionInfo{}},
+			EventSession, &models.SessionInfo{}},
+		{"rooms snapshot",
+			&models.Message{Type: models.MessageTypeRoomsSnapshot, Rooms: []models.RoomInfo{room}, Seq: 1},
+			EventRoomsSnapshot, &RoomsSnapshot{Rooms: []models.RoomInfo{room}}},
+		{"room created",
+			&models.Message{Type: models.MessageTypeRoomCreated, Rooms: []models.RoomInfo{room}, Seq: 2},
+			EventRoomCreated, &room},
+		{"room deleted",
+			&models.Message{Type: models.MessageTypeRoomDeleted, Room: "general", Seq: 3},
+			EventRoomDeleted, &RoomDeleted{ID: "general"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := v1{}.Encode(tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var env Envelope
+			if err := json.Unmarshal(data, &env); err != nil {
+				t.Fatal(err)
+			}
+			if env.Op != tt.op || env.RequestID != tt.message.RequestID || env.Seq != tt.message.Seq {
+				t.Errorf("envelope op %q request_id %q seq %d, want %q %q %d",
+					env.Op, env.RequestID, env.Seq, tt.op, tt.message.RequestID, tt.message.Seq)
+			}
+			want, _ := json.Marshal(tt.payload)
+			if string(env.Payload) != string(want) {
+				t.Errorf("payload %s, want %s", env.Payload, want)
+			}
+		})
+	}
+}
+
+func TestEncodeBatchV1(t *testing.T) {
+	messages := []*models.Message{
+		{ID: "m1", Type: models.MessageTypeText, Content: "one", Seq: 1},
+		{Type: models.MessageTypeAck, ID: "m1", RequestID: "1", Seq: 2},
+	}
+	data, err := v1{}.EncodeBatch(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Op != EventBatch || env.Seq != 0 {
+		t.Errorf("op %q seq %d, want %q without a seq", env.Op, env.Seq, EventBatch)
+	}
+	var inner []Envelope
+	if err := json.Unmarshal(env.Payload, &inner); err != nil {
+		t.Fatal(err)
+	}
+	if len(inner) != 2 || inner[0].Op != EventMessage || inner[0].Seq != 1 || inner[1].Op != EventAck || inner[1].Seq != 2 {
+		t.Errorf("batch = %+v, want the message then the ack, in order", inner)
+	}
+}
+
+func TestForSubprotocol(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		// Clients that don't ask for a subprotocol get the legacy format
+		{"", V0, false},
+		{V0, V0, false},
+		{V1, V1, false},
+		{"chat.v2", "", true},
+		{"CHAT.V1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter, err := ForSubprotocol(tt.name)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", adapter.Subprotocol())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if adapter.Subprotocol() != tt.want {
+				t.Errorf("got %s, want %s", adapter.Subprotocol(), tt.want)
+			}
+		})
+	}
+}
+
+// assertInvalid fails unless err is an invalid_request error
+func assertInvalid(t *testing.T, err error) {
+	t.Helper()
+	var coded *models.CodedError
+	if !errors.As(err, &coded) || coded.Code != models.ErrorCodeInvalidRequest {
+		t.Errorf("error = %v, want %s", err, models.ErrorCodeInvalidRequest)
+	}
+}
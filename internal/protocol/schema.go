@@ -0,0 +1,133 @@
+package protocol
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//go:generate go run ../../cmd/protocol-schema -o ../../docs/protocol/chat.v1.schema.json
+
+// Schema returns a JSON Schema (draft 2020-12) for every v1 frame. Payload
+// definitions are generated from the Go types, so it can't drift from the
+// decoder.
+func Schema() map[string]any {
+	g := &schemaGen{defs: make(map[string]any)}
+	g.defs["ClientFrame"] = g.frames(requests, false)
+	g.defs["ServerFrame"] = g.frames(events, true)
+
+	return map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     V1,
+		"title":   "Chat WebSocket protocol " + V1,
+		"oneOf": []any{
+			map[string]any{"$ref": "#/$defs/ClientFrame"},
+			map[string]any{"$ref": "#/$defs/ServerFrame"},
+		},
+		"$defs": g.defs,
+	}
+}
+
+type schemaGen struct {
+	defs map[string]any
+}
+
+// frames describes one envelope per op, each with its payload type.
+// Sequenced frames also carry seq.
+func (g *schemaGen) frames(ops map[string]func() any, sequenced bool) map[string]any {
+	variants := make([]any, 0, len(ops))
+	for _, op := range sortedKeys(ops) {
+		properties := map[string]any{
+			"op":         map[string]any{"const": op},
+			"request_id": map[string]any{"type": "string"},
+			"payload":    g.schema(reflect.TypeOf(ops[op]())),
+		}
+		if sequenced {
+			properties["seq"] = map[string]any{"type": "integer", "minimum": 1}
+		}
+		variants = append(variants, map[string]any{
+			"title":                op,
+			"type":                 "object",
+			"properties":           properties,
+			"required":             []string{"op", "payload"},
+			"additionalProperties": false,
+		})
+	}
+	return map[string]any{"oneOf": variants}
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		return g.ref(t)
+	}
+	return map[string]any{}
+}
+
+// ref adds a named struct to the definitions and returns a reference to it
+func (g *schemaGen) ref(t reflect.Type) map[string]any {
+	ref := map[string]any{"$ref": "#/$defs/" + t.Name()}
+	if _, ok := g.defs[t.Name()]; ok {
+		return ref
+	}
+	// Reserve the name first so recursive types terminate
+	g.defs[t.Name()] = nil
+
+	properties := make(map[string]any)
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	g.defs[t.Name()] = map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+	return ref
+}
@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// TestSchemaUpToDate fails when the published schema no longer matches the
+// Go types
+func TestSchemaUpToDate(t *testing.T) {
+	want, err := json.MarshalIndent(Schema(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, '\n')
+
+	got, err := os.ReadFile("../../docs/protocol/chat.v1.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Error("docs/protocol/chat.v1.schema.json is out of date; run go generate ./internal/protocol")
+	}
+}
+
+func TestSchemaCoversEveryOp(t *testing.T) {
+	defs := Schema()["$defs"].(map[string]any)
+	for frame, ops := range map[string]map[string]func() any{"ClientFrame": requests, "ServerFrame": events} {
+		titles := map[string]bool{}
+		for _, variant := range defs[frame].(map[string]any)["oneOf"].([]any) {
+			titles[variant.(map[string]any)["title"].(string)] = true
+		}
+		for op := range ops {
+			if !titles[op] {
+				t.Errorf("%s has no variant for %q", frame, op)
+			}
+		}
+		if len(titles) != len(ops) {
+			t.Errorf("%s has %d variants, want %d", frame, len(titles), len(ops))
+		}
+	}
+}
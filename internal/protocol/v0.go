@@ -0,0 +1,42 @@
+package protocol
+
+import (
+	"chatstreamapp/internal/models"
+	"encoding/json"
+)
+
+// v0 is the original format, where clients send models.Message and commands
+// are encoded in its type with the room ID in the content
+type v0 struct{}
+
+func (v0) Subprotocol() string { return V0 }
+
+func (v0) Decode(data []byte) (*Request, error) {
+	var message models.Message
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, invalid("Malformed message")
+	}
+
+	req := &Request{RequestID: message.RequestID}
+	switch message.Type {
+	case models.MessageTypeText:
+		req.Op = OpSendMessage
+		req.Payload = &SendMessage{Room: message.Room, Recipient: message.Recipient, Content: message.Content, Format: message.Format}
+	case models.MessageTypeTyping:
+		req.Op = OpTyping
+		req.Payload = &Typing{Room: message.Room}
+	case "join_room":
+		req.Op = OpJoinRoom
+		req.Payload = &JoinRoom{Room: message.Content}
+	case "leave_room":
+		req.Op = OpLeaveRoom
+		req.Payload = &LeaveRoom{Room: message.Content}
+	default:
+		req.Op = string(message.Type)
+	}
+	return req, nil
+}
+
+func (v0) Encode(message *models.Message) ([]byte, error) {
+	return json.Marshal(message)
+}
@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"chatstreamapp/internal/models"
+	"bytes"
+	"encoding/json"
+)
+
+// v1 wraps every frame in an Envelope
+type v1 struct{}
+
+func (v1) Subprotocol() string { return V1 }
+
+func (v1) Decode(data []byte) (*Request, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, invalid("Malformed envelope")
+	}
+
+	return NewRequest(env.Op, env.RequestID, func(payload any) error {
+		if len(env.Payload) == 0 {
+			return nil
+		}
+		dec := json.NewDecoder(bytes.NewReader(env.Payload))
+		dec.DisallowUnknownFields()
+		return dec.Decode(payload)
+	})
+}
+
+func (v1) Encode(message *models.Message) ([]byte, error) {
+	env, err := envelope(message)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(env)
+}
+
+func (v1) EncodeBatch(messages []*models.Message) ([]byte, error) {
+	envs := make([]Envelope, len(messages))
+	for i, message := range messages {
+		env, err := envelope(message)
+		if err != nil {
+			return nil, err
+		}
+		envs[i] = env
+	}
+
+	data, err := json.Marshal(envs)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{Op: EventBatch, Payload: data})
+}
+
+func envelope(message *models.Message) (Envelope, error) {
+	op, payload := Event(message)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{Op: op, RequestID: message.RequestID, Seq: message.Seq, Payload: data}, nil
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/metrics"
+	"math"
+	"sync"
+	"time"
+)
+
+// Op is a class of operation with its own limit
+type Op string
+
+const (
+	// Any inbound WebSocket frame, limited per connection
+	OpFrames Op = "frames"
+
+	// Chat messages, limited per user
+	OpMessages Op = "messages"
+
+	// Room creation, limited per user or client IP
+	OpRoomCreation Op = "room_creation"
+
+	// Room joins, limited per user
+	OpJoins Op = "joins"
+
+	// Typing indicators, limited per user
+	OpTyping Op = "typing"
+
+	// Messages posted through an incoming webhook, limited per webhook
+	OpIncomingWebhooks Op = "incoming_webhooks"
+)
+
+// Buckets idle for this long are full again and can be forgotten
+const idleTimeout = 10 * time.Minute
+
+var rateLimited = metrics.NewCounterVec("chat_rate_limited_total",
+	"Operations rejected by rate limiting, by operation.", "op")
+
+// bucket is a token bucket refilled continuously at rate tokens per second
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter tracks one token bucket per operation and key
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[Op]map[string]*bucket
+	lastSweep time.Time
+
+	// Returns the limit for an operation; read on every call so config
+	// reloads apply immediately
+	limits func(Op) config.RateLimit
+
+	// Returns the current time; replaced in tests
+	now func() time.Time
+}
+
+// NewLimiter creates a limiter reading its limits from the active config
+func NewLimiter() *Limiter {
+	return &Limiter{
+		buckets:   make(map[Op]map[string]*bucket),
+		lastSweep: time.Now(),
+		limits: func(op Op) config.RateLimit {
+			return config.Get().RateLimit.For(string(op))
+		},
+		now: time.Now,
+	}
+}
+
+// Allow takes a token for op on behalf of key. When the bucket is empty it
+// returns false and how long until a token is available.
+func (l *Limiter) Allow(op Op, key string) (bool, time.Duration) {
+	limit := l.limits(op)
+	if limit.Rate <= 0 {
+		// Unlimited
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	keys, ok := l.buckets[op]
+	if !ok {
+		keys = make(map[string]*bucket)
+		l.buckets[op] = keys
+	}
+
+	burst := float64(max(limit.Burst, 1))
+	b, ok := keys[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		keys[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	rateLimited.WithLabelValues(string(op)).Inc()
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// Forget drops the buckets for key, e.g. when a connection closes
+func (l *Limiter) Forget(op Op, key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.buckets[op], key)
+}
+
+// sweep removes buckets that have been idle long enough to be full again
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for _, keys := range l.buckets {
+		for key, b := range keys {
+			if now.Sub(b.last) > idleTimeout {
+				delete(keys, key)
+			}
+		}
+	}
+}
+
+// Default is the limiter shared by the WebSocket and REST paths
+var Default = NewLimiter()
+
+// Allow takes a token from the default limiter
+func Allow(op Op, key string) (bool, time.Duration) {
+	return Default.Allow(op, key)
+}
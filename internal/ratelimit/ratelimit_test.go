@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"chatstreamapp/internal/config"
+	"testing"
+	"time"
+)
+
+// testLimiter returns a limiter with fixed limits and a clock the test moves
+func testLimiter(limits map[Op]config.RateLimit) (*Limiter, *time.Time) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter()
+	l.lastSweep = now
+	l.limits = func(op Op) config.RateLimit { return limits[op] }
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestAllow(t *testing.T) {
+	l, now := testLimiter(map[Op]config.RateLimit{OpMessages: {Rate: 2, Burst: 3}})
+
+	type step struct {
+		advance    time.Duration
+		key        string
+		ok         bool
+		retryAfter time.Duration
+	}
+	steps := []step{
+		// A full bucket allows a burst
+		{0, "alice", true, 0},
+		{0, "alice", true, 0},
+		{0, "alice", true, 0},
+		{0, "alice", false, 500 * time.Millisecond},
+		// Other keys have their own bucket
+		{0, "bob", true, 0},
+		// Half a token refilled; the other half is 250ms away
+		{250 * time.Millisecond, "alice", false, 250 * time.Millisecond},
+		{250 * time.Millisecond, "alice", true, 0},
+		{0, "alice", false, 500 * time.Millisecond},
+		// Refilling stops at the burst
+		{time.Hour, "alice", true, 0},
+		{0, "alice", true, 0},
+		{0, "alice", true, 0},
+		{0, "alice", false, 500 * time.Millisecond},
+	}
+	for i, s := range steps {
+		*now = now.Add(s.advance)
+		ok, retryAfter := l.Allow(OpMessages, s.key)
+		if ok != s.ok || retryAfter != s.retryAfter {
+			t.Errorf("step %d: Allow(%s) = %v, %v; want %v, %v", i, s.key, ok, retryAfter, s.ok, s.retryAfter)
+		}
+	}
+}
+
+func TestAllowUnlimited(t *testing.T) {
+	l, _ := testLimiter(map[Op]config.RateLimit{
+		OpTyping: {Rate: 0, Burst: 1},
+		OpJoins:  {Rate: -1, Burst: 1},
+	})
+	for _, op := range []Op{OpTyping, OpJoins, OpFrames} {
+		for range 100 {
+			if ok, _ := l.Allow(op, "alice"); !ok {
+				t.Fatalf("Allow(%s) = false with rate %v", op, l.limits(op).Rate)
+			}
+		}
+		if len(l.buckets[op]) != 0 {
+			t.Errorf("unlimited %s kept a bucket", op)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	l, now := testLimiter(map[Op]config.RateLimit{OpMessages: {Rate: 1, Burst: 1}})
+
+	l.Allow(OpMessages, "idle")
+	*now = now.Add(idleTimeout / 2)
+	l.Allow(OpMessages, "active")
+
+	// Sweeping runs at most once a minute, on the next call
+	*now = now.Add(idleTimeout/2 + time.Second)
+	l.Allow(OpMessages, "active")
+	if _, ok := l.buckets[OpMessages]["idle"]; ok {
+		t.Error("bucket idle for longer than idleTimeout wasn't swept")
+	}
+	if _, ok := l.buckets[OpMessages]["active"]; !ok {
+		t.Error("recently used bucket was swept")
+	}
+}
+
+func TestForget(t *testing.T) {
+	l, _ := testLimiter(map[Op]config.RateLimit{OpFrames: {Rate: 1, Burst: 1}})
+
+	l.Allow(OpFrames, "conn-1")
+	if ok, _ := l.Allow(OpFrames, "conn-1"); ok {
+		t.Fatal("Allow() = true with an empty bucket")
+	}
+	l.Forget(OpFrames, "conn-1")
+	if _, ok := l.buckets[OpFrames]["conn-1"]; ok {
+		t.Error("Forget() kept the bucket")
+	}
+	if ok, _ := l.Allow(OpFrames, "conn-1"); !ok {
+		t.Error("Allow() = false after Forget()")
+	}
+
+	// Forgetting an unknown key or op is a no-op
+	l.Forget(OpFrames, "missing")
+	l.Forget(OpTyping, "conn-1")
+}
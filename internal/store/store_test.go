@@ -0,0 +1,66 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSaveAndLoadJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "items.json")
+
+	var missing []string
+	if err := LoadJSON(path, "items", &missing); err != nil || missing != nil {
+		t.Fatalf("LoadJSON(missing file) = %v, %v; want nil, nil", missing, err)
+	}
+
+	want := map[string][]string{"alice": {"bob", "carol"}}
+	if err := SaveJSON(path, "items", want); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string][]string
+	if err := LoadJSON(path, "items", &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %v, want %v", got, want)
+	}
+
+	// Only the file itself is left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want 1", len(entries))
+	}
+}
+
+func TestLoadJSONErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "items.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var v map[string]string
+	err := LoadJSON(path, "items", &v)
+	if err == nil || !strings.HasPrefix(err.Error(), "parse items "+path) {
+		t.Errorf("LoadJSON(invalid) = %v, want a parse error naming the file", err)
+	}
+
+	err = LoadJSON(dir, "items", &v)
+	if err == nil || !strings.HasPrefix(err.Error(), "read items") {
+		t.Errorf("LoadJSON(directory) = %v, want a read error", err)
+	}
+}
+
+func TestSaveJSONMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "items.json")
+	if err := SaveJSON(path, "items", []string{}); err == nil || !strings.HasPrefix(err.Error(), "save items") {
+		t.Errorf("SaveJSON = %v, want a save error", err)
+	}
+}
@@ -0,0 +1,154 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate with the given serial number
+// and its key, dated mtime so reloads can tell the files changed
+func writeCert(t *testing.T, certFile, keyFile string, serial int64, mtime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), mtime)
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), mtime)
+}
+
+func writeFile(t *testing.T, path string, data []byte, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func serial(t *testing.T, r *CertReloader) int64 {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+	writeCert(t, certFile, keyFile, 1, start)
+
+	r, err := NewCertReloader(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := serial(t, r); got != 1 {
+		t.Fatalf("serial = %d, want 1", got)
+	}
+	if r.changed() {
+		t.Error("changed() = true before the files changed")
+	}
+
+	// A renewed certificate is picked up
+	writeCert(t, certFile, keyFile, 2, start.Add(time.Second))
+	if !r.changed() {
+		t.Fatal("changed() = false after the files changed")
+	}
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := serial(t, r); got != 2 {
+		t.Errorf("serial after reload = %d, want 2", got)
+	}
+
+	// A broken key keeps the previous certificate in service
+	writeFile(t, keyFile, []byte("not a key"), start.Add(2*time.Second))
+	if err := r.reload(); err == nil {
+		t.Error("reload() with a broken key succeeded")
+	}
+	if got := serial(t, r); got != 2 {
+		t.Errorf("serial after failed reload = %d, want 2", got)
+	}
+}
+
+func TestCertReloaderClientCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+	writeCert(t, certFile, keyFile, 1, time.Now())
+
+	writeFile(t, caFile, []byte("no certificates here"), time.Now())
+	if _, err := NewCertReloader(certFile, keyFile, caFile); err == nil {
+		t.Fatal("NewCertReloader accepted a client CA file without certificates")
+	}
+
+	ca, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, caFile, ca, time.Now())
+	r, err := NewCertReloader(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ClientCAs() == nil {
+		t.Error("ClientCAs() = nil with a client CA file")
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		httpsAddr string
+		host      string
+		want      string
+	}{
+		{":443", "chat.example.com", "https://chat.example.com/api/rooms?x=1"},
+		{":443", "chat.example.com:80", "https://chat.example.com/api/rooms?x=1"},
+		{":8443", "chat.example.com:8080", "https://chat.example.com:8443/api/rooms?x=1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/rooms?x=1", nil)
+		req.Host = tt.host
+		w := httptest.NewRecorder()
+		RedirectHandler(tt.httpsAddr).ServeHTTP(w, req)
+
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != tt.want {
+			t.Errorf("%s via %s: %d to %q, want 301 to %q", tt.host, tt.httpsAddr, w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"chatstreamapp/internal/config"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	// Finished spans waiting for export; spans beyond this are dropped so
+	// a slow collector never blocks the chat path
+	queueSize = 2048
+
+	// Spans sent per export call
+	batchSize = 256
+
+	// Longest a finished span waits before being exported
+	flushInterval = 2 * time.Second
+
+	// Instrumentation scope recorded on every span
+	scopeName = "chatstreamapp"
+)
+
+// New creates a tracer that samples the given ratio of new traces and
+// exports them in batches
+func New(exporter sdktrace.SpanExporter, sampleRatio float64, opts ...sdktrace.TracerProviderOption) *Tracer {
+	sampler := newRatioSampler(sampleRatio)
+	opts = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithBatcher(exporter,
+			sdktrace.WithMaxQueueSize(queueSize),
+			sdktrace.WithMaxExportBatchSize(batchSize),
+			sdktrace.WithBatchTimeout(flushInterval),
+		),
+	}, opts...)
+	provider := sdktrace.NewTracerProvider(opts...)
+	return &Tracer{
+		provider: provider,
+		tracer:   provider.Tracer(scopeName),
+		sampler:  sampler,
+	}
+}
+
+// FromConfig builds the tracer described by the config, or returns nil when
+// tracing is disabled
+func FromConfig(cfg config.TracingConfig) (*Tracer, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res := resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))
+	return New(exporter, cfg.SampleRatio, sdktrace.WithResource(res)), nil
+}
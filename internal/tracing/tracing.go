@@ -0,0 +1,237 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanKind mirrors the OpenTelemetry span kinds
+type SpanKind = trace.SpanKind
+
+const (
+	SpanKindInternal = trace.SpanKindInternal
+	SpanKindServer   = trace.SpanKindServer
+	SpanKindProducer = trace.SpanKindProducer
+	SpanKindConsumer = trace.SpanKindConsumer
+)
+
+// StatusCode mirrors the OpenTelemetry status codes
+type StatusCode = codes.Code
+
+const (
+	StatusUnset = codes.Unset
+	StatusOK    = codes.Ok
+	StatusError = codes.Error
+)
+
+// Attribute is a key/value pair recorded on a span
+type Attribute = attribute.KeyValue
+
+// Attr creates an attribute, keeping the value's type where OpenTelemetry
+// has one and falling back to its string form otherwise
+func Attr(key string, value any) Attribute {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
+
+// propagator reads and writes W3C traceparent values
+var propagator = propagation.TraceContext{}
+
+// Span records one timed operation. A nil *Span is valid and records nothing,
+// so callers never need to check whether tracing is enabled.
+type Span struct {
+	span trace.Span
+}
+
+// SpanContext returns the span's propagation context
+func (s *Span) SpanContext() trace.SpanContext {
+	if s == nil {
+		return trace.SpanContext{}
+	}
+	return s.span.SpanContext()
+}
+
+// TraceParent returns the span context as a traceparent value
+func (s *Span) TraceParent() string {
+	sc := s.SpanContext()
+	if !sc.IsValid() {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(trace.ContextWithSpanContext(context.Background(), sc), carrier)
+	return carrier.Get("traceparent")
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attrs...)
+}
+
+// AddEvent records a named event at the current time
+func (s *Span) AddEvent(name string, attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.span.AddEvent(name, trace.WithAttributes(attrs...))
+}
+
+// RecordError marks the span as failed
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// SetStatus sets the span status
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.span.SetStatus(code, msg)
+}
+
+// End finishes the span and hands it to the exporter
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// Tracer creates spans and forwards finished ones to a batching exporter
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	sampler  *ratioSampler
+}
+
+// SpanOption adjusts a span at creation time
+type SpanOption = trace.SpanStartOption
+
+// WithKind sets the span kind
+func WithKind(kind SpanKind) SpanOption {
+	return trace.WithSpanKind(kind)
+}
+
+// WithAttributes sets initial attributes
+func WithAttributes(attrs ...Attribute) SpanOption {
+	return trace.WithAttributes(attrs...)
+}
+
+// Start begins a span as a child of the span in ctx, if any, and returns a
+// context carrying the new span. Returns a nil span when tracing is disabled.
+func (t *Tracer) Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	ctx, span := t.tracer.Start(ctx, name, opts...)
+	return ctx, &Span{span: span}
+}
+
+// SetSampleRatio changes the probability of sampling new root traces
+func (t *Tracer) SetSampleRatio(ratio float64) {
+	if t == nil {
+		return
+	}
+	t.sampler.set(ratio)
+}
+
+// ForceFlush exports every finished span still buffered
+func (t *Tracer) ForceFlush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.provider.ForceFlush(ctx)
+}
+
+// Shutdown flushes pending spans and stops the exporter
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
+
+// ratioSampler samples new root traces by trace ID at a ratio that can change
+// at runtime, and follows the parent's decision for everything else so a
+// trace is either kept whole or dropped whole
+type ratioSampler struct {
+	current atomic.Pointer[sdktrace.Sampler]
+}
+
+func newRatioSampler(ratio float64) *ratioSampler {
+	s := &ratioSampler{}
+	s.set(ratio)
+	return s
+}
+
+func (s *ratioSampler) set(ratio float64) {
+	sampler := sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+	s.current.Store(&sampler)
+}
+
+// ShouldSample implements sdktrace.Sampler
+func (s *ratioSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	return (*s.current.Load()).ShouldSample(p)
+}
+
+// Description implements sdktrace.Sampler
+func (s *ratioSampler) Description() string {
+	return (*s.current.Load()).Description()
+}
+
+// SpanFromContext returns the local span in ctx, or nil. A remote parent set
+// by ContextWithRemoteParent isn't a span of this process and returns nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span := trace.SpanFromContext(ctx)
+	if sc := span.SpanContext(); !sc.IsValid() || sc.IsRemote() {
+		return nil
+	}
+	return &Span{span: span}
+}
+
+// ContextWithRemoteParent returns a context whose next span continues the
+// trace described by a traceparent value. Invalid values are ignored.
+func ContextWithRemoteParent(ctx context.Context, traceParent string) context.Context {
+	traceParent = strings.TrimSpace(traceParent)
+	if traceParent == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+}
+
+var global atomic.Pointer[Tracer]
+
+// SetTracer installs the process-wide tracer. A nil tracer disables tracing.
+func SetTracer(t *Tracer) {
+	global.Store(t)
+}
+
+// Start begins a span on the process-wide tracer
+func Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	return global.Load().Start(ctx, name, opts...)
+}
@@ -0,0 +1,245 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	callerTrace = "4bf92f3577b34da6a3ce929d0e0e4736"
+	callerSpan  = "00f067aa0ba902b7"
+)
+
+// testTracer returns a tracer exporting to memory, shut down with the test
+func testTracer(t *testing.T, ratio float64) (*Tracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := New(exporter, ratio)
+	t.Cleanup(func() { tracer.Shutdown(context.Background()) })
+	return tracer, exporter
+}
+
+// exported flushes the tracer and returns the names of the spans exported
+func exported(t *testing.T, tracer *Tracer, exporter *tracetest.InMemoryExporter) []string {
+	t.Helper()
+	if err := tracer.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+	}
+	return names
+}
+
+func TestTraceParent(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceParent string
+		continues   bool
+		sampled     bool
+	}{
+		{"sampled caller", "00-" + callerTrace + "-" + callerSpan + "-01", true, true},
+		{"unsampled caller", "00-" + callerTrace + "-" + callerSpan + "-00", true, false},
+		{"surrounding whitespace", " 00-" + callerTrace + "-" + callerSpan + "-01 ", true, true},
+		{"empty", "", false, true},
+		{"garbage", "not-a-traceparent", false, true},
+		{"short trace id", "00-4bf92f35-" + callerSpan + "-01", false, true},
+		{"non-hex span id", "00-" + callerTrace + "-zzzzzzzzzzzzzzzz-01", false, true},
+		{"zero trace id", "00-00000000000000000000000000000000-" + callerSpan + "-01", false, true},
+		{"zero span id", "00-" + callerTrace + "-0000000000000000-01", false, true},
+		{"forbidden version", "ff-" + callerTrace + "-" + callerSpan + "-01", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer, _ := testTracer(t, 1)
+
+			ctx := ContextWithRemoteParent(context.Background(), tt.traceParent)
+			if SpanFromContext(ctx) != nil {
+				t.Error("remote parent returned as a local span")
+			}
+			_, span := tracer.Start(ctx, "child")
+			defer span.End()
+
+			sc := span.SpanContext()
+			if got := sc.TraceID().String() == callerTrace; got != tt.continues {
+				t.Errorf("trace %s continues the caller's = %v, want %v", sc.TraceID(), got, tt.continues)
+			}
+			if sc.IsSampled() != tt.sampled {
+				t.Errorf("sampled = %v, want %v", sc.IsSampled(), tt.sampled)
+			}
+
+			flags := "-00"
+			if tt.sampled {
+				flags = "-01"
+			}
+			want := "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + flags
+			if got := span.TraceParent(); got != want {
+				t.Errorf("TraceParent() = %q, want %q", got, want)
+			}
+
+			// The value round-trips into the next hop
+			_, next := tracer.Start(ContextWithRemoteParent(context.Background(), span.TraceParent()), "next")
+			defer next.End()
+			if next.SpanContext().TraceID() != sc.TraceID() {
+				t.Errorf("next hop in trace %s, want %s", next.SpanContext().TraceID(), sc.TraceID())
+			}
+		})
+	}
+}
+
+func TestChildSpans(t *testing.T) {
+	tracer, exporter := testTracer(t, 1)
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	if SpanFromContext(ctx) == nil {
+		t.Fatal("SpanFromContext = nil, want the started span")
+	}
+	_, child := tracer.Start(ctx, "child", WithKind(SpanKindProducer), WithAttributes(Attr("batch.size", 2)))
+	child.End()
+	parent.End()
+
+	if err := tracer.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	got, want := spans[0], spans[1]
+	if got.Name != "child" {
+		got, want = want, got
+	}
+	if got.Parent.SpanID() != want.SpanContext.SpanID() {
+		t.Errorf("child parent = %s, want %s", got.Parent.SpanID(), want.SpanContext.SpanID())
+	}
+	if got.SpanContext.TraceID() != want.SpanContext.TraceID() {
+		t.Error("child started a new trace")
+	}
+	if got.SpanKind != SpanKindProducer {
+		t.Errorf("child kind = %v, want producer", got.SpanKind)
+	}
+	if len(got.Attributes) != 1 || got.Attributes[0] != Attr("batch.size", 2) {
+		t.Errorf("child attributes = %v", got.Attributes)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	sampledCaller := "00-" + callerTrace + "-" + callerSpan + "-01"
+	unsampledCaller := "00-" + callerTrace + "-" + callerSpan + "-00"
+
+	tests := []struct {
+		name        string
+		ratio       float64
+		reloadTo    float64
+		traceParent string
+		want        bool
+	}{
+		{"new trace at ratio 1", 1, 1, "", true},
+		{"new trace at ratio 0", 0, 0, "", false},
+		{"reloaded to 0", 1, 0, "", false},
+		{"reloaded to 1", 0, 1, "", true},
+		// A trace is kept or dropped whole, whatever this process's ratio
+		{"sampled caller at ratio 0", 0, 0, sampledCaller, true},
+		{"unsampled caller at ratio 1", 1, 1, unsampledCaller, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer, exporter := testTracer(t, tt.ratio)
+			tracer.SetSampleRatio(tt.reloadTo)
+
+			ctx := ContextWithRemoteParent(context.Background(), tt.traceParent)
+			ctx, root := tracer.Start(ctx, "root")
+			_, child := tracer.Start(ctx, "child")
+			child.End()
+			root.End()
+
+			if root.SpanContext().IsSampled() != tt.want || child.SpanContext().IsSampled() != tt.want {
+				t.Errorf("sampled = %v/%v, want %v",
+					root.SpanContext().IsSampled(), child.SpanContext().IsSampled(), tt.want)
+			}
+			names := exported(t, tracer, exporter)
+			if tt.want && len(names) != 2 || !tt.want && len(names) != 0 {
+				t.Errorf("exported %v", names)
+			}
+			// Unsampled spans still propagate so the decision reaches the
+			// next hop
+			if !strings.HasPrefix(root.TraceParent(), "00-") {
+				t.Errorf("TraceParent() = %q", root.TraceParent())
+			}
+		})
+	}
+}
+
+// blockingExporter holds every export until released
+type blockingExporter struct {
+	release chan struct{}
+
+	mu    sync.Mutex
+	spans int
+}
+
+func (e *blockingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	select {
+	case <-e.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans += len(spans)
+	return nil
+}
+
+func (e *blockingExporter) Shutdown(context.Context) error { return nil }
+
+func TestFullQueueDropsSpans(t *testing.T) {
+	exporter := &blockingExporter{release: make(chan struct{})}
+	tracer := New(exporter, 1)
+
+	// With the exporter stuck, ending spans past the queue and the batch in
+	// flight must drop them rather than block the caller
+	const total = queueSize + 2*batchSize
+	for range total {
+		_, span := tracer.Start(context.Background(), "span")
+		span.End()
+	}
+
+	close(exporter.release)
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if exporter.spans == 0 || exporter.spans >= total {
+		t.Errorf("exported %d of %d spans, want some dropped", exporter.spans, total)
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+
+	ctx, span := tracer.Start(context.Background(), "ignored")
+	if span != nil {
+		t.Fatal("nil tracer started a span")
+	}
+	if SpanFromContext(ctx) != nil {
+		t.Error("nil tracer put a span in the context")
+	}
+
+	// Every method is a no-op on a nil span and tracer
+	span.SetAttributes(Attr("key", "value"))
+	span.AddEvent("event")
+	span.SetStatus(StatusError, "failed")
+	span.End()
+	if span.TraceParent() != "" {
+		t.Errorf("TraceParent() = %q, want empty", span.TraceParent())
+	}
+	tracer.SetSampleRatio(0.5)
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
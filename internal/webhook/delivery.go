@@ -0,0 +1,311 @@
+package webhook
+
+import (
+	"bytes"
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/metrics"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Chat-Event"
+	HeaderDelivery  = "X-Chat-Delivery"
+	HeaderTimestamp = "X-Chat-Timestamp"
+
+	// "sha256=" followed by the hex HMAC-SHA256 of the timestamp, a dot and
+	// the body, keyed with the webhook's secret
+	HeaderSignature = "X-Chat-Signature"
+)
+
+// Delivery is one event on its way to one webhook. Retries reuse its ID, so
+// receivers can drop duplicates.
+type Delivery struct {
+	ID       string `json:"id"`
+	HookID   string `json:"hook_id"`
+	Event    *Event `json:"event"`
+	Attempts int    `json:"attempts"`
+
+	LastError string `json:"last_error,omitempty"`
+
+	// When it was moved to the dead-letter list
+	FailedAt time.Time `json:"failed_at,omitempty"`
+}
+
+// Attempt is one entry in a webhook's delivery log
+type Attempt struct {
+	DeliveryID string    `json:"delivery_id"`
+	EventID    string    `json:"event_id"`
+	EventType  string    `json:"event_type"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	At         time.Time `json:"at"`
+}
+
+// Sign returns the hex HMAC-SHA256 a delivery is signed with
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature, the X-Chat-Signature header of a
+// delivery, matches its timestamp and body. Receivers should also reject
+// timestamps too far in the past.
+func Verify(secret, signature, timestamp string, body []byte) bool {
+	expected := "sha256=" + Sign(secret, timestamp, body)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// Publish queues an event for every webhook subscribed to it. It never
+// blocks: when the queue is full, deliveries go straight to the dead-letter
+// list.
+func (d *Dispatcher) Publish(event *Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, hook := range d.hooks {
+		if hook.matches(event) {
+			d.enqueue(&Delivery{
+				ID:     uuid.New().String(),
+				HookID: hook.ID,
+				Event:  event,
+			})
+		}
+	}
+}
+
+// Run delivers queued events until stop is closed
+func (d *Dispatcher) Run(stop <-chan struct{}) {
+	cfg := config.Get().Webhooks
+	queue := make(chan *Delivery, cfg.QueueSize)
+	d.mu.Lock()
+	d.queue = queue
+	d.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for range cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				case delivery := <-queue:
+					d.attempt(delivery)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// attempt sends a delivery once, scheduling a retry or dead-lettering it
+// when that fails
+func (d *Dispatcher) attempt(delivery *Delivery) {
+	d.mu.Lock()
+	hook := d.find(delivery.HookID)
+	var target Hook
+	if hook != nil {
+		target = *hook
+	}
+	d.mu.Unlock()
+	if hook == nil {
+		// Removed while the delivery was queued
+		return
+	}
+
+	cfg := config.Get().Webhooks
+	delivery.Attempts++
+	start := time.Now()
+	status, err := d.post(target, delivery, cfg.Timeout.Duration())
+
+	entry := Attempt{
+		DeliveryID: delivery.ID,
+		EventID:    delivery.Event.ID,
+		EventType:  delivery.Event.Type,
+		Attempt:    delivery.Attempts,
+		StatusCode: status,
+		DurationMs: time.Since(start).Milliseconds(),
+		At:         start,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log(target.ID, entry, cfg.LogSize)
+
+	if err == nil {
+		metrics.WebhookDeliveries.WithLabelValues("success").Inc()
+		return
+	}
+	metrics.WebhookDeliveries.WithLabelValues("failure").Inc()
+	delivery.LastError = err.Error()
+	log := logger.With("webhook_id", target.ID, "delivery_id", delivery.ID, "attempt", delivery.Attempts)
+
+	if delivery.Attempts >= cfg.MaxAttempts {
+		log.Warning("webhook delivery failed, moving to dead letters", "error", err)
+		d.deadLetter(delivery)
+		return
+	}
+	wait := backoff(delivery.Attempts, cfg)
+	log.Info("webhook delivery failed, retrying", "error", err, "retry_in", wait.String())
+	d.afterFunc(wait, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.find(delivery.HookID) != nil {
+			d.enqueue(delivery)
+		}
+	})
+}
+
+// post sends a delivery to its webhook, returning the response status
+func (d *Dispatcher) post(hook Hook, delivery *Delivery, timeout time.Duration) (int, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "chatstream-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event.Type)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(hook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns how long to wait before retrying after the given number of
+// failed attempts
+func backoff(attempts int, cfg config.WebhooksConfig) time.Duration {
+	wait := cfg.InitialBackoff.Duration()
+	for i := 1; i < attempts && wait < cfg.MaxBackoff.Duration(); i++ {
+		wait *= 2
+	}
+	return min(wait, cfg.MaxBackoff.Duration())
+}
+
+// enqueue queues a delivery without blocking, dead-lettering it when the
+// queue is full or not running. d.mu must be held.
+func (d *Dispatcher) enqueue(delivery *Delivery) {
+	select {
+	case d.queue <- delivery:
+	default:
+		delivery.LastError = "delivery queue full"
+		logger.Warning("webhook queue full, moving delivery to dead letters", "webhook_id", delivery.HookID, "delivery_id", delivery.ID)
+		d.deadLetter(delivery)
+	}
+}
+
+// deadLetter keeps a copy of a failed delivery, dropping the oldest beyond
+// the configured limit. d.mu must be held.
+func (d *Dispatcher) deadLetter(delivery *Delivery) {
+	metrics.WebhookDeliveries.WithLabelValues("dead_letter").Inc()
+	copied := *delivery
+	copied.FailedAt = time.Now()
+	d.dead = append(d.dead, &copied)
+	if limit := config.Get().Webhooks.MaxDeadLetters; len(d.dead) > limit {
+		d.dead = slices.Delete(d.dead, 0, len(d.dead)-limit)
+	}
+}
+
+// log appends an attempt to a webhook's delivery log, keeping the newest
+// size entries. d.mu must be held.
+func (d *Dispatcher) log(hookID string, entry Attempt, size int) {
+	if d.find(hookID) == nil {
+		return
+	}
+	entries := append(d.logs[hookID], entry)
+	if len(entries) > size {
+		entries = slices.Delete(entries, 0, len(entries)-size)
+	}
+	d.logs[hookID] = entries
+}
+
+// Deliveries returns a webhook's recent delivery attempts, newest first,
+// and false if there is no such webhook
+func (d *Dispatcher) Deliveries(hookID string) ([]Attempt, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.find(hookID) == nil {
+		return nil, false
+	}
+	entries := slices.Clone(d.logs[hookID])
+	slices.Reverse(entries)
+	if entries == nil {
+		entries = []Attempt{}
+	}
+	return entries, true
+}
+
+// DeadLetters returns the deliveries that ran out of attempts, newest first
+func (d *Dispatcher) DeadLetters() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	list := make([]Delivery, 0, len(d.dead))
+	for i := len(d.dead) - 1; i >= 0; i-- {
+		list = append(list, *d.dead[i])
+	}
+	return list
+}
+
+// Retry takes a dead letter off the list and queues it again with a fresh
+// set of attempts, reporting false if there was none or its webhook is gone
+func (d *Dispatcher) Retry(deliveryID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := slices.IndexFunc(d.dead, func(delivery *Delivery) bool { return delivery.ID == deliveryID })
+	if i < 0 || d.find(d.dead[i].HookID) == nil {
+		return false
+	}
+	delivery := d.dead[i]
+	d.dead = slices.Delete(d.dead, i, i+1)
+	delivery.Attempts = 0
+	delivery.LastError = ""
+	delivery.FailedAt = time.Time{}
+	d.enqueue(delivery)
+	return true
+}
@@ -0,0 +1,241 @@
+package webhook
+
+import (
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testDispatcher delivers to an httptest server without workers or real
+// timers: deliver runs queued deliveries and their retries until none are
+// left, recording the backoff of each retry
+type testDispatcher struct {
+	*Dispatcher
+	waits   []time.Duration
+	retries []func()
+}
+
+func newTestDispatcher(t *testing.T, handler http.HandlerFunc) (*testDispatcher, *Hook) {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Webhooks.MaxAttempts = 4
+	cfg.Webhooks.InitialBackoff = config.Duration(time.Second)
+	cfg.Webhooks.MaxBackoff = config.Duration(3 * time.Second)
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	td := &testDispatcher{}
+	td.Dispatcher = &Dispatcher{
+		logs:   make(map[string][]Attempt),
+		client: server.Client(),
+		queue:  make(chan *Delivery, 10),
+		afterFunc: func(wait time.Duration, f func()) *time.Timer {
+			td.waits = append(td.waits, wait)
+			td.retries = append(td.retries, f)
+			return nil
+		},
+	}
+	hook, err := td.Add(Hook{URL: server.URL, Secret: "test-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return td, hook
+}
+
+func (td *testDispatcher) deliver() {
+	for {
+		select {
+		case delivery := <-td.queue:
+			td.attempt(delivery)
+		default:
+			if len(td.retries) == 0 {
+				return
+			}
+			retry := td.retries[0]
+			td.retries = td.retries[1:]
+			retry()
+		}
+	}
+}
+
+func testEvent() *Event {
+	return MessageEvent(&models.Message{ID: "m1", Type: models.MessageTypeText, Content: "hi", Room: "general"})
+}
+
+func TestDeliverySignature(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []*http.Request
+		bodies   [][]byte
+	)
+	td, hook := newTestDispatcher(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		mu.Unlock()
+	})
+
+	event := testEvent()
+	td.Publish(event)
+	td.deliver()
+
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	r, body := requests[0], bodies[0]
+	signature := r.Header.Get(HeaderSignature)
+	timestamp := r.Header.Get(HeaderTimestamp)
+	if !Verify(hook.Secret, signature, timestamp, body) {
+		t.Errorf("signature %q doesn't verify with the webhook's secret", signature)
+	}
+	if Verify("other-secret", signature, timestamp, body) {
+		t.Error("signature verifies with another secret")
+	}
+	if Verify(hook.Secret, signature, timestamp+"1", body) {
+		t.Error("signature verifies with another timestamp")
+	}
+	if got := r.Header.Get(HeaderEvent); got != MessagePosted {
+		t.Errorf("%s = %q, want %q", HeaderEvent, got, MessagePosted)
+	}
+	if r.Header.Get(HeaderDelivery) == "" {
+		t.Errorf("missing %s", HeaderDelivery)
+	}
+
+	entries, _ := td.Deliveries(hook.ID)
+	if len(entries) != 1 || entries[0].StatusCode != http.StatusOK || entries[0].EventID != event.ID {
+		t.Errorf("delivery log = %+v, want one 200 for event %s", entries, event.ID)
+	}
+	if dead := td.DeadLetters(); len(dead) != 0 {
+		t.Errorf("dead letters = %+v, want none", dead)
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		deliveryIDs []string
+	)
+	td, hook := newTestDispatcher(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		deliveryIDs = append(deliveryIDs, r.Header.Get(HeaderDelivery))
+		if len(deliveryIDs) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	td.Publish(testEvent())
+	td.deliver()
+
+	if len(deliveryIDs) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(deliveryIDs))
+	}
+	if deliveryIDs[0] != deliveryIDs[1] || deliveryIDs[1] != deliveryIDs[2] {
+		t.Errorf("retries changed the delivery ID: %v", deliveryIDs)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second}; !slices.Equal(td.waits, want) {
+		t.Errorf("backoff = %v, want %v", td.waits, want)
+	}
+
+	entries, _ := td.Deliveries(hook.ID)
+	var statuses []int
+	for _, entry := range entries {
+		statuses = append(statuses, entry.StatusCode)
+	}
+	if want := []int{200, 500, 500}; !slices.Equal(statuses, want) {
+		t.Errorf("logged statuses = %v, want %v", statuses, want)
+	}
+	if dead := td.DeadLetters(); len(dead) != 0 {
+		t.Errorf("dead letters = %+v, want none", dead)
+	}
+}
+
+func TestDeliveryDeadLetter(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+	td, hook := newTestDispatcher(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	event := testEvent()
+	td.Publish(event)
+	td.deliver()
+
+	if attempts != 4 {
+		t.Fatalf("got %d attempts, want max_attempts 4", attempts)
+	}
+	// Doubling from initial_backoff, capped at max_backoff
+	if want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}; !slices.Equal(td.waits, want) {
+		t.Errorf("backoff = %v, want %v", td.waits, want)
+	}
+
+	dead := td.DeadLetters()
+	if len(dead) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(dead))
+	}
+	if d := dead[0]; d.HookID != hook.ID || d.Event.ID != event.ID || d.Attempts != 4 ||
+		d.LastError != "endpoint responded 500 Internal Server Error" || d.FailedAt.IsZero() {
+		t.Errorf("dead letter = %+v", d)
+	}
+
+	entries, _ := td.Deliveries(hook.ID)
+	if len(entries) != 4 {
+		t.Fatalf("got %d log entries, want 4", len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Attempt != 4-i || entry.StatusCode != http.StatusInternalServerError || entry.Error == "" {
+			t.Errorf("log entry %d = %+v", i, entry)
+		}
+	}
+
+	// A retried dead letter starts over with fresh attempts
+	if !td.Retry(dead[0].ID) {
+		t.Fatal("Retry = false")
+	}
+	if len(td.DeadLetters()) != 0 {
+		t.Error("retried delivery still on the dead-letter list")
+	}
+	td.deliver()
+	if attempts != 8 || len(td.DeadLetters()) != 1 {
+		t.Errorf("after retry: %d attempts and %d dead letters, want 8 and 1", attempts, len(td.DeadLetters()))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cfg := config.WebhooksConfig{
+		InitialBackoff: config.Duration(time.Second),
+		MaxBackoff:     config.Duration(10 * time.Second),
+	}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts, cfg); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
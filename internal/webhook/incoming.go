@@ -0,0 +1,209 @@
+package webhook
+
+import (
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/store"
+	"crypto/subtle"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Limits on what an incoming webhook may post
+const (
+	MaxUsernameLength = 80
+	MaxAttachments    = 10
+	MaxFields         = 20
+)
+
+// Incoming is a URL that posts messages into one room on behalf of an
+// integration, such as CI reporting build results
+type Incoming struct {
+	ID   string `json:"id"`
+	Room string `json:"room"`
+
+	// Shown as the sender unless a post overrides it
+	Name string `json:"name"`
+
+	// Secret part of the webhook's URL. Only shown when the webhook is
+	// created.
+	Token string `json:"token,omitempty"`
+
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Redacted returns the webhook without its token
+func (in Incoming) Redacted() Incoming {
+	in.Token = ""
+	return in
+}
+
+// SenderID is the ID its messages are sent under, so they can be told apart
+// from users' and muted or banned like them
+func (in Incoming) SenderID() string {
+	return "webhook:" + in.ID
+}
+
+// Post is the body an incoming webhook accepts
+type Post struct {
+	Text string `json:"text"`
+
+	// Sender name for this message only
+	Username string `json:"username"`
+
+	Attachments []models.Attachment `json:"attachments"`
+}
+
+// colorPattern matches the colors an attachment may use
+var colorPattern = regexp.MustCompile(`^(good|warning|danger|#[0-9a-fA-F]{6})$`)
+
+// Message validates a post and builds the room message it sends
+func (in Incoming) Message(post Post) (*models.Message, error) {
+	if strings.TrimSpace(post.Text) == "" && len(post.Attachments) == 0 {
+		return nil, invalid("text or attachments is required")
+	}
+	if utf8.RuneCountInString(post.Username) > MaxUsernameLength {
+		return nil, invalid("username must be at most %d characters", MaxUsernameLength)
+	}
+	if len(post.Attachments) > MaxAttachments {
+		return nil, invalid("at most %d attachments are allowed", MaxAttachments)
+	}
+	for i, attachment := range post.Attachments {
+		if attachment.Color != "" && !colorPattern.MatchString(attachment.Color) {
+			return nil, invalid("attachments[%d].color must be good, warning, danger or #rrggbb", i)
+		}
+		if attachment.TitleLink != "" {
+			link, err := url.Parse(attachment.TitleLink)
+			if err != nil || (link.Scheme != "http" && link.Scheme != "https") {
+				return nil, invalid("attachments[%d].title_link must be an http or https URL", i)
+			}
+		}
+		if len(attachment.Fields) > MaxFields {
+			return nil, invalid("attachments[%d] may have at most %d fields", i, MaxFields)
+		}
+	}
+
+	sender := in.Name
+	if name := strings.TrimSpace(post.Username); name != "" {
+		sender = name
+	}
+	return &models.Message{
+		ID:          uuid.New().String(),
+		Type:        models.MessageTypeText,
+		Content:     post.Text,
+		Sender:      sender,
+		SenderID:    in.SenderID(),
+		Room:        in.Room,
+		Timestamp:   time.Now(),
+		Attachments: post.Attachments,
+		Bot:         true,
+	}, nil
+}
+
+// IncomingStore holds the incoming webhooks. Changes are saved to a file
+// when one is set, so they survive restarts.
+type IncomingStore struct {
+	mu    sync.Mutex
+	path  string
+	hooks []*Incoming
+}
+
+// Inbound is the server's incoming webhook store
+var Inbound = &IncomingStore{}
+
+// Load reads the incoming webhooks saved at path, which later changes are
+// saved to. A missing file is an empty store.
+func (s *IncomingStore) Load(path string) error {
+	var hooks []*Incoming
+	if err := store.LoadJSON(path, "incoming webhooks", &hooks); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	s.hooks = hooks
+	return nil
+}
+
+// Add creates an incoming webhook for a room, filling in its ID, token and
+// creation time
+func (s *IncomingStore) Add(in Incoming) (*Incoming, error) {
+	if in.Room == "" {
+		return nil, invalid("room is required")
+	}
+	if in.Name == "" {
+		return nil, invalid("name is required")
+	}
+	if utf8.RuneCountInString(in.Name) > MaxUsernameLength {
+		return nil, invalid("name must be at most %d characters", MaxUsernameLength)
+	}
+	in.ID = uuid.New().String()
+	in.Token = newSecret()
+	in.CreatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, &in)
+	copied := in
+	return &copied, s.save()
+}
+
+// Remove deletes an incoming webhook, reporting false if there was none
+func (s *IncomingStore) Remove(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, in := range s.hooks {
+		if in.ID == id {
+			s.hooks = append(s.hooks[:i], s.hooks[i+1:]...)
+			return true, s.save()
+		}
+	}
+	return false, nil
+}
+
+// List returns the incoming webhooks, oldest first, without their tokens
+func (s *IncomingStore) List() []Incoming {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Incoming, len(s.hooks))
+	for i, in := range s.hooks {
+		list[i] = in.Redacted()
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Authenticate returns the incoming webhook with the given ID and token
+func (s *IncomingStore) Authenticate(id, token string) (Incoming, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, in := range s.hooks {
+		if in.ID == id && subtle.ConstantTimeCompare([]byte(in.Token), []byte(token)) == 1 {
+			return *in, true
+		}
+	}
+	return Incoming{}, false
+}
+
+// save writes the incoming webhooks to the file, replacing it atomically
+func (s *IncomingStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	hooks := s.hooks
+	if hooks == nil {
+		hooks = []*Incoming{}
+	}
+	return store.SaveJSON(s.path, "incoming webhooks", hooks)
+}
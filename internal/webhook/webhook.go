@@ -0,0 +1,261 @@
+package webhook
+
+import (
+	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/store"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types webhooks can subscribe to
+const (
+	MessagePosted = "message.posted"
+	UserJoined    = "user.joined"
+	UserLeft      = "user.left"
+	RoomCreated   = "room.created"
+)
+
+// EventTypes are the event types a webhook can subscribe to
+var EventTypes = []string{MessagePosted, UserJoined, UserLeft, RoomCreated}
+
+// Event is the JSON body posted to webhook endpoints
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Room      string    `json:"room"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// The message posted, for message.posted
+	Message *models.Message `json:"message,omitempty"`
+
+	// Who joined or left, for user.joined and user.left
+	User *EventUser `json:"user,omitempty"`
+
+	// The new room's name, for room.created
+	RoomName string `json:"room_name,omitempty"`
+}
+
+// EventUser identifies the user an event is about
+type EventUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// MessageEvent builds the message.posted event for a room message
+func MessageEvent(message *models.Message) *Event {
+	event := newEvent(MessagePosted, message.Room)
+	event.Message = message
+	return event
+}
+
+// UserEvent builds a user.joined or user.left event
+func UserEvent(eventType, roomID string, user *models.User) *Event {
+	event := newEvent(eventType, roomID)
+	event.User = &EventUser{ID: user.ID, Username: user.Username}
+	return event
+}
+
+// RoomEvent builds the room.created event for a room
+func RoomEvent(room *models.Room) *Event {
+	event := newEvent(RoomCreated, room.ID)
+	event.RoomName = room.Name
+	return event
+}
+
+func newEvent(eventType, roomID string) *Event {
+	return &Event{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		Room:      roomID,
+		Timestamp: time.Now(),
+	}
+}
+
+// Hook is an endpoint registered to receive events
+type Hook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+
+	// Key the payloads are signed with. Only shown when the webhook is
+	// created.
+	Secret string `json:"secret,omitempty"`
+
+	// Room IDs whose events are sent; empty sends every room's
+	Rooms []string `json:"rooms,omitempty"`
+
+	// Event types sent; empty sends every type
+	Events []string `json:"events,omitempty"`
+
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Redacted returns the webhook without its secret
+func (h Hook) Redacted() Hook {
+	h.Secret = ""
+	return h
+}
+
+// matches reports whether the webhook subscribes to an event
+func (h *Hook) matches(event *Event) bool {
+	if len(h.Rooms) > 0 && !slices.Contains(h.Rooms, event.Room) {
+		return false
+	}
+	return len(h.Events) == 0 || slices.Contains(h.Events, event.Type)
+}
+
+// Dispatcher holds the registered webhooks and delivers events to them.
+// Webhooks are saved to a file when one is set, so they survive restarts;
+// delivery logs and dead letters are kept in memory.
+type Dispatcher struct {
+	mu    sync.Mutex
+	path  string
+	hooks []*Hook
+
+	// Deliveries waiting for a worker; nil until Run starts
+	queue chan *Delivery
+
+	// Recent attempts by webhook ID, oldest first
+	logs map[string][]Attempt
+
+	// Deliveries that ran out of attempts, oldest first
+	dead []*Delivery
+
+	client *http.Client
+
+	// Schedules retries; replaced in tests to skip the backoff
+	afterFunc func(wait time.Duration, f func()) *time.Timer
+}
+
+// Hooks is the server's webhook dispatcher
+var Hooks = &Dispatcher{
+	logs:      make(map[string][]Attempt),
+	client:    &http.Client{},
+	afterFunc: time.AfterFunc,
+}
+
+// Load reads the webhooks saved at path, which later changes are saved to.
+// A missing file is an empty list.
+func (d *Dispatcher) Load(path string) error {
+	var hooks []*Hook
+	if err := store.LoadJSON(path, "webhooks", &hooks); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.path = path
+	d.hooks = hooks
+	return nil
+}
+
+// Add registers a webhook, filling in its ID, creation time and, when none
+// is given, a random secret
+func (d *Dispatcher) Add(hook Hook) (*Hook, error) {
+	target, err := url.Parse(hook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, invalid("url must be an absolute http or https URL")
+	}
+	for _, eventType := range hook.Events {
+		if !slices.Contains(EventTypes, eventType) {
+			return nil, invalid("events must be among %s", strings.Join(EventTypes, ", "))
+		}
+	}
+	if hook.Secret == "" {
+		hook.Secret = newSecret()
+	}
+	hook.ID = uuid.New().String()
+	hook.CreatedAt = time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hooks = append(d.hooks, &hook)
+	copied := hook
+	return &copied, d.save()
+}
+
+// Remove unregisters a webhook and drops its delivery log, reporting false
+// if there was none. Deliveries already queued for it are discarded.
+func (d *Dispatcher) Remove(id string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, hook := range d.hooks {
+		if hook.ID == id {
+			d.hooks = append(d.hooks[:i], d.hooks[i+1:]...)
+			delete(d.logs, id)
+			return true, d.save()
+		}
+	}
+	return false, nil
+}
+
+// List returns the registered webhooks, oldest first, without their secrets
+func (d *Dispatcher) List() []Hook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	list := make([]Hook, len(d.hooks))
+	for i, hook := range d.hooks {
+		list[i] = hook.Redacted()
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Get returns a webhook, secret included
+func (d *Dispatcher) Get(id string) (Hook, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hook := d.find(id)
+	if hook == nil {
+		return Hook{}, false
+	}
+	return *hook, true
+}
+
+// find returns a registered webhook, or nil. d.mu must be held.
+func (d *Dispatcher) find(id string) *Hook {
+	for _, hook := range d.hooks {
+		if hook.ID == id {
+			return hook
+		}
+	}
+	return nil
+}
+
+// save writes the webhooks to the file, replacing it atomically
+func (d *Dispatcher) save() error {
+	if d.path == "" {
+		return nil
+	}
+	hooks := d.hooks
+	if hooks == nil {
+		hooks = []*Hook{}
+	}
+	return store.SaveJSON(d.path, "webhooks", hooks)
+}
+
+// newSecret returns a random signing secret
+func newSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func invalid(format string, args ...any) error {
+	return &models.CodedError{Code: models.ErrorCodeInvalidRequest, Message: fmt.Sprintf(format, args...)}
+}
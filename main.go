@@ -1,11 +1,29 @@
 package main
 
 import (
+	"chatstreamapp/internal/announce"
 	"chatstreamapp/internal/api"
+	"chatstreamapp/internal/audit"
+	"chatstreamapp/internal/bot"
+	"chatstreamapp/internal/config"
+	"chatstreamapp/internal/health"
 	"chatstreamapp/internal/hub"
 	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/moderation"
+	"chatstreamapp/internal/privacy"
+	"chatstreamapp/internal/tlsutil"
+	"chatstreamapp/internal/tracing"
+	"chatstreamapp/internal/webhook"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,38 +31,136 @@ import (
 func main() {
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("❌ Server panicked: %v\n", r)
+			logger.Error("server panicked", "panic", fmt.Sprint(r))
 		}
 	}()
-	
-	fmt.Println("🚀 Starting ChatStream Server...")
-	
+
+	configPath := flag.String("config", os.Getenv("CHAT_CONFIG"), "path to JSON config file")
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		logger.Error("failed to load config", "error", err)
+		os.Exit(1)
+	}
+	config.Set(cfg)
+	if err := logger.Configure(cfg.Log.Format, cfg.Log.Level); err != nil {
+		logger.Warning("ignoring log settings", "error", err)
+	}
+	logger.Info("starting chat server", "config", *configPath)
+
+	// Set up tracing
+	tracer, err := tracing.FromConfig(cfg.Tracing)
+	if err != nil {
+		logger.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+	tracing.SetTracer(tracer)
+	defer flushTraces(tracer)
+
+	// Set up moderation and its audit log
+	if cfg.Audit.Path != "" {
+		if err := audit.Default.Open(cfg.Audit.Path); err != nil {
+			logger.Error("failed to open audit log", "error", err)
+			os.Exit(1)
+		}
+		defer audit.Default.Close()
+	}
+	pipeline, err := moderation.FromConfig(cfg.Moderation)
+	if err != nil {
+		logger.Error("failed to set up moderation", "error", err)
+		os.Exit(1)
+	}
+	moderation.SetPipeline(pipeline)
+	if path := cfg.Moderation.SanctionsFile; path != "" {
+		if err := moderation.Sanctions.Load(path); err != nil {
+			logger.Error("failed to load sanctions", "error", err)
+			os.Exit(1)
+		}
+	}
+	if path := cfg.Privacy.SettingsFile; path != "" {
+		if err := privacy.Users.Load(path); err != nil {
+			logger.Error("failed to load privacy settings", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Reload configuration on SIGHUP
+	reloader := config.NewReloader(*configPath)
+	// Filters that fail to build reject the reload, so the running config
+	// always describes the running filters. Rebuilding starts the spam
+	// filter's duplicate counts over, so only do it when the filters
+	// changed. Reloads are serialized, so nextPipeline needs no lock.
+	var nextPipeline *moderation.Pipeline
+	reloader.OnValidate(func(old, new *config.Config) error {
+		nextPipeline = nil
+		if reflect.DeepEqual(new.Moderation, old.Moderation) {
+			return nil
+		}
+		pipeline, err := moderation.FromConfig(new.Moderation)
+		if err != nil {
+			return err
+		}
+		nextPipeline = pipeline
+		return nil
+	})
+	reloader.OnReload(func(old, new *config.Config) {
+		if new.Log.Level != old.Log.Level {
+			if err := logger.SetLevel(new.Log.Level); err != nil {
+				logger.Warning("ignoring log level", "error", err)
+			}
+		}
+		tracer.SetSampleRatio(new.Tracing.SampleRatio)
+		if nextPipeline != nil {
+			moderation.SetPipeline(nextPipeline)
+		}
+	})
+	go watchReloadSignal(reloader)
+
 	// Initialize the WebSocket hub
 	chatHub := hub.NewHub()
 	go chatHub.Run()
-	fmt.Println("✅ WebSocket hub initialized")
+	logger.Info("websocket hub initialized")
+
+	// Send scheduled announcements
+	if path := cfg.Announcements.File; path != "" {
+		if err := announce.Schedule.Load(path); err != nil {
+			logger.Error("failed to load announcements", "error", err)
+			os.Exit(1)
+		}
+	}
+	go announce.Schedule.Run(chatHub, nil)
+
+	// Deliver room events to registered webhooks
+	if path := cfg.Webhooks.File; path != "" {
+		if err := webhook.Hooks.Load(path); err != nil {
+			logger.Error("failed to load webhooks", "error", err)
+			os.Exit(1)
+		}
+	}
+	go webhook.Hooks.Run(nil)
+	if path := cfg.Webhooks.IncomingFile; path != "" {
+		if err := webhook.Inbound.Load(path); err != nil {
+			logger.Error("failed to load incoming webhooks", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Bots authenticate with tokens kept here
+	if path := cfg.Bots.File; path != "" {
+		if err := bot.Accounts.Load(path); err != nil {
+			logger.Error("failed to load bots", "error", err)
+			os.Exit(1)
+		}
+	}
 
 	// Setup Gin router
-	router := gin.Default()
-	fmt.Println("✅ Gin router initialized")
-	
-	// Add debug output
-	logger.Info("Initializing chat server...")
-	logger.Info("Setting up routes...")
+	router := gin.New()
+	router.Use(gin.Recovery(), api.RequestID(), api.Tracing(), api.RequestLogger(), api.Metrics())
 
 	// CORS middleware
-	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
-		
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		
-		c.Next()
-	})
+	router.Use(api.CORS())
 
 	// Serve static files
 	router.Static("/static", "./web/static")
@@ -52,19 +168,107 @@ func main() {
 
 	// Initialize API routes
 	api.SetupRoutes(router, chatHub)
+	api.SetupAdminRoutes(router, reloader, chatHub)
+	api.SetupModerationRoutes(router, chatHub)
+
+	// SSE and long-polling transports for clients that can't use WebSockets
+	sessions := api.NewSessions(chatHub)
+	go sessions.Run()
+	api.SetupSessionRoutes(router, sessions)
+
+	checker := health.NewChecker()
+	api.SetupHealthRoutes(router, chatHub, checker)
+	logger.Info("routes initialized")
 
 	// Start server
-	fmt.Println("🌐 Server starting on http://localhost:8080")
-	fmt.Println("🎯 Ready for connections!")
-	fmt.Println("📱 Open http://localhost:8080 in your browser to start chatting")
-	fmt.Println("⏹️  Press Ctrl+C to stop the server")
-	
-	logger.Info("Chat server starting on :8080")
-	logger.Info("Server ready to accept connections...")
-	if err := http.ListenAndServe(":8080", router); err != nil {
-		fmt.Printf("❌ Server failed to start: %v\n", err)
-		logger.Errorf("Server failed to start: %v", err)
-	}
-	fmt.Println("👋 Server stopped")
-	logger.Info("Server stopped")
+	addr := cfg.Server.Addr
+	server := &http.Server{
+		Addr:    addr,
+		Handler: router,
+	}
+	// Open SSE streams and polls would otherwise hold up shutdown
+	server.RegisterOnShutdown(sessions.Close)
+
+	tlsCfg := cfg.Server.TLS
+	scheme := "http"
+	if tlsCfg.Enabled() {
+		certs, err := tlsutil.NewCertReloader(tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.ClientCAFile)
+		if err != nil {
+			logger.Error("failed to load TLS certificate", "error", err)
+			os.Exit(1)
+		}
+		go certs.Watch(tlsCfg.ReloadInterval.Duration(), nil)
+		server.TLSConfig = tlsutil.ServerConfig(tlsCfg, certs)
+		scheme = "https"
+
+		if tlsCfg.RedirectAddr != "" {
+			go func() {
+				logger.Info("http redirect listener starting", "addr", tlsCfg.RedirectAddr)
+				if err := http.ListenAndServe(tlsCfg.RedirectAddr, tlsutil.RedirectHandler(addr)); err != nil {
+					logger.Error("http redirect listener failed", "error", err)
+				}
+			}()
+		}
+	}
+
+	shutdownDone := make(chan struct{})
+	go shutdownOnSignal(server, checker, shutdownDone)
+
+	logger.Info("chat server listening", "addr", addr, "scheme", scheme, "client_auth", tlsCfg.ClientAuth)
+	if tlsCfg.Enabled() {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("server failed", "error", err)
+		flushTraces(tracer)
+		os.Exit(1)
+	}
+	<-shutdownDone
+	logger.Info("server stopped")
+}
+
+// flushTraces exports spans still buffered in the tracer
+func flushTraces(tracer *tracing.Tracer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		logger.Warning("failed to flush traces", "error", err)
+	}
+}
+
+// shutdownOnSignal drains the server on SIGINT/SIGTERM: readiness fails
+// first so load balancers stop routing, then the listener closes and
+// in-flight requests get a grace period
+func shutdownOnSignal(server *http.Server, checker *health.Checker, done chan<- struct{}) {
+	defer close(done)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+
+	cfg := config.Get().Server
+	logger.Info("shutdown signal received, draining", "signal", sig.String(), "drain_delay", cfg.DrainDelay.String())
+	checker.SetDraining()
+	time.Sleep(cfg.DrainDelay.Duration())
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Duration())
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("graceful shutdown failed", "error", err)
+	}
+}
+
+// watchReloadSignal reloads the configuration each time SIGHUP is received
+func watchReloadSignal(reloader *config.Reloader) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		logger.Info("SIGHUP received, reloading configuration")
+		if _, err := reloader.Reload(); err != nil {
+			logger.Error("config reload failed, keeping current settings", "error", err)
+		}
+	}
 }
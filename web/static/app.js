@@ -1,9 +1,15 @@
 class ChatApp {
     constructor() {
         this.ws = null;
+        this.sessionId = null;
+        // Resume token and the seq of the last event handled, for reconnects
+        this.resumeToken = null;
+        this.lastSeq = 0;
         this.currentUser = null;
         this.currentRoom = null;
         this.privateChats = new Map();
+        // Room list by ID, kept current by the server's room events
+        this.rooms = new Map();
         this.init();
     }
 
@@ -12,10 +18,9 @@ class ChatApp {
         this.loadRooms();
         this.loadUsers();
         
-        // Auto-refresh rooms and users every 30 seconds
+        // Auto-refresh users every 30 seconds; rooms are pushed
         setInterval(() => {
             if (this.currentUser) {
-                this.loadRooms();
                 this.loadUsers();
             }
         }, 30000);
@@ -67,22 +72,32 @@ class ChatApp {
 
     connectWebSocket() {
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const wsUrl = `${protocol}//${window.location.host}/api/ws?user_id=${this.currentUser.id}&username=${encodeURIComponent(this.currentUser.username)}`;
-        
-        this.ws = new WebSocket(wsUrl);
+        let wsUrl = `${protocol}//${window.location.host}/api/ws?user_id=${this.currentUser.id}&username=${encodeURIComponent(this.currentUser.username)}`;
+        if (this.resumeToken) {
+            wsUrl += `&resume_token=${encodeURIComponent(this.resumeToken)}&last_seq=${this.lastSeq}`;
+        }
+
+        this.ws = new WebSocket(wsUrl, ['chat.v1']);
+        let opened = false;
 
         this.ws.onopen = () => {
             console.log('Connected to WebSocket');
+            opened = true;
             this.updateUserInfo();
         };
 
         this.ws.onmessage = (event) => {
-            const message = JSON.parse(event.data);
-            this.handleMessage(message);
+            this.handleFrame(JSON.parse(event.data));
         };
 
         this.ws.onclose = () => {
             console.log('WebSocket connection closed');
+            if (!opened) {
+                // Something between us and the server blocks WebSockets
+                this.ws = null;
+                this.connectEventSource();
+                return;
+            }
             setTimeout(() => {
                 if (this.currentUser) {
                     this.connectWebSocket();
@@ -95,11 +110,125 @@ class ChatApp {
         };
     }
 
+    // connectEventSource is the fallback transport: events arrive over
+    // Server-Sent Events and requests are POSTed to the session
+    async connectEventSource() {
+        try {
+            const response = await fetch('/api/sessions', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ user_id: this.currentUser.id, username: this.currentUser.username })
+            });
+            this.sessionId = (await response.json()).session_id;
+        } catch (error) {
+            console.error('Failed to create session:', error);
+            setTimeout(() => this.currentUser && this.connectEventSource(), 3000);
+            return;
+        }
+
+        const events = new EventSource(`/api/sessions/${this.sessionId}/events`);
+
+        events.onopen = () => {
+            console.log('Connected over Server-Sent Events');
+            this.updateUserInfo();
+        };
+
+        events.onmessage = (event) => {
+            this.handleFrame(JSON.parse(event.data));
+        };
+
+        events.onerror = () => {
+            // EventSource reconnects by itself unless the session is gone
+            if (events.readyState === EventSource.CLOSED) {
+                setTimeout(() => this.currentUser && this.connectEventSource(), 3000);
+            }
+        };
+    }
+
+    handleFrame(frame) {
+        if (frame.seq) {
+            this.lastSeq = frame.seq;
+        }
+        switch (frame.op) {
+            case 'session':
+                this.handleSession(frame.payload);
+                break;
+            case 'message':
+                this.handleMessage(frame.payload);
+                break;
+            case 'batch':
+                frame.payload.forEach(inner => this.handleFrame(inner));
+                break;
+            case 'rooms_snapshot':
+                this.rooms = new Map(frame.payload.rooms.map(room => [room.id, room]));
+                this.displayRooms();
+                break;
+            case 'room_created':
+            case 'room_updated':
+                this.rooms.set(frame.payload.id, frame.payload);
+                this.displayRooms();
+                break;
+            case 'room_deleted':
+                this.rooms.delete(frame.payload.id);
+                if (frame.payload.id === this.currentRoom) {
+                    // The server has already taken us out of it
+                    this.clearRoom();
+                }
+                this.displayRooms();
+                break;
+            case 'error':
+                console.warn(`Server rejected request: ${frame.payload.code}: ${frame.payload.message}`);
+                if (['message_held', 'message_rejected', 'muted', 'banned', 'dm_not_allowed'].includes(frame.payload.code)) {
+                    // Tell the sender why their message didn't appear
+                    this.displayMessage({
+                        type: 'system',
+                        content: frame.payload.message,
+                        timestamp: new Date().toISOString()
+                    });
+                }
+                break;
+        }
+    }
+
+    // handleSession keeps the resume token. When a reconnect couldn't resume
+    // the old session, the server has forgotten our room, so rejoin it.
+    handleSession(session) {
+        const reconnected = this.resumeToken !== null;
+        this.resumeToken = session.token;
+        if (session.resumed) {
+            return;
+        }
+
+        this.lastSeq = 0;
+        if (reconnected && this.currentRoom) {
+            document.getElementById('messages').innerHTML = '';
+            this.send('join_room', { room: this.currentRoom });
+        }
+    }
+
+    // send wraps an operation in a chat.v1 envelope
+    send(op, payload) {
+        const frame = JSON.stringify({ op, payload });
+        if (this.ws) {
+            this.ws.send(frame);
+            return;
+        }
+
+        // The reply is an ack or error frame
+        fetch(`/api/sessions/${this.sessionId}/frames`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: frame
+        })
+            .then(response => response.json())
+            .then(reply => this.handleFrame(reply))
+            .catch(error => console.error('Failed to send:', error));
+    }
+
     showChatInterface() {
         document.getElementById('loginContainer').style.display = 'none';
         document.getElementById('chatContainer').style.display = 'flex';
         document.getElementById('userInfo').style.display = 'flex';
-        this.loadRooms();
         this.loadUsers();
     }
 
@@ -108,30 +237,47 @@ class ChatApp {
         document.getElementById('currentRoom').textContent = this.currentRoom ? `Room: ${this.currentRoom}` : 'No room';
     }
 
+    // loadRooms fills the room list before connecting; once connected the
+    // server sends it as rooms_snapshot
     async loadRooms() {
         try {
             const response = await fetch('/api/rooms');
             const data = await response.json();
-            this.displayRooms(data.rooms);
+            this.rooms = new Map(data.rooms.map(room => [room.id, {
+                id: room.id,
+                name: room.name,
+                topic: room.topic,
+                members: room.user_count,
+                unread: 0,
+                visibility: room.visibility
+            }]));
+            this.displayRooms();
         } catch (error) {
             console.error('Failed to load rooms:', error);
         }
     }
 
-    displayRooms(rooms) {
+    displayRooms() {
         const roomsList = document.getElementById('roomsList');
         roomsList.innerHTML = '';
 
+        const rooms = [...this.rooms.values()].sort((a, b) => a.name.localeCompare(b.name));
         rooms.forEach(room => {
             const roomElement = document.createElement('div');
             roomElement.className = 'room-item';
             if (room.id === this.currentRoom) {
                 roomElement.classList.add('active');
             }
+            if (room.topic) {
+                roomElement.title = room.topic;
+            }
             
+            const unread = room.unread && room.id !== this.currentRoom
+                ? `<span class="unread">${room.unread}</span>`
+                : '';
             roomElement.innerHTML = `
-                <div>${room.name}</div>
-                <small>${room.user_count} users</small>
+                <div>${room.name}${unread}</div>
+                <small>${room.members} users${room.visibility === 'private' ? ' · private' : ''}</small>
             `;
             
             roomElement.addEventListener('click', () => this.joinRoom(room.id, room.name));
@@ -157,7 +303,6 @@ class ChatApp {
 
             if (response.ok) {
                 document.getElementById('roomNameInput').value = '';
-                this.loadRooms();
             } else {
                 alert('Failed to create room');
             }
@@ -170,12 +315,7 @@ class ChatApp {
     joinRoom(roomId, roomName) {
         if (this.currentRoom === roomId) return;
 
-        const message = {
-            type: 'join_room',
-            content: roomId
-        };
-
-        this.ws.send(JSON.stringify(message));
+        this.send('join_room', { room: roomId });
         this.currentRoom = roomId;
         
         // Update UI
@@ -185,18 +325,17 @@ class ChatApp {
         document.getElementById('messages').innerHTML = '';
         
         this.updateUserInfo();
-        this.loadRooms(); // Refresh to update active room
+        this.displayRooms(); // Refresh to update active room
     }
 
     leaveRoom() {
         if (!this.currentRoom) return;
 
-        const message = {
-            type: 'leave_room',
-            content: this.currentRoom
-        };
+        this.send('leave_room', { room: this.currentRoom });
+        this.clearRoom();
+    }
 
-        this.ws.send(JSON.stringify(message));
+    clearRoom() {
         this.currentRoom = null;
         
         // Update UI
@@ -206,7 +345,7 @@ class ChatApp {
         document.getElementById('messages').innerHTML = '';
         
         this.updateUserInfo();
-        this.loadRooms(); // Refresh to update active room
+        this.displayRooms(); // Refresh to update active room
     }
 
     sendMessage() {
@@ -215,13 +354,7 @@ class ChatApp {
         
         if (!content || !this.currentRoom) return;
 
-        const message = {
-            type: 'text',
-            content: content,
-            room: this.currentRoom
-        };
-
-        this.ws.send(JSON.stringify(message));
+        this.send('send_message', { room: this.currentRoom, content, format: 'markdown' });
         messageInput.value = '';
     }
 
@@ -231,6 +364,8 @@ class ChatApp {
             case 'join':
             case 'leave':
             case 'system':
+            case 'announcement':
+            case 'action':
                 this.displayMessage(message);
                 break;
             case 'private':
@@ -239,34 +374,123 @@ class ChatApp {
         }
     }
 
+    // messageContent returns a message's content as HTML: the server's
+    // sanitized rendering for markdown, the text as it is otherwise
+    messageContent(message) {
+        if (message.format === 'markdown' && message.html) {
+            return message.html;
+        }
+        const element = document.createElement('div');
+        element.textContent = message.content;
+        return element.innerHTML;
+    }
+
+    // renderAttachments builds the blocks integrations post below their
+    // messages. Their text comes from outside the chat, so it is never
+    // parsed as HTML.
+    renderAttachments(attachments) {
+        const colors = { good: '#2ecc71', warning: '#f39c12', danger: '#e74c3c' };
+        const container = document.createElement('div');
+        container.className = 'attachments';
+
+        attachments.forEach(attachment => {
+            const block = document.createElement('div');
+            block.className = 'attachment';
+            if (attachment.color) {
+                block.style.borderLeftColor = colors[attachment.color] || attachment.color;
+            }
+
+            if (attachment.title) {
+                const title = document.createElement(attachment.title_link ? 'a' : 'div');
+                title.className = 'attachment-title';
+                title.textContent = attachment.title;
+                if (attachment.title_link) {
+                    title.href = attachment.title_link;
+                    title.target = '_blank';
+                    title.rel = 'noopener noreferrer';
+                }
+                block.appendChild(title);
+            }
+            if (attachment.text) {
+                const text = document.createElement('div');
+                text.textContent = attachment.text;
+                block.appendChild(text);
+            }
+            (attachment.fields || []).forEach(field => {
+                const fieldElement = document.createElement('div');
+                fieldElement.className = field.short ? 'attachment-field short' : 'attachment-field';
+                const label = document.createElement('strong');
+                label.textContent = field.title;
+                const value = document.createElement('div');
+                value.textContent = field.value;
+                fieldElement.append(label, value);
+                block.appendChild(fieldElement);
+            });
+
+            container.appendChild(block);
+        });
+        return container;
+    }
+
     displayMessage(message) {
         const messagesContainer = document.getElementById('messages');
         const messageElement = document.createElement('div');
         
         let messageClass = 'message';
-        if (message.type === 'system' || message.type === 'join' || message.type === 'leave') {
+        if (message.type === 'announcement') {
+            messageClass += ' announcement';
+        } else if (message.type === 'action') {
+            messageClass += ' action';
+        } else if (message.type === 'system' || message.type === 'join' || message.type === 'leave') {
             messageClass += ' system';
         } else if (message.sender_id === this.currentUser.id) {
             messageClass += ' own';
         } else {
             messageClass += ' other';
+            if ((message.mentions || []).includes(this.currentUser.id)) {
+                messageClass += ' mention';
+            }
         }
         
+        if (message.ephemeral) {
+            messageClass += ' ephemeral';
+        }
         messageElement.className = messageClass;
         
         const time = new Date(message.timestamp).toLocaleTimeString();
         
-        if (message.type === 'system' || message.type === 'join' || message.type === 'leave') {
+        if (message.type === 'announcement') {
             messageElement.innerHTML = `
+                <div class="message-header">Announcement</div>
                 <div class="message-content">${message.content}</div>
                 <div class="message-time">${time}</div>
             `;
-        } else {
+        } else if (message.type === 'action') {
+            messageElement.innerHTML = `
+                <div class="message-content">* ${message.sender} ${message.content}</div>
+                <div class="message-time">${time}</div>
+            `;
+        } else if (message.type === 'system' || message.type === 'join' || message.type === 'leave') {
             messageElement.innerHTML = `
-                <div class="message-header">${message.sender}</div>
                 <div class="message-content">${message.content}</div>
                 <div class="message-time">${time}</div>
             `;
+        } else {
+            const badge = message.bot ? ' <span class="bot-badge">BOT</span>' : '';
+            messageElement.innerHTML = `
+                <div class="message-header">${message.sender}${badge}</div>
+                <div class="message-content">${this.messageContent(message)}</div>
+                <div class="message-time">${time}</div>
+            `;
+            if (message.attachments) {
+                messageElement.insertBefore(this.renderAttachments(message.attachments), messageElement.lastElementChild);
+            }
+        }
+        if (message.ephemeral) {
+            const note = document.createElement('div');
+            note.className = 'ephemeral-note';
+            note.textContent = 'Only visible to you';
+            messageElement.appendChild(note);
         }
         
         messagesContainer.appendChild(messageElement);
@@ -328,13 +552,7 @@ class ChatApp {
         
         if (!content) return;
 
-        const message = {
-            type: 'text',
-            content: content,
-            recipient: this.currentPrivateUser.id
-        };
-
-        this.ws.send(JSON.stringify(message));
+        this.send('send_message', { recipient: this.currentPrivateUser.id, content, format: 'markdown' });
         messageInput.value = '';
     }
 
@@ -384,7 +602,7 @@ class ChatApp {
         
         messageElement.innerHTML = `
             <div class="message-header">${message.sender}</div>
-            <div class="message-content">${message.content}</div>
+            <div class="message-content">${this.messageContent(message)}</div>
             <div class="message-time">${time}</div>
         `;
         